@@ -0,0 +1,298 @@
+package gophetch
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchWorkers       = 8
+	defaultPerHostConcurrency = 2
+)
+
+// BatchOptions configures how FetchMany spreads its requests.
+type BatchOptions struct {
+	// Workers is the maximum number of URLs being fetched at the same time. Default is 8.
+	Workers int
+	// PerHostConcurrency is the maximum number of URLs being fetched from a single host at the same time. Default
+	// is 2.
+	PerHostConcurrency int
+	// PerHostDelay is the minimum time between the start of two requests to the same host. Default is no delay.
+	// Hosts asking for a longer delay through a fetchers.CrawlDelayer in the chain, such as the Crawl-delay of a
+	// fetchers.RobotsFetcher, get that delay instead and one request at a time once it is known.
+	PerHostDelay time.Duration
+}
+
+// BatchResult is the outcome of fetching a single URL with FetchMany.
+type BatchResult struct {
+	// Index is the position of the URL in the slice passed to FetchMany.
+	Index int
+	// URL is the URL that was fetched.
+	URL string
+	// Result is the parsed result. It is only meaningful when Err is nil.
+	Result Result
+	// Err is the error returned for this URL, if any.
+	Err error
+}
+
+// FetchMany fetches and parses all the given URLs through the fetcher chain, and streams a BatchResult for every
+// URL on the returned channel as soon as it is done. Results arrive in completion order, use BatchResult.Index to
+// match them to the input. A failing URL does not abort the batch, its error is reported in its own result.
+//
+// Requests are spread according to opts: at most opts.Workers URLs are in flight, and each host gets at most
+// opts.PerHostConcurrency concurrent requests started at least opts.PerHostDelay apart. Hosts are served round
+// robin, so a slow host doesn't hold up the others.
+//
+// The channel is closed once every URL has a result, and must be drained by the caller. If ctx is cancelled, the
+// URLs that were not started yet are reported with the context's error.
+func (g *Gophetch) FetchMany(ctx context.Context, urls []string, opts BatchOptions) <-chan BatchResult {
+	results := make(chan BatchResult)
+	go func() {
+		defer close(results)
+		g.FetchManyFunc(ctx, urls, opts, func(result BatchResult) {
+			results <- result
+		})
+	}()
+	return results
+}
+
+// FetchManyFunc is like FetchMany, but calls fn with every result instead of sending it on a channel. Calls to fn
+// are serialized, so it doesn't need to be safe for concurrent use. FetchManyFunc returns once every URL has a
+// result.
+func (g *Gophetch) FetchManyFunc(ctx context.Context, urls []string, opts BatchOptions, fn func(BatchResult)) {
+	opts = opts.withDefaults()
+
+	sched := newHostScheduler(opts.PerHostConcurrency, opts.PerHostDelay)
+	for i, u := range urls {
+		sched.add(batchJob{index: i, url: u, host: hostKey(u)})
+	}
+
+	var fnMu sync.Mutex
+	deliver := func(result BatchResult) {
+		fnMu.Lock()
+		defer fnMu.Unlock()
+		fn(result)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := sched.next(ctx)
+				if !ok {
+					return
+				}
+
+				result, err := g.FetchAndParseContext(ctx, job.url)
+				if delay := g.CrawlDelay(ctx, job.url); delay > 0 {
+					sched.setCrawlDelay(job.host, delay)
+				}
+				sched.done(job.host)
+				deliver(BatchResult{Index: job.index, URL: job.url, Result: result, Err: err})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Report the URLs that were never started because the context was cancelled
+	for _, job := range sched.drain() {
+		deliver(BatchResult{Index: job.index, URL: job.url, Err: ctx.Err()})
+	}
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.Workers <= 0 {
+		o.Workers = defaultBatchWorkers
+	}
+	if o.PerHostConcurrency <= 0 {
+		o.PerHostConcurrency = defaultPerHostConcurrency
+	}
+	return o
+}
+
+// hostKey returns the key used to group URLs by host. URLs that can't be parsed share the empty key and fail once
+// they are fetched.
+func hostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+type batchJob struct {
+	index int
+	url   string
+	host  string
+}
+
+type hostQueue struct {
+	jobs      []batchJob
+	active    int
+	lastStart time.Time
+	nextStart time.Time
+	// crawlDelay is the delay the host asked for, if any. It replaces the scheduler's delay when it is longer.
+	crawlDelay time.Duration
+}
+
+// hostScheduler hands out batch jobs to workers while enforcing the per-host concurrency and delay limits.
+type hostScheduler struct {
+	mu      sync.Mutex
+	hosts   map[string]*hostQueue
+	order   []string
+	cursor  int
+	pending int
+	limit   int
+	delay   time.Duration
+	// changed is closed and replaced whenever a job is taken or finished, waking up all waiting workers.
+	changed chan struct{}
+}
+
+func newHostScheduler(limit int, delay time.Duration) *hostScheduler {
+	return &hostScheduler{
+		hosts:   make(map[string]*hostQueue),
+		limit:   limit,
+		delay:   delay,
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *hostScheduler) add(job batchJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.hosts[job.host]
+	if !ok {
+		q = &hostQueue{}
+		s.hosts[job.host] = q
+		s.order = append(s.order, job.host)
+	}
+	q.jobs = append(q.jobs, job)
+	s.pending++
+}
+
+// next blocks until a job can be started without breaking the per-host limits, and returns it. It returns false
+// once there are no jobs left or the context is done.
+func (s *hostScheduler) next(ctx context.Context) (batchJob, bool) {
+	for {
+		if ctx.Err() != nil {
+			return batchJob{}, false
+		}
+
+		s.mu.Lock()
+		if s.pending == 0 {
+			s.mu.Unlock()
+			return batchJob{}, false
+		}
+
+		job, wait, ok := s.take(time.Now())
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return job, true
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// take returns the next job that may start now, visiting the hosts round robin. If no job may start, it returns how
+// long until a host's delay runs out, or zero if every host with pending jobs is at its concurrency limit. The
+// caller must hold s.mu.
+func (s *hostScheduler) take(now time.Time) (batchJob, time.Duration, bool) {
+	var wait time.Duration
+	for i := 0; i < len(s.order); i++ {
+		idx := (s.cursor + i) % len(s.order)
+		q := s.hosts[s.order[idx]]
+		limit, delay := s.limit, s.delay
+		if q.crawlDelay > 0 {
+			// Hosts with a crawl delay expect requests one after the other
+			limit = 1
+			if q.crawlDelay > delay {
+				delay = q.crawlDelay
+			}
+		}
+		if len(q.jobs) == 0 || q.active >= limit {
+			continue
+		}
+
+		if d := q.nextStart.Sub(now); d > 0 {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		q.active++
+		q.lastStart = now
+		q.nextStart = now.Add(delay)
+		s.pending--
+		s.cursor = (idx + 1) % len(s.order)
+		s.broadcast()
+		return job, 0, true
+	}
+	return batchJob{}, wait, false
+}
+
+// done marks a job for the given host as finished, freeing its slot.
+func (s *hostScheduler) done(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[host].active--
+	s.broadcast()
+}
+
+// setCrawlDelay records the crawl delay of a host. The next request to the host starts no sooner than the delay
+// after the last one.
+func (s *hostScheduler) setCrawlDelay(host string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.hosts[host]
+	q.crawlDelay = delay
+	if next := q.lastStart.Add(delay); next.After(q.nextStart) {
+		q.nextStart = next
+	}
+}
+
+// drain removes and returns all the jobs that were never started.
+func (s *hostScheduler) drain() []batchJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []batchJob
+	for _, host := range s.order {
+		q := s.hosts[host]
+		jobs = append(jobs, q.jobs...)
+		q.jobs = nil
+	}
+	s.pending = 0
+	return jobs
+}
+
+// broadcast wakes up all workers waiting in next. The caller must hold s.mu.
+func (s *hostScheduler) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
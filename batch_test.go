@@ -0,0 +1,174 @@
+package gophetch_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/fetchers"
+)
+
+// hostTracker records how many requests each host is serving at once, and when each request started.
+type hostTracker struct {
+	mu        sync.Mutex
+	active    map[string]int
+	maxActive map[string]int
+	starts    map[string][]time.Time
+}
+
+func newHostTracker() *hostTracker {
+	return &hostTracker{
+		active:    make(map[string]int),
+		maxActive: make(map[string]int),
+		starts:    make(map[string][]time.Time),
+	}
+}
+
+func (h *hostTracker) handler(w http.ResponseWriter, r *http.Request) {
+	host := strings.Split(r.Host, ":")[0]
+
+	h.mu.Lock()
+	h.active[host]++
+	if h.active[host] > h.maxActive[host] {
+		h.maxActive[host] = h.active[host]
+	}
+	h.starts[host] = append(h.starts[host], time.Now())
+	h.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	h.mu.Lock()
+	h.active[host]--
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, `<html><head><title>%s</title><link rel="icon" href="/icon.png"></head></html>`, r.URL.Path)
+}
+
+func TestFetchMany(t *testing.T) {
+	tracker := newHostTracker()
+	server := httptest.NewServer(http.HandlerFunc(tracker.handler))
+	defer server.Close()
+
+	localhostURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	var urls []string
+	for i := 0; i < 10; i++ {
+		urls = append(urls, fmt.Sprintf("%s/a%d", server.URL, i))
+		urls = append(urls, fmt.Sprintf("%s/b%d", localhostURL, i))
+	}
+	urls = append(urls, "://not-a-url")
+
+	g := gophetch.New()
+	results := g.FetchMany(context.Background(), urls, gophetch.BatchOptions{
+		Workers:            6,
+		PerHostConcurrency: 2,
+		PerHostDelay:       30 * time.Millisecond,
+	})
+
+	seen := make(map[int]bool)
+	for result := range results {
+		assert.False(t, seen[result.Index], "duplicate result for %s", result.URL)
+		seen[result.Index] = true
+		assert.Equal(t, urls[result.Index], result.URL)
+
+		if result.URL == "://not-a-url" {
+			assert.Error(t, result.Err)
+			continue
+		}
+		if assert.NoError(t, result.Err) {
+			assert.True(t, strings.HasSuffix(result.URL, result.Result.Metadata.Title))
+		}
+	}
+	assert.Len(t, seen, len(urls))
+
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		assert.LessOrEqual(t, tracker.maxActive[host], 2, "per-host concurrency exceeded for %s", host)
+
+		// Requests reach the server with a little jitter, so only check the gaps roughly match the delay
+		starts := tracker.starts[host]
+		sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+		for i := 1; i < len(starts); i++ {
+			assert.GreaterOrEqual(t, starts[i].Sub(starts[i-1]), 20*time.Millisecond, "per-host delay not respected for %s", host)
+		}
+	}
+}
+
+func TestFetchManyCancelled(t *testing.T) {
+	tracker := newHostTracker()
+	server := httptest.NewServer(http.HandlerFunc(tracker.handler))
+	defer server.Close()
+
+	var urls []string
+	for i := 0; i < 20; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", server.URL, i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := gophetch.New()
+
+	var results []gophetch.BatchResult
+	g.FetchManyFunc(ctx, urls, gophetch.BatchOptions{PerHostConcurrency: 1}, func(result gophetch.BatchResult) {
+		results = append(results, result)
+		if len(results) == 2 {
+			cancel()
+		}
+	})
+
+	// Every URL still gets exactly one result, the ones that never started carry the context's error
+	assert.Len(t, results, len(urls))
+	cancelled := 0
+	for _, result := range results {
+		if result.Err != nil {
+			assert.ErrorIs(t, result.Err, context.Canceled)
+			cancelled++
+		}
+	}
+	assert.Greater(t, cancelled, 0)
+}
+
+func TestFetchManyCrawlDelay(t *testing.T) {
+	tracker := newHostTracker()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /blocked\nCrawl-delay: 0.1\n"))
+			return
+		}
+		tracker.handler(w, r)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a", server.URL + "/blocked", server.URL + "/b", server.URL + "/c"}
+
+	g := gophetch.New(fetchers.NewRobotsFetcher(&fetchers.StandardHTTPFetcher{}, "Gophetch/1.0"))
+	assert.Equal(t, 100*time.Millisecond, g.CrawlDelay(context.Background(), server.URL+"/"))
+
+	var results []gophetch.BatchResult
+	g.FetchManyFunc(context.Background(), urls, gophetch.BatchOptions{PerHostConcurrency: 1}, func(result gophetch.BatchResult) {
+		results = append(results, result)
+	})
+
+	assert.Len(t, results, len(urls))
+	for _, result := range results {
+		if result.URL == server.URL+"/blocked" {
+			assert.ErrorIs(t, result.Err, fetchers.ErrDisallowedByRobots)
+		} else {
+			assert.NoError(t, result.Err)
+		}
+	}
+
+	starts := tracker.starts["127.0.0.1"]
+	assert.Len(t, starts, 3)
+	for i := 1; i < len(starts); i++ {
+		assert.GreaterOrEqual(t, starts[i].Sub(starts[i-1]), 80*time.Millisecond, "crawl delay not respected")
+	}
+}
@@ -0,0 +1,117 @@
+package gophetch
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gogs/chardet"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// metaPrescanLen is how much of the body the HTML spec's prescan looks at for a <meta charset> or http-equiv tag.
+const metaPrescanLen = 1024
+
+// charsetSniffLen is how much of the body is looked at to detect its charset. The <meta charset> prescan only
+// needs the first 1024 bytes, content sniffing gets more reliable with more text.
+const charsetSniffLen = 8192
+
+// minSniffConfidence is the confidence, out of 100, needed to trust the charset detected from the content.
+const minSniffConfidence = 30
+
+// detectCharset determines the encoding of an HTML document from the start of its body and its Content-Type header.
+// It follows the order of the HTML spec: a byte order mark, the charset in the Content-Type header, then a
+// <meta charset> or http-equiv tag. If none of those are found and the body isn't valid UTF-8, the charset is
+// guessed from the content. It returns the encoding and its canonical name.
+func detectCharset(content []byte, contentType string) (encoding.Encoding, string) {
+	enc, name, certain := charset.DetermineEncoding(content, contentType)
+	if certain {
+		return enc, name
+	}
+	// DetermineEncoding isn't certain of a declared charset either, but the page's own declaration wins over guesses
+	if declared, declaredName := metaCharset(content); declared != nil {
+		return declared, declaredName
+	}
+	if validUTF8Prefix(content) {
+		return charset.Lookup("utf-8")
+	}
+
+	// DetermineEncoding falls back to windows-1252, see if the content tells us otherwise
+	result, err := chardet.NewHtmlDetector().DetectBest(content)
+	if err != nil || result.Confidence < minSniffConfidence {
+		return enc, name
+	}
+	for _, label := range []string{result.Charset, strings.ReplaceAll(result.Charset, "-", "")} {
+		if sniffed, sniffedName := charset.Lookup(label); sniffed != nil {
+			return sniffed, sniffedName
+		}
+	}
+	return enc, name
+}
+
+// validUTF8Prefix reports whether content is valid UTF-8, ignoring a character cut off at the end.
+func validUTF8Prefix(content []byte) bool {
+	for i := 1; i < utf8.UTFMax && i <= len(content); i++ {
+		if utf8.RuneStart(content[len(content)-i]) {
+			if !utf8.FullRune(content[len(content)-i:]) {
+				content = content[:len(content)-i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(content)
+}
+
+// metaCharset returns the encoding declared by a <meta charset> or http-equiv tag at the start of the content, as
+// the prescan of the HTML spec finds it, or nil if there is none.
+func metaCharset(content []byte) (encoding.Encoding, string) {
+	if len(content) > metaPrescanLen {
+		content = content[:metaPrescanLen]
+	}
+	z := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return nil, ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, hasAttr := z.TagName()
+			if string(tag) != "meta" {
+				continue
+			}
+			var label, contentAttr string
+			var contentType bool
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "charset":
+					label = string(val)
+				case "http-equiv":
+					contentType = strings.EqualFold(string(val), "content-type")
+				case "content":
+					contentAttr = string(val)
+				}
+			}
+			if label == "" && contentType {
+				if _, params, err := mime.ParseMediaType(contentAttr); err == nil {
+					label = params["charset"]
+				}
+			}
+			if label == "" {
+				continue
+			}
+			enc, name := charset.Lookup(label)
+			if enc == nil {
+				continue
+			}
+			// A document that was read as bytes can't be UTF-16, whatever it says
+			if strings.HasPrefix(name, "utf-16") {
+				return charset.Lookup("utf-8")
+			}
+			return enc, name
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package gophetch_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"github.com/octetic/gophetch"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCharsetDetection(t *testing.T) {
+	const japaneseTitle = "日本語のページ"
+	const japaneseText = "吾輩は猫である。名前はまだ無い。どこで生れたかとんと見当がつかぬ。何でも薄暗いじめじめした所でニャーニャー泣いていた事だけは記憶している。"
+	const russianTitle = "Новости дня"
+	const chineseTitle = "中文网页标题"
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            []byte
+		expectedTitle   string
+		expectedCharset string
+	}{
+		{
+			name:            "Content-Type header",
+			contentType:     "text/html; charset=Shift_JIS",
+			body:            encode(t, japanese.ShiftJIS, "<html><head><title>"+japaneseTitle+"</title></head></html>"),
+			expectedTitle:   japaneseTitle,
+			expectedCharset: "shift_jis",
+		},
+		{
+			name:            "meta charset",
+			contentType:     "text/html",
+			body:            encode(t, charmap.Windows1251, `<html><head><meta charset="windows-1251"><title>`+russianTitle+`</title></head></html>`),
+			expectedTitle:   russianTitle,
+			expectedCharset: "windows-1251",
+		},
+		{
+			// The Cyrillic text comes after the bytes sniffed, so only the declaration tells
+			name:        "meta charset before a long head",
+			contentType: "text/html",
+			body: encode(t, charmap.Windows1251, `<html><head><meta charset="windows-1251"><style>`+
+				strings.Repeat("p { margin: 0; }\n", 600)+`</style><title>`+russianTitle+`</title></head></html>`),
+			expectedTitle:   russianTitle,
+			expectedCharset: "windows-1251",
+		},
+		{
+			name:            "meta http-equiv",
+			contentType:     "text/html",
+			body:            encode(t, simplifiedchinese.GBK, `<html><head><meta http-equiv="Content-Type" content="text/html; charset=gb2312"><title>`+chineseTitle+`</title></head></html>`),
+			expectedTitle:   chineseTitle,
+			expectedCharset: "gbk",
+		},
+		{
+			name:            "byte order mark",
+			contentType:     "text/html",
+			body:            append([]byte("\xef\xbb\xbf"), []byte("<html><head><title>"+japaneseTitle+"</title></head></html>")...),
+			expectedTitle:   japaneseTitle,
+			expectedCharset: "utf-8",
+		},
+		{
+			name:            "content sniffing",
+			contentType:     "text/html",
+			body:            encode(t, japanese.ShiftJIS, "<html><head><title>"+japaneseTitle+"</title></head><body><p>"+japaneseText+"</p></body></html>"),
+			expectedTitle:   japaneseTitle,
+			expectedCharset: "shift_jis",
+		},
+		{
+			name:            "undeclared UTF-8",
+			contentType:     "text/html",
+			body:            []byte("<html><head><title>" + russianTitle + "</title></head></html>"),
+			expectedTitle:   russianTitle,
+			expectedCharset: "utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			g := gophetch.New()
+			result, err := g.FetchAndParseContext(context.Background(), server.URL)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTitle, result.Metadata.Title)
+			assert.Equal(t, tt.expectedCharset, result.Metadata.Meta.Charset)
+
+			// Documents that are read directly are detected the same way, unless the charset was only in the header
+			if strings.Contains(tt.contentType, "charset") {
+				return
+			}
+			result, err = g.ReadAndParse(bytes.NewReader(tt.body), server.URL)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTitle, result.Metadata.Title)
+		})
+	}
+}
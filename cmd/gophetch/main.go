@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/peterbourgon/ff/v3"
 
@@ -123,6 +124,12 @@ func printMetadata(metadata metadata.Metadata) {
 	fmt.Printf("Author: %s\n", metadata.Author)
 	fmt.Printf("CanonicalURL: %s\n", metadata.CanonicalURL)
 	fmt.Printf("Date: %s\n", metadata.Date)
+	if metadata.PublishedAt != nil {
+		fmt.Printf("PublishedAt: %s (%.2f)\n", metadata.PublishedAt.Time.Format(time.RFC3339), metadata.PublishedAt.Confidence)
+	}
+	if metadata.ModifiedAt != nil {
+		fmt.Printf("ModifiedAt: %s (%.2f)\n", metadata.ModifiedAt.Time.Format(time.RFC3339), metadata.ModifiedAt.Confidence)
+	}
 	fmt.Printf("Description: %s\n", metadata.Description)
 	//fmt.Printf("HTML: %s\n", metadata.HTML)
 	fmt.Printf("FaviconURL: %s\n", metadata.FaviconURL)
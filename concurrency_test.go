@@ -0,0 +1,127 @@
+package gophetch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/rules"
+)
+
+// overrideSite replaces the title rule for a single domain.
+type overrideSite struct {
+	domain string
+}
+
+func (s overrideSite) DomainKey() string {
+	return s.domain
+}
+
+func (s overrideSite) Rules() map[string]rules.Rule {
+	return map[string]rules.Rule{
+		"title": &rules.BaseRule{
+			Strategies: []rules.ExtractionStrategy{
+				{
+					Selectors: []string{"h1.site-title"},
+					Extractor: rules.ExtractCSS,
+				},
+			},
+		},
+	}
+}
+
+// TestConcurrentFetchAndParse hammers a single Gophetch instance from many goroutines. Run it with -race.
+func TestConcurrentFetchAndParse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := strings.TrimPrefix(r.URL.Path, "/")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprintf(w, `<html><head>
+			<title>page %[1]s</title>
+			<meta name="description" content="description %[1]s">
+			<link rel="icon" href="/icon-%[1]s.png">
+			</head><body><h1 class="site-title">Site Override</h1></body></html>`, page)
+	}))
+	defer server.Close()
+
+	// The same server is reachable as both 127.0.0.1 and localhost, but only localhost has site-specific rules.
+	localhostURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	g := gophetch.New()
+	g.RegisterSite(overrideSite{domain: "localhost"})
+
+	const workers = 8
+	const requests = 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				page := fmt.Sprintf("%d-%d", w, i)
+				useOverride := (w+i)%2 == 0
+
+				baseURL := server.URL
+				expectedTitle := "page " + page
+				if useOverride {
+					baseURL = localhostURL
+					expectedTitle = "Site Override"
+				}
+
+				result, err := g.FetchAndParseContext(context.Background(), baseURL+"/"+page)
+				if !assert.NoError(t, err) {
+					continue
+				}
+				assert.Equal(t, expectedTitle, result.Metadata.Title)
+				assert.Equal(t, "description "+page, result.Metadata.Description)
+				assert.Equal(t, baseURL+"/icon-"+page+".png", result.Metadata.FaviconURL)
+				assert.Empty(t, result.Errors)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// The shared extractor must not have picked up the site-specific rules
+	_, isBaseRule := g.Extractor.Rules["title"].(*rules.BaseRule)
+	assert.False(t, isBaseRule)
+}
+
+// failingRule always fails.
+type failingRule struct{}
+
+func (failingRule) Extract(*html.Node, *url.URL) (rules.ExtractResult, error) {
+	return rules.NewNoResult(), errors.New("rule failed")
+}
+
+// The APIs that modify the Extractor still work for the callers that don't share it
+func TestDeprecatedExtractorAPIs(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<title>Page</title><h1 class="site-title">Site Override</h1>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://localhost/page")
+
+	ext := gophetch.NewExtractor()
+	ext.ApplySiteSpecificRules(overrideSite{domain: "localhost"})
+	ext.Rules["broken"] = failingRule{}
+
+	meta, err := ext.ExtractMetadata(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Site Override", meta.Title)
+	}
+	if assert.Len(t, ext.Errors, 1) {
+		assert.EqualError(t, ext.Errors[0], "rule broken: rule failed")
+	}
+
+	assert.NotNil(t, gophetch.New().Parser)
+}
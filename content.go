@@ -0,0 +1,267 @@
+package gophetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+
+	"github.com/octetic/gophetch/helpers"
+	"github.com/octetic/gophetch/media"
+	"github.com/octetic/gophetch/metadata"
+)
+
+// Kind is the kind of content a URL points to. It is also stored in metadata.Metadata.Kind.
+type Kind string
+
+const (
+	// KindArticle is an HTML page.
+	KindArticle Kind = "article"
+	// KindImage is an image, described in Result.Media and metadata.Metadata.Image.
+	KindImage Kind = "image"
+	// KindVideo is a video file, described in Result.Media and metadata.Metadata.Video.
+	KindVideo Kind = "video"
+	// KindAudio is an audio file, described in Result.Media and metadata.Metadata.Audio.
+	KindAudio Kind = "audio"
+	// KindPDF is a PDF document, described in Result.PDF.
+	KindPDF Kind = "pdf"
+	// KindText is a plain text document, stored as the readable text.
+	KindText Kind = "text"
+	// KindJSON is a JSON document.
+	KindJSON Kind = "json"
+	// KindFile is any other kind of file.
+	KindFile Kind = "file"
+)
+
+// sniffLen is how much of the body is used to detect its content type, see http.DetectContentType.
+const sniffLen = 512
+
+// maxTextSize is the most we are willing to read of a plain text or PDF document.
+const maxTextSize = media.DefaultMaxMediaSize
+
+// sniffMediaType returns the media type of a response, without parameters. The start of the body is only used when
+// the server didn't send a useful Content-Type.
+func sniffMediaType(contentType string, start []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(start))
+	}
+	return strings.ToLower(mediaType)
+}
+
+// kindOf returns the kind of content for a media type.
+func kindOf(mediaType string) Kind {
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return KindArticle
+	case strings.HasPrefix(mediaType, "image/"):
+		return KindImage
+	case strings.HasPrefix(mediaType, "video/"):
+		return KindVideo
+	case strings.HasPrefix(mediaType, "audio/"):
+		return KindAudio
+	case mediaType == "application/pdf":
+		return KindPDF
+	case mediaType == "text/plain", mediaType == "text/markdown":
+		return KindText
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return KindJSON
+	default:
+		return KindFile
+	}
+}
+
+// parseContent builds the result for a response that isn't an HTML page. The body is described according to its
+// kind instead of being parsed as HTML. Problems reading the body are reported in Result.Errors, so the result still
+// carries what is known from the headers.
+func parseContent(ctx context.Context, kind Kind, resp *http.Response, body io.Reader, targetURL string) Result {
+	result := Result{
+		Headers:    resp.Header,
+		MimeType:   resp.Header.Get("Content-Type"),
+		Response:   resp,
+		StatusCode: resp.StatusCode,
+		Kind:       kind,
+	}
+	result.Metadata.URL = targetURL
+	result.Metadata.Title = fileName(targetURL)
+
+	var err error
+	switch kind {
+	case KindImage:
+		err = describeImage(&result, resp, body, targetURL)
+	case KindVideo, KindAudio:
+		describeAudioVideo(&result, resp, targetURL)
+	case KindPDF:
+		err = describePDF(&result, body)
+	case KindText:
+		err = describeText(ctx, &result, body)
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("reading %s: %w", kind, err))
+	}
+
+	result.Metadata.Kind = string(kind)
+	return result
+}
+
+func describeImage(result *Result, resp *http.Response, body io.Reader, targetURL string) error {
+	// The media package closes the body it is given, the caller closes the real one
+	imgResp := *resp
+	imgResp.Body = io.NopCloser(body)
+
+	var img *media.Media
+	var err error
+	switch mediaType, _, _ := mime.ParseMediaType(result.MimeType); mediaType {
+	case "image/svg+xml", "image/x-icon", "image/vnd.microsoft.icon":
+		img, err = media.NewVectorImageFromHTTPResponse(&imgResp, targetURL, 0)
+	default:
+		img, err = media.NewImageFromHTTPResponse(&imgResp, targetURL, 0)
+	}
+	if err != nil {
+		// Formats we can't decode are still described by their headers
+		img = media.NewMediaFromHTTPHeader(resp, targetURL)
+	}
+
+	result.Media = img
+	result.Metadata.LeadImageURL = targetURL
+	result.Metadata.Image = metadata.Image{
+		URL:        targetURL,
+		Type:       img.ContentType,
+		Width:      img.Width,
+		Height:     img.Height,
+		Size:       int(img.ContentSize),
+		SizePretty: helpers.PrettySize(img.ContentSize),
+	}
+	return err
+}
+
+// describeAudioVideo describes audio and video files from their headers, as they are usually too large to download.
+func describeAudioVideo(result *Result, resp *http.Response, targetURL string) {
+	m := media.NewMediaFromHTTPHeader(resp, targetURL)
+	result.Media = m
+
+	if m.MediaType == media.AudioType {
+		result.Metadata.Audio = metadata.Audio{
+			URL:        targetURL,
+			Type:       m.ContentType,
+			Size:       int(m.ContentSize),
+			SizePretty: helpers.PrettySize(m.ContentSize),
+		}
+		return
+	}
+	result.Metadata.Video = metadata.Video{
+		URL:        targetURL,
+		Type:       m.ContentType,
+		Size:       int(m.ContentSize),
+		SizePretty: helpers.PrettySize(m.ContentSize),
+	}
+}
+
+func describePDF(result *Result, body io.Reader) error {
+	data, err := readLimited(body, maxTextSize)
+	if err != nil {
+		return err
+	}
+
+	info, err := media.ParsePDFInfo(data)
+	if err != nil {
+		return err
+	}
+
+	result.PDF = &info
+	if info.Title != "" {
+		result.Metadata.Title = info.Title
+	}
+	result.Metadata.Author = info.Author
+	result.Metadata.Description = info.Subject
+	if !info.CreatedAt.IsZero() {
+		result.Metadata.Date = info.CreatedAt.Format(time.RFC3339)
+		result.Metadata.PublishedAt = &metadata.Date{Time: info.CreatedAt, Confidence: 1, Raw: result.Metadata.Date}
+	}
+	if !info.ModifiedAt.IsZero() {
+		modified := info.ModifiedAt.Format(time.RFC3339)
+		result.Metadata.ModifiedAt = &metadata.Date{Time: info.ModifiedAt, Confidence: 1, Raw: modified}
+	}
+	return nil
+}
+
+// describeText makes a plain text document the readable content of the result. Its first line is used as the title.
+func describeText(ctx context.Context, result *Result, body io.Reader) error {
+	buffered := bufio.NewReaderSize(&contextReader{ctx: ctx, r: body}, charsetSniffLen)
+	start, _ := buffered.Peek(charsetSniffLen)
+	enc, name := detectCharset(start, result.MimeType)
+
+	var reader io.Reader = buffered
+	if name != "utf-8" {
+		reader = transform.NewReader(buffered, enc.NewDecoder())
+	}
+	data, err := readLimited(reader, maxTextSize)
+	if err != nil {
+		return err
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result.Metadata.Title = truncateText(line, 200)
+			break
+		}
+	}
+
+	m := &result.Metadata
+	m.Meta.Charset = name
+	m.Description = truncateText(strings.Join(strings.Fields(text), " "), 255)
+	m.IsReadable = true
+	m.ReadableTitle = m.Title
+	m.ReadableText = text
+	m.ReadableHTML = "<pre>" + html.EscapeString(text) + "</pre>"
+	m.ReadableExcerpt = m.Description
+	m.ReadableLength = utf8.RuneCountInString(text)
+	return nil
+}
+
+// readLimited reads all of r, failing if it holds more than limit bytes.
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("document exceeds max size of %d bytes", limit)
+	}
+	return data, nil
+}
+
+// truncateText cuts s to at most n characters, adding an ellipsis if it was cut.
+func truncateText(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+// fileName returns the last segment of the URL's path, which is the best title we have for most files.
+func fileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
@@ -0,0 +1,150 @@
+package gophetch_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+)
+
+const testPDF = `%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>
+endobj
+3 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+4 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+5 0 obj
+<< /Title (Quarterly Results) /Author (Finance Team) /CreationDate (D:20240102030405Z) >>
+endobj
+trailer
+<< /Size 6 /Root 1 0 R /Info 5 0 R >>
+%%EOF
+`
+
+func TestFetchNonHTMLContent(t *testing.T) {
+	var img bytes.Buffer
+	_ = png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(img.Bytes())
+		case "/clip.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			_, _ = w.Write(make([]byte, 2048))
+		case "/song.mp3":
+			w.Header().Set("Content-Type", "audio/mpeg")
+			_, _ = w.Write(make([]byte, 1024))
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte(testPDF))
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("\n  Release notes  \n\nEverything is <faster> now.\n"))
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"title": "not a page"}`))
+		case "/archive":
+			// No Content-Type, the body is sniffed
+			w.Header()["Content-Type"] = nil
+			_, _ = w.Write([]byte("PK\x03\x04 zipped"))
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head><title>Article</title></head><body></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	g := gophetch.New()
+	fetch := func(path string) gophetch.Result {
+		result, err := g.FetchAndParseContext(context.Background(), server.URL+path)
+		assert.NoError(t, err)
+		assert.Empty(t, result.Errors)
+		assert.Equal(t, string(result.Kind), result.Metadata.Kind)
+		return result
+	}
+
+	t.Run("article", func(t *testing.T) {
+		result := fetch("/article")
+		assert.Equal(t, gophetch.KindArticle, result.Kind)
+		assert.Equal(t, "Article", result.Metadata.Title)
+		assert.True(t, result.IsHTML)
+	})
+
+	t.Run("image", func(t *testing.T) {
+		result := fetch("/photo.png")
+		assert.Equal(t, gophetch.KindImage, result.Kind)
+		assert.Nil(t, result.HTMLNode)
+		if assert.NotNil(t, result.Media) {
+			assert.Equal(t, "png", result.Media.Format)
+		}
+		assert.Equal(t, 3, result.Metadata.Image.Width)
+		assert.Equal(t, 2, result.Metadata.Image.Height)
+		assert.Equal(t, "image/png", result.Metadata.Image.Type)
+		assert.Equal(t, img.Len(), result.Metadata.Image.Size)
+		assert.Equal(t, server.URL+"/photo.png", result.Metadata.LeadImageURL)
+		assert.Equal(t, "photo.png", result.Metadata.Title)
+	})
+
+	t.Run("video", func(t *testing.T) {
+		result := fetch("/clip.mp4")
+		assert.Equal(t, gophetch.KindVideo, result.Kind)
+		assert.Equal(t, "video/mp4", result.Metadata.Video.Type)
+		assert.Equal(t, 2048, result.Metadata.Video.Size)
+		assert.Equal(t, "2.0 KB", result.Metadata.Video.SizePretty)
+	})
+
+	t.Run("audio", func(t *testing.T) {
+		result := fetch("/song.mp3")
+		assert.Equal(t, gophetch.KindAudio, result.Kind)
+		assert.Equal(t, "audio/mpeg", result.Metadata.Audio.Type)
+		assert.Equal(t, 1024, result.Metadata.Audio.Size)
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		result := fetch("/report.pdf")
+		assert.Equal(t, gophetch.KindPDF, result.Kind)
+		assert.Equal(t, "Quarterly Results", result.Metadata.Title)
+		assert.Equal(t, "Finance Team", result.Metadata.Author)
+		assert.Equal(t, "2024-01-02T03:04:05Z", result.Metadata.Date)
+		if assert.NotNil(t, result.PDF) {
+			assert.Equal(t, 2, result.PDF.Pages)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		result := fetch("/notes.txt")
+		assert.Equal(t, gophetch.KindText, result.Kind)
+		assert.Equal(t, "Release notes", result.Metadata.Title)
+		assert.True(t, result.Metadata.IsReadable)
+		assert.Contains(t, result.Metadata.ReadableText, "Everything is <faster> now.")
+		assert.Contains(t, result.Metadata.ReadableHTML, "Everything is &lt;faster&gt; now.")
+		assert.Equal(t, "utf-8", result.Metadata.Meta.Charset)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		result := fetch("/data.json")
+		assert.Equal(t, gophetch.KindJSON, result.Kind)
+		assert.Equal(t, "data.json", result.Metadata.Title)
+	})
+
+	t.Run("sniffed file", func(t *testing.T) {
+		result := fetch("/archive")
+		assert.Equal(t, gophetch.KindFile, result.Kind)
+	})
+}
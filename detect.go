@@ -0,0 +1,272 @@
+package gophetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrBlocked is returned, wrapped in a PageError, when every fetcher got a bot block instead of the page.
+	ErrBlocked = errors.New("blocked")
+	// ErrSoftError is returned, wrapped in a PageError, when every fetcher got an error page served as a success.
+	ErrSoftError = errors.New("soft error")
+)
+
+// DetectionKind is what a page turned out to be instead of the content asked for.
+type DetectionKind string
+
+const (
+	// DetectedChallenge is a browser check, such as a Cloudflare "Just a moment..." page.
+	DetectedChallenge DetectionKind = "challenge"
+	// DetectedCaptcha is a captcha wall.
+	DetectedCaptcha DetectionKind = "captcha"
+	// DetectedAccessDenied is an "Access denied" page.
+	DetectedAccessDenied DetectionKind = "access-denied"
+	// DetectedRateLimited is a "Too many requests" page.
+	DetectedRateLimited DetectionKind = "rate-limited"
+
+	// DetectedConsent is a cookie consent interstitial standing in front of the page.
+	DetectedConsent DetectionKind = "consent"
+	// DetectedNotFound is a "Page not found" page served with a success status.
+	DetectedNotFound DetectionKind = "not-found"
+	// DetectedError is an error page served with a success status.
+	DetectedError DetectionKind = "error"
+)
+
+// Detection is a bot block or a soft error found on a page.
+type Detection struct {
+	Kind DetectionKind `json:"kind"`
+	// Signal is what gave the page away, such as `header cf-mitigated: challenge` or `title "Access denied"`.
+	Signal string `json:"signal"`
+}
+
+// softError reports whether the detection is a soft error rather than a bot block.
+func (d Detection) softError() bool {
+	switch d.Kind {
+	case DetectedConsent, DetectedNotFound, DetectedError:
+		return true
+	}
+	return false
+}
+
+// reason describes the detection as a reason to escalate, such as "blocked: captcha".
+func (d Detection) reason() string {
+	if d.softError() {
+		return "soft error: " + string(d.Kind)
+	}
+	return "blocked: " + string(d.Kind)
+}
+
+// PageError is returned when Gophetch.EscalateDetected is set and the last fetcher of the chain got a bot block or a
+// soft error. It wraps ErrBlocked or ErrSoftError.
+type PageError struct {
+	URL       string
+	Fetcher   string
+	Detection Detection
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%s: %s from %s (%s)", e.URL, e.Detection.reason(), e.Fetcher, e.Detection.Signal)
+}
+
+func (e *PageError) Unwrap() error {
+	if e.Detection.softError() {
+		return ErrSoftError
+	}
+	return ErrBlocked
+}
+
+// maxBlockPageText is the most visible text, in bytes, a page may have for the markers of captchas and consent
+// managers to count. Challenge and consent interstitials are short, while regular pages embed the same widgets in
+// comment forms and cookie banners.
+const maxBlockPageText = 1000
+
+// maxTitlePageText is the most visible text, in bytes, a page may have for a part of its title, such as "Page not
+// found" in "Page not found | Example", to give it away. Error pages keep the navigation of the site, but articles
+// titled "CAPTCHA - Wikipedia" or "Error: The Movie" have much more text. A whole title counts on any page.
+const maxTitlePageText = 2500
+
+// blockHeaders are response headers set by anti-bot services when they block a request.
+var blockHeaders = []struct {
+	name   string
+	values []string
+	kind   DetectionKind
+}{
+	{"Cf-Mitigated", []string{"challenge"}, DetectedChallenge},
+	{"X-Amzn-Waf-Action", []string{"captcha"}, DetectedCaptcha},
+	{"X-Amzn-Waf-Action", []string{"challenge"}, DetectedChallenge},
+}
+
+// pageMarkers are found in the attributes and scripts of block and consent pages.
+var pageMarkers = []struct {
+	marker string
+	kind   DetectionKind
+	// short is set for markers only found on interstitials if the page has little text. The scripts of the
+	// anti-bot services are also injected in the pages they let through.
+	short bool
+}{
+	{"/cdn-cgi/challenge-platform/", DetectedChallenge, true},
+	{"cf_chl_opt", DetectedChallenge, false},
+	{"cf-browser-verification", DetectedChallenge, false},
+	{"_incapsula_resource", DetectedChallenge, true},
+	{"captcha-delivery.com", DetectedCaptcha, false},
+	{"px-captcha", DetectedCaptcha, false},
+	{"g-recaptcha", DetectedCaptcha, true},
+	{"h-captcha", DetectedCaptcha, true},
+	{"cf-turnstile", DetectedCaptcha, true},
+	{"consent.google.", DetectedConsent, true},
+	{"consent.yahoo.", DetectedConsent, true},
+	{"onetrust-consent-sdk", DetectedConsent, true},
+	{"didomi-notice", DetectedConsent, true},
+	{"qc-cmp2", DetectedConsent, true},
+	{"fc-consent-root", DetectedConsent, true},
+	{"cybotcookiebotdialog", DetectedConsent, true},
+	{"sp_message_container", DetectedConsent, true},
+}
+
+// titleSeparatorRegex splits titles such as "Page not found | Example" into their parts.
+var titleSeparatorRegex = regexp.MustCompile(`\s+[|\-–—·:]\s+|:\s+`)
+
+// titleDetections match a whole part of a title, so articles about captchas or missing pages aren't mistaken for
+// them.
+var titleDetections = []struct {
+	pattern *regexp.Regexp
+	kind    DetectionKind
+}{
+	{regexp.MustCompile(`(?i)^(just a moment\.*|checking your browser.*|please wait while we verify.*|one more step|ddos-guard)$`), DetectedChallenge},
+	{regexp.MustCompile(`(?i)^(are you a (robot|human)\??|verify (that )?you are (a )?human|human verification|pardon our interruption|captcha)$`), DetectedCaptcha},
+	{regexp.MustCompile(`(?i)^(access denied|access to this page has been denied\.?|attention required!?|(error )?403( forbidden)?|forbidden|request blocked|you have been blocked)$`), DetectedAccessDenied},
+	{regexp.MustCompile(`(?i)^((429 )?too many requests|rate limit(ed| exceeded))$`), DetectedRateLimited},
+	{regexp.MustCompile(`(?i)^(before you continue( to .*)?|privacy settings|cookie consent|we value your privacy)$`), DetectedConsent},
+	{regexp.MustCompile(`(?i)^((error )?404( not found)?|page not found|not found|(this )?page (does not|doesn't) exist|page no longer available)$`), DetectedNotFound},
+	{regexp.MustCompile(`(?i)^(error|an error (has )?occurred|something went wrong|(500 )?internal server error|(503 )?service unavailable|502 bad gateway)$`), DetectedError},
+}
+
+// Detect classifies a parsed page as a bot block, such as a challenge, a captcha wall or an "Access denied" page, or
+// as a soft error, such as a cookie consent interstitial or a "Page not found" page served with a 200 status. It
+// looks at the headers set by anti-bot services, the markers they leave in the page, and the title. At most one of
+// the returned detections is set. The header and status code may be empty, for pages that were not fetched.
+func Detect(header http.Header, statusCode int, doc *html.Node) (blocked, softError *Detection) {
+	for _, h := range blockHeaders {
+		value, ok := header[h.name]
+		if !ok || len(value) == 0 {
+			continue
+		}
+		if containsFold(h.values, value[0]) {
+			return &Detection{Kind: h.kind, Signal: fmt.Sprintf("header %s: %s", strings.ToLower(h.name), value[0])}, nil
+		}
+	}
+
+	page := scanPage(doc)
+	var found *Detection
+	for _, m := range pageMarkers {
+		if (!m.short || page.textLen <= maxBlockPageText) && strings.Contains(page.markers, m.marker) {
+			found = &Detection{Kind: m.kind, Signal: fmt.Sprintf("marker %q", m.marker)}
+			break
+		}
+	}
+	if found == nil && page.title != "" {
+		found = detectTitle(page.title, page.textLen <= maxTitlePageText)
+	}
+	if found == nil && page.textLen <= maxBlockPageText {
+		switch statusCode {
+		case http.StatusTooManyRequests:
+			found = &Detection{Kind: DetectedRateLimited, Signal: "status 429"}
+		case http.StatusForbidden:
+			found = &Detection{Kind: DetectedAccessDenied, Signal: "status 403"}
+		}
+	}
+
+	switch {
+	case found == nil:
+		return nil, nil
+	case !found.softError():
+		return found, nil
+	case statusCode >= 400:
+		// A failing status is a hard error, which the caller sees already
+		return nil, nil
+	}
+	return nil, found
+}
+
+// detectTitle matches the whole title, then each of its parts if parts is set.
+func detectTitle(title string, parts bool) *Detection {
+	candidates := []string{title}
+	if parts {
+		candidates = titleSeparatorRegex.Split(title, -1)
+	}
+	for _, part := range candidates {
+		part = strings.TrimSpace(part)
+		for _, t := range titleDetections {
+			if t.pattern.MatchString(part) {
+				return &Detection{Kind: t.kind, Signal: fmt.Sprintf("title %q", title)}
+			}
+		}
+	}
+	return nil
+}
+
+type pageScan struct {
+	title   string
+	textLen int
+	// markers are the lowercased ids, classes, URLs and inline scripts of the page.
+	markers string
+}
+
+func scanPage(doc *html.Node) pageScan {
+	var scan pageScan
+	var markers strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "id", "class", "src", "href", "action", "data-sitekey":
+					markers.WriteString(strings.ToLower(a.Val))
+					markers.WriteByte(' ')
+				}
+			}
+			switch n.Data {
+			case "title":
+				if scan.title == "" && n.FirstChild != nil {
+					scan.title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+				return
+			case "script":
+				if n.FirstChild != nil {
+					markers.WriteString(strings.ToLower(n.FirstChild.Data))
+					markers.WriteByte(' ')
+				}
+				return
+			case "style", "noscript", "template":
+				return
+			}
+		case html.TextNode:
+			scan.textLen += len(strings.TrimSpace(n.Data))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	if doc != nil {
+		walk(doc)
+	}
+	scan.markers = markers.String()
+	return scan
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package gophetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch"
+)
+
+const cloudflareChallenge = `<!DOCTYPE html><html lang="en-US"><head><title>Just a moment...</title></head><body>
+<div class="main-wrapper"><h1>example.com</h1><p>Verifying you are human. This may take a few seconds.</p></div>
+<script>(function(){window._cf_chl_opt={cvId: '3'};var a=document.createElement('script');
+a.src='/cdn-cgi/challenge-platform/h/g/orchestrate/chl_page/v1';document.head.appendChild(a);}());</script>
+</body></html>`
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name              string
+		header            http.Header
+		status            int
+		page              string
+		expectedBlocked   *gophetch.Detection
+		expectedSoftError *gophetch.Detection
+	}{
+		{
+			name:            "cloudflare challenge",
+			status:          http.StatusForbidden,
+			page:            cloudflareChallenge,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedChallenge, Signal: `marker "/cdn-cgi/challenge-platform/"`},
+		},
+		{
+			name:            "challenge header",
+			header:          http.Header{"Cf-Mitigated": {"challenge"}},
+			status:          http.StatusForbidden,
+			page:            `<html><head><title>Example</title></head></html>`,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedChallenge, Signal: "header cf-mitigated: challenge"},
+		},
+		{
+			name:            "captcha wall",
+			status:          http.StatusOK,
+			page:            `<html><body><form action="/verify"><div class="g-recaptcha" data-sitekey="abc"></div></form></body></html>`,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedCaptcha, Signal: `marker "g-recaptcha"`},
+		},
+		{
+			name:   "captcha in a comment form of a long article",
+			status: http.StatusOK,
+			page: `<html><head><title>How captchas work</title></head><body><article>` + strings.Repeat("Text. ", 300) +
+				`</article><form><div class="g-recaptcha"></div></form></body></html>`,
+		},
+		{
+			name:   "challenge scripts injected in a long article",
+			status: http.StatusOK,
+			page: `<html><head><title>Markets rally</title></head><body><article>` + strings.Repeat("Article text. ", 400) +
+				`</article><script src="/cdn-cgi/challenge-platform/scripts/jsd/main.js"></script>` +
+				`<script src="/_Incapsula_Resource?SWJIYLWA=719d34d31c8e3a6e6fffd425f7e032f3"></script></body></html>`,
+		},
+		{
+			name:            "access denied",
+			status:          http.StatusOK,
+			page:            `<html><head><title>Access Denied</title></head><body>You don't have permission to access this server.</body></html>`,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedAccessDenied, Signal: `title "Access Denied"`},
+		},
+		{
+			name:            "attention required",
+			status:          http.StatusOK,
+			page:            `<html><head><title>Attention Required! | Cloudflare</title></head></html>`,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedAccessDenied, Signal: `title "Attention Required! | Cloudflare"`},
+		},
+		{
+			name:            "rate limited",
+			status:          http.StatusTooManyRequests,
+			page:            `<html><body>Slow down</body></html>`,
+			expectedBlocked: &gophetch.Detection{Kind: gophetch.DetectedRateLimited, Signal: "status 429"},
+		},
+		{
+			name:              "consent interstitial",
+			status:            http.StatusOK,
+			page:              `<html><head><title>Before you continue to YouTube</title></head><body><form action="https://consent.youtube.com/save"></form></body></html>`,
+			expectedSoftError: &gophetch.Detection{Kind: gophetch.DetectedConsent, Signal: `title "Before you continue to YouTube"`},
+		},
+		{
+			name:              "consent manager",
+			status:            http.StatusOK,
+			page:              `<html><head><title>News</title></head><body><div id="onetrust-consent-sdk"></div></body></html>`,
+			expectedSoftError: &gophetch.Detection{Kind: gophetch.DetectedConsent, Signal: `marker "onetrust-consent-sdk"`},
+		},
+		{
+			name:              "not found served with 200",
+			status:            http.StatusOK,
+			page:              `<html><head><title>Page Not Found | Example News</title></head><body>` + strings.Repeat("Menu ", 300) + `</body></html>`,
+			expectedSoftError: &gophetch.Detection{Kind: gophetch.DetectedNotFound, Signal: `title "Page Not Found | Example News"`},
+		},
+		{
+			name:   "not found served with 404",
+			status: http.StatusNotFound,
+			page:   `<html><head><title>Page Not Found | Example News</title></head></html>`,
+		},
+		{
+			name:              "error page",
+			status:            http.StatusOK,
+			page:              `<html><head><title>Something went wrong</title></head></html>`,
+			expectedSoftError: &gophetch.Detection{Kind: gophetch.DetectedError, Signal: `title "Something went wrong"`},
+		},
+		{
+			name:   "article about missing pages",
+			status: http.StatusOK,
+			page:   `<html><head><title>Why page not found errors hurt your SEO</title></head></html>`,
+		},
+		{
+			name:   "articles titled like block pages",
+			status: http.StatusOK,
+			page: `<html><head><title>CAPTCHA - Wikipedia</title></head><body>` + strings.Repeat("Article text. ", 400) +
+				`</body></html>`,
+		},
+		{
+			name:   "articles titled like forbidden pages",
+			status: http.StatusOK,
+			page: `<html><head><title>Forbidden | Book review</title></head><body>` + strings.Repeat("Article text. ", 400) +
+				`</body></html>`,
+		},
+		{
+			name:   "articles titled like not found pages",
+			status: http.StatusOK,
+			page: `<html><head><title>Not Found: A memoir - Goodreads</title></head><body>` + strings.Repeat("Article text. ", 400) +
+				`</body></html>`,
+		},
+		{
+			name:   "articles titled like error pages",
+			status: http.StatusOK,
+			page: `<html><head><title>Error: The Movie (2024) - IMDb</title></head><body>` + strings.Repeat("Article text. ", 400) +
+				`</body></html>`,
+		},
+		{
+			name:              "whole title of a long page",
+			status:            http.StatusOK,
+			page:              `<html><head><title>404 Not Found</title></head><body>` + strings.Repeat("Menu ", 1000) + `</body></html>`,
+			expectedSoftError: &gophetch.Detection{Kind: gophetch.DetectedNotFound, Signal: `title "404 Not Found"`},
+		},
+		{
+			name:   "regular page",
+			status: http.StatusOK,
+			page:   `<html><head><title>Hello</title></head><body><p>Hello world</p></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocked, softError := gophetch.Detect(tt.header, tt.status, doc)
+			assert.Equal(t, tt.expectedBlocked, blocked)
+			assert.Equal(t, tt.expectedSoftError, softError)
+		})
+	}
+}
+
+func TestEscalateDetected(t *testing.T) {
+	newChain := func() (*stubFetcher, *stubFetcher) {
+		return &stubFetcher{name: "standard", html: cloudflareChallenge, status: http.StatusForbidden},
+			&stubFetcher{name: "rendering", html: fullPage}
+	}
+
+	t.Run("detected pages are reported", func(t *testing.T) {
+		blocked, _ := newChain()
+		g := gophetch.New(blocked)
+		result, err := g.FetchAndParseContext(context.Background(), "https://example.com/")
+		assert.NoError(t, err)
+		assert.Equal(t, &gophetch.Detection{Kind: gophetch.DetectedChallenge, Signal: `marker "/cdn-cgi/challenge-platform/"`}, result.Blocked)
+		assert.Nil(t, result.SoftError)
+	})
+
+	t.Run("detected pages are passed over", func(t *testing.T) {
+		blocked, rendering := newChain()
+		g := gophetch.New(blocked, rendering)
+		g.EscalateDetected = true
+		result, err := g.FetchAndParseContext(context.Background(), "https://example.com/")
+		assert.NoError(t, err)
+		assert.Equal(t, "rendering", result.FetcherName)
+		assert.Nil(t, result.Blocked)
+		assert.Equal(t, []gophetch.Escalation{{Fetcher: "standard", Reason: "blocked: challenge"}}, result.Escalations)
+		assert.Equal(t, int32(0), blocked.open)
+	})
+
+	t.Run("an error is returned when every fetcher is blocked", func(t *testing.T) {
+		blocked, _ := newChain()
+		g := gophetch.New(blocked)
+		g.EscalateDetected = true
+		_, err := g.FetchAndParseContext(context.Background(), "https://example.com/")
+		assert.True(t, errors.Is(err, gophetch.ErrBlocked))
+		var pageErr *gophetch.PageError
+		if assert.ErrorAs(t, err, &pageErr) {
+			assert.Equal(t, "standard", pageErr.Fetcher)
+			assert.Equal(t, gophetch.DetectedChallenge, pageErr.Detection.Kind)
+		}
+	})
+}
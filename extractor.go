@@ -1,85 +1,148 @@
 package gophetch
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/html"
 
+	"github.com/octetic/gophetch/helpers"
 	"github.com/octetic/gophetch/metadata"
 	"github.com/octetic/gophetch/rules"
 	"github.com/octetic/gophetch/sites"
 )
 
 // Extractor is the struct that encapsulates the rules used to extract metadata from HTML.
+//
+// An Extractor keeps no per-extraction state and is safe for concurrent use, as long as Rules is not modified while
+// it is in use. Use WithSite to get an Extractor with site-specific rules instead of modifying Rules, and LoadRules
+// or WatchRules to replace rules while it is in use.
 type Extractor struct {
-	Rules  map[string]rules.Rule
+	Rules map[string]rules.Rule
+	// Errors are the errors of the rules, accumulated over the calls to ExtractMetadata only.
+	//
+	// Deprecated: use ExtractMetadataContext, which returns the errors of each extraction, or Result.Errors.
 	Errors []error
+
+	// mu guards Rules against LoadRules and ApplySiteSpecificRules, which replace the map rather than modifying it,
+	// and Errors.
+	mu sync.RWMutex
+	// builtin are the default rules, which the loaded rules are applied on top of. For an Extractor not created by
+	// NewExtractor, they are the rules it had before the first LoadRules.
+	builtin map[string]rules.Rule
 }
 
 // NewExtractor creates a new Extractor struct with the default rules.
 func NewExtractor() *Extractor {
-	return &Extractor{
-		Rules: map[string]rules.Rule{
-			"author":      rules.NewAuthorRule(),
-			"canonical":   rules.NewCanonicalRule(),
-			"date":        rules.NewDateRule(),
-			"description": rules.NewDescriptionRule(),
-			"favicon":     rules.NewFaviconRule(),
-			"feed":        rules.NewFeedRule(),
-			"lang":        rules.NewLangRule(),
-			"lead_image":  rules.NewLeadImageRule(),
-			"publisher":   rules.NewPublisherRule(),
-			"readable":    rules.NewReadableRule(),
-			"site_name":   rules.NewSiteNameRule(),
-			"title":       rules.NewTitleRule(),
-		},
+	defaults := map[string]rules.Rule{
+		"author":        rules.NewAuthorRule(),
+		"canonical":     rules.NewCanonicalRule(),
+		"date":          rules.NewDateRule(),
+		"description":   rules.NewDescriptionRule(),
+		"favicon":       rules.NewFaviconRule(),
+		"feed":          rules.NewFeedRule(),
+		"lang":          rules.NewLangRule(),
+		"lead_image":    rules.NewLeadImageRule(),
+		"modified_date": rules.NewModifiedDateRule(),
+		"publisher":     rules.NewPublisherRule(),
+		"readable":      rules.NewReadableRule(),
+		"site_name":     rules.NewSiteNameRule(),
+		"title":         rules.NewTitleRule(),
+	}
+
+	// The defaults are kept aside, as Rules may be modified, or replaced by ApplySiteSpecificRules
+	builtin := make(map[string]rules.Rule, len(defaults))
+	for key, rule := range defaults {
+		builtin[key] = rule
 	}
+	return &Extractor{Rules: defaults, builtin: builtin}
 }
 
-// ExtractMetadata extracts metadata from the given HTML node. The url parameter is used to fix relative paths.
+// ExtractMetadata extracts metadata from the given HTML node. Relative URLs are resolved against the document's
+// <base href>, or the url parameter if there is none.
 func (e *Extractor) ExtractMetadata(node *html.Node, targetURL *url.URL) (metadata.Metadata, error) {
+	meta, ruleErrs, err := e.ExtractMetadataContext(context.Background(), node, targetURL)
+	if len(ruleErrs) > 0 {
+		e.mu.Lock()
+		e.Errors = append(e.Errors, ruleErrs...)
+		e.mu.Unlock()
+	}
+	return meta, err
+}
+
+// ExtractMetadataContext is like ExtractMetadata, but stops when the context is done. Rules that do I/O, such as the
+// favicon probe, receive the context as well. The errors returned by individual rules don't stop the extraction,
+// they are returned in the second value instead. A rule that simply finds no value is not an error.
+func (e *Extractor) ExtractMetadataContext(ctx context.Context, node *html.Node, targetURL *url.URL) (metadata.Metadata, []error, error) {
 	var meta metadata.Metadata
+	var ruleErrs []error
 
 	if node == nil {
-		return metadata.Metadata{}, fmt.Errorf("node is nil")
+		return metadata.Metadata{}, nil, fmt.Errorf("node is nil")
 	}
 
 	doc, err := e.renderHTML(node)
 	if err != nil {
-		return metadata.Metadata{}, err
+		return metadata.Metadata{}, nil, err
 	}
 	meta.HTML = doc
+	base := helpers.DocumentBase(node, targetURL)
+	defer rules.CacheDocument(node)()
 
-	for key, rule := range e.Rules {
-		result, err := e.ExtractRule(node, targetURL, rule)
+	for key, rule := range e.rules() {
+		if err := ctx.Err(); err != nil {
+			return meta, ruleErrs, err
+		}
+
+		result, err := e.ExtractRuleContext(ctx, node, targetURL, rule)
 		if err != nil {
-			e.handleError(err)
+			if !errors.Is(err, rules.ErrValueNotFound) {
+				ruleErrs = append(ruleErrs, fmt.Errorf("rule %s: %w", key, err))
+			}
 			continue
 		} else if !result.Found() {
 			continue
 		}
 
-		result.ApplyMetadata(key, targetURL, &meta)
-		if err != nil {
-			e.handleError(err)
+		result.ApplyMetadata(key, base, &meta)
+		if cr, ok := result.(rules.ConfidentResult); ok {
+			if meta.Confidence == nil {
+				meta.Confidence = make(map[string]float64)
+			}
+			meta.Confidence[key] = cr.Confidence()
 		}
 	}
 
-	return meta, nil
+	return meta, ruleErrs, nil
 }
 
 func (e *Extractor) ExtractRuleByKey(node *html.Node, targetURL *url.URL, key string) (rules.ExtractResult, error) {
-	rule, ok := e.Rules[key]
+	return e.ExtractRuleByKeyContext(context.Background(), node, targetURL, key)
+}
+
+// ExtractRuleByKeyContext is like ExtractRuleByKey, but passes the context to the rule.
+func (e *Extractor) ExtractRuleByKeyContext(ctx context.Context, node *html.Node, targetURL *url.URL, key string) (rules.ExtractResult, error) {
+	rule, ok := e.rules()[key]
 	if !ok {
 		return rules.NewNoResult(), fmt.Errorf("rule %s not found", key)
 	}
-	return e.ExtractRule(node, targetURL, rule)
+	return e.ExtractRuleContext(ctx, node, targetURL, rule)
 }
 
 func (e *Extractor) ExtractRule(node *html.Node, targetURL *url.URL, rule rules.Rule) (rules.ExtractResult, error) {
-	result, err := rule.Extract(node, targetURL)
+	return e.ExtractRuleContext(context.Background(), node, targetURL, rule)
+}
+
+// ExtractRuleContext is like ExtractRule, but passes the context to the rule.
+func (e *Extractor) ExtractRuleContext(ctx context.Context, node *html.Node, targetURL *url.URL, rule rules.Rule) (rules.ExtractResult, error) {
+	result, err := rules.ExtractContext(ctx, rule, node, targetURL)
 	if err != nil {
 		return rules.NewNoResult(), err
 	}
@@ -89,16 +152,140 @@ func (e *Extractor) ExtractRule(node *html.Node, targetURL *url.URL, rule rules.
 	return result, nil
 }
 
-// ApplySiteSpecificRules applies the custom rules for the given site.
-func (e *Extractor) ApplySiteSpecificRules(site sites.Site) {
-	for key, customRule := range site.Rules() {
+// WithSite returns a copy of the Extractor where the rules are overridden by the custom rules for the given site.
+// The receiver is not modified, so the overrides only apply to extractions made with the returned Extractor.
+func (e *Extractor) WithSite(site sites.Site) *Extractor {
+	siteRules := site.Rules()
+	current := e.rules()
+	merged := make(map[string]rules.Rule, len(current)+len(siteRules))
+	for key, rule := range current {
+		merged[key] = rule
+	}
+	for key, customRule := range siteRules {
 		// Replace the default rule with the custom one for this key
-		e.Rules[key] = customRule
+		merged[key] = customRule
+	}
+	return &Extractor{Rules: merged}
+}
+
+// ApplySiteSpecificRules overrides the rules of the Extractor with the custom rules for the given site. Extractions
+// in progress finish with the rules they started with.
+//
+// Deprecated: use WithSite, which leaves the Extractor untouched so that the overrides don't leak into the
+// extractions of other sites.
+func (e *Extractor) ApplySiteSpecificRules(site sites.Site) {
+	siteRules := site.Rules()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	merged := make(map[string]rules.Rule, len(e.Rules)+len(siteRules))
+	for key, rule := range e.Rules {
+		merged[key] = rule
+	}
+	for key, customRule := range siteRules {
+		merged[key] = customRule
+	}
+	e.Rules = merged
+}
+
+func (e *Extractor) rules() map[string]rules.Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Rules
+}
+
+// LoadRules loads the rules defined in the file, see rules.LoadRules, on top of the default rules of NewExtractor: the
+// rules of the fields the file defines are replaced, the others are kept, and any other change made to the rules,
+// such as by ApplySiteSpecificRules, is dropped. Loading the file again replaces the rules of the previous load, and
+// brings back the rules of the fields it doesn't define anymore. If the file is invalid, the rules are left
+// untouched. Extractions in progress finish with the rules they started with.
+func (e *Extractor) LoadRules(path string) error {
+	loaded, err := rules.LoadRules(path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.builtin == nil {
+		e.builtin = e.Rules
+	}
+	merged := make(map[string]rules.Rule, len(e.builtin)+len(loaded))
+	for key, rule := range e.builtin {
+		merged[key] = rule
+	}
+	for key, rule := range loaded {
+		merged[key] = rule
 	}
+	e.Rules = merged
+	return nil
 }
 
-func (e *Extractor) handleError(err error) {
-	e.Errors = append(e.Errors, err)
+// DefaultRulesWatchInterval is how often WatchRules checks the file for changes, unless told otherwise.
+const DefaultRulesWatchInterval = 2 * time.Second
+
+// WatchRules loads the rules defined in the file, see LoadRules, then loads them again whenever the file changes,
+// until the context is done. The file is checked every interval, DefaultRulesWatchInterval if zero, by its
+// modification time, size and content, as a quick edit may keep the first two. The error of the first load is
+// returned, the errors of the later ones are passed to onError, if not nil, and leave the rules in place.
+func (e *Extractor) WatchRules(ctx context.Context, path string, interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		interval = DefaultRulesWatchInterval
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// The sum is taken before loading, so that a change made meanwhile is seen at the next check
+	sum, err := fileSum(path)
+	if err != nil {
+		return err
+	}
+	if err := e.LoadRules(path); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := os.Stat(path)
+			var currentSum [sha256.Size]byte
+			if err == nil {
+				currentSum, err = fileSum(path)
+			}
+			if err != nil {
+				// The missing file is reported once, and loaded again when it is back
+				if stat != nil && onError != nil {
+					onError(err)
+				}
+				stat = nil
+				continue
+			}
+			if stat != nil && current.ModTime().Equal(stat.ModTime()) && current.Size() == stat.Size() && currentSum == sum {
+				continue
+			}
+			stat, sum = current, currentSum
+			if err := e.LoadRules(path); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// fileSum returns the SHA-256 sum of the content of the file.
+func fileSum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
 }
 
 func (e *Extractor) renderHTML(node *html.Node) (string, error) {
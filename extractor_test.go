@@ -1,9 +1,13 @@
 package gophetch_test
 
 import (
+	"context"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
@@ -41,6 +45,12 @@ func TestExtractorIntegration(t *testing.T) {
 				Title:       "OG Title",
 				Description: "OG Description",
 				Date:        "2022-10-11T15:04:05Z",
+				Confidence: map[string]float64{
+					"author":      0.6,
+					"title":       0.9,
+					"description": 0.9 * (0.5 + 0.5*14/30),
+					"date":        0.9,
+				},
 			},
 		},
 		// Add more test cases as needed
@@ -71,6 +81,9 @@ func TestExtractorIntegration(t *testing.T) {
 			assert.Equal(t, tC.expected.Title, result.Title, "They should be equal")
 			assert.Equal(t, tC.expected.Description, result.Description, "They should be equal")
 			assert.Equal(t, tC.expected.Date, result.Date, "They should be equal")
+			for key, confidence := range tC.expected.Confidence {
+				assert.InDelta(t, confidence, result.Confidence[key], 0.001, key)
+			}
 		})
 	}
 }
@@ -171,3 +184,133 @@ func TestExtractorBoundary(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractorLoadRules(t *testing.T) {
+	mockNode, err := html.Parse(strings.NewReader(`<html><head>
+		<meta property="og:title" content="OG Title">
+		<meta property="og:description" content="OG Description">
+		</head><body>
+		<h1 class="headline">Headline</h1>
+		<p class="byline">By Jane Doe · 4 min read</p>
+		</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com")
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ext := gophetch.NewExtractor()
+	write(`
+rules:
+  - field: title
+    strategies:
+      - extractor: css
+        selectors: [h1.headline]
+  - field: reading_time
+    strategies:
+      - extractor: regex
+        selectors: [.byline]
+        pattern: '(\d+) min read'
+`)
+	if !assert.NoError(t, ext.LoadRules(path)) {
+		return
+	}
+	meta, err := ext.ExtractMetadata(mockNode, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Headline", meta.Title)
+		assert.Equal(t, "OG Description", meta.Description)
+		assert.Equal(t, "4", meta.Dynamic["reading_time"])
+	}
+
+	// An invalid file leaves the rules untouched
+	write("rules:\n  - field: title\n    strategies:\n      - extractor: css\n        selectors: ['h1[']\n")
+	assert.ErrorContains(t, ext.LoadRules(path), `invalid selector "h1["`)
+	meta, err = ext.ExtractMetadata(mockNode, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Headline", meta.Title)
+	}
+
+	// The fields the file doesn't define anymore get their default rules back
+	write("rules:\n  - field: site_name\n    strategies:\n      - extractor: css\n        selectors: [h1]\n")
+	if !assert.NoError(t, ext.LoadRules(path)) {
+		return
+	}
+	meta, err = ext.ExtractMetadata(mockNode, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "OG Title", meta.Title)
+		assert.Equal(t, "Headline", meta.SiteName)
+		assert.NotContains(t, meta.Dynamic, "reading_time")
+	}
+
+	// The rules are loaded on top of the defaults, even after the site specific rules were applied
+	ext = gophetch.NewExtractor()
+	ext.ApplySiteSpecificRules(overrideSite{domain: "example.com"})
+	if !assert.NoError(t, ext.LoadRules(path)) {
+		return
+	}
+	meta, err = ext.ExtractMetadata(mockNode, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "OG Title", meta.Title)
+		assert.Equal(t, "Headline", meta.SiteName)
+	}
+}
+
+func TestExtractorWatchRules(t *testing.T) {
+	mockNode, err := html.Parse(strings.NewReader(`<meta property="og:title" content="OG Title"><h1>Headline</h1><h2>Subtitle</h2>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com")
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(selector string) {
+		data := "rules:\n  - field: title\n    strategies:\n      - extractor: css\n        selectors: ['" + selector + "']\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ext := gophetch.NewExtractor()
+	assert.Error(t, ext.WatchRules(ctx, path, 0, nil))
+
+	errs := make(chan error, 10)
+	write("h1")
+	if !assert.NoError(t, ext.WatchRules(ctx, path, 10*time.Millisecond, func(err error) { errs <- err })) {
+		return
+	}
+	title := func() any {
+		result, err := ext.ExtractRuleByKey(mockNode, targetURL, "title")
+		if err != nil {
+			return nil
+		}
+		return result.Value()
+	}
+	assert.Equal(t, "Headline", title())
+
+	// A change that keeps the size and the modification time is seen too
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("h2")
+	if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return title() == "Subtitle" }, time.Second, 10*time.Millisecond)
+
+	write("h2[")
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, `invalid selector "h2["`)
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+	assert.Equal(t, "Subtitle", title())
+}
@@ -0,0 +1,312 @@
+package fetchers
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// DefaultMaxBodySize is the default maximum number of bytes read from the network for a page. (20 MB)
+	DefaultMaxBodySize = 20 * 1024 * 1024
+	// DefaultMaxDecompressedSize is the default maximum number of bytes of a page once decompressed. (50 MB)
+	DefaultMaxDecompressedSize = 50 * 1024 * 1024
+)
+
+// acceptEncoding lists the content encodings decoded by LimitBody.
+const acceptEncoding = "gzip, deflate, br"
+
+var (
+	// ErrBodyTooLarge is returned, wrapped in a BodyTooLargeError, when a body exceeds the size set by BodyLimits.
+	ErrBodyTooLarge = errors.New("body too large")
+	// ErrReadTimeout is returned when reading a body takes longer than BodyLimits.ReadTimeout. It wraps
+	// os.ErrDeadlineExceeded, so it is reported as a timeout.
+	ErrReadTimeout = fmt.Errorf("body read timeout: %w", os.ErrDeadlineExceeded)
+)
+
+// BodyTooLargeError is returned when a body exceeds one of the sizes set by BodyLimits. It wraps ErrBodyTooLarge.
+type BodyTooLargeError struct {
+	// Limit is the size exceeded, in bytes.
+	Limit int64
+	// Decompressed is set if the limit is on the decoded body, rather than on the bytes read from the network.
+	Decompressed bool
+}
+
+func (e *BodyTooLargeError) Error() string {
+	if e.Decompressed {
+		return fmt.Sprintf("body exceeds max decompressed size of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("body exceeds max size of %d bytes", e.Limit)
+}
+
+func (e *BodyTooLargeError) Unwrap() error {
+	return ErrBodyTooLarge
+}
+
+// BodyLimits bounds how much of a page is read, and for how long. The zero value applies the default sizes and no
+// read timeout.
+type BodyLimits struct {
+	// MaxSize is the maximum number of bytes read from the network, before decompression. Default is
+	// DefaultMaxBodySize, a negative value disables the limit.
+	MaxSize int64
+	// MaxDecompressedSize is the maximum number of bytes of the body once decompressed, which stops compression
+	// bombs. Default is DefaultMaxDecompressedSize, a negative value disables the limit.
+	MaxDecompressedSize int64
+	// ReadTimeout is the limit for reading the whole body, starting when the response headers are received.
+	// Default is no timeout.
+	ReadTimeout time.Duration
+	// Truncate makes a body that hits a limit, including the read timeout, end there instead of failing with a
+	// BodyTooLargeError or ErrReadTimeout. The body is then reported as truncated, see FetchInfo.Truncated.
+	Truncate bool
+}
+
+func (l BodyLimits) withDefaults() BodyLimits {
+	if l.MaxSize == 0 {
+		l.MaxSize = DefaultMaxBodySize
+	}
+	if l.MaxDecompressedSize == 0 {
+		l.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	return l
+}
+
+type bodyLimitsKey struct{}
+
+// WithBodyLimits returns a copy of ctx that carries the limits for the bodies read by the fetchers that don't set
+// their own, such as StandardHTTPFetcher.
+func WithBodyLimits(ctx context.Context, limits BodyLimits) context.Context {
+	return context.WithValue(ctx, bodyLimitsKey{}, limits)
+}
+
+// BodyLimitsFromContext returns the limits carried by ctx, or the zero value if there are none.
+func BodyLimitsFromContext(ctx context.Context) BodyLimits {
+	limits, _ := ctx.Value(bodyLimitsKey{}).(BodyLimits)
+	return limits
+}
+
+// setAcceptEncoding asks for the content encodings LimitBody decodes. Setting the header makes http.Transport
+// leave the body compressed, so the decompressed size can be bounded.
+func setAcceptEncoding(req *http.Request) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+}
+
+// LimitBody replaces the body of the response with one that is decoded following its Content-Encoding, gzip,
+// deflate and br being supported, and read within the limits. Reading it fails with a BodyTooLargeError or
+// ErrReadTimeout when a limit is hit, unless limits.Truncate is set. The Content-Encoding and Content-Length
+// headers are removed once the body is decoded. Truncated bodies are reported in the FetchInfo carried by ctx.
+func LimitBody(ctx context.Context, resp *http.Response, limits BodyLimits) error {
+	var encodings []string
+	for _, value := range resp.Header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			switch encoding {
+			case "", "identity":
+			case "gzip", "x-gzip", "deflate", "br":
+				encodings = append(encodings, encoding)
+			default:
+				return fmt.Errorf("unsupported content encoding %q", encoding)
+			}
+		}
+	}
+
+	body := NewBodyReader(resp.Body, limits)
+	body.info = FetchInfoFromContext(ctx)
+	body.network = true
+	body.encodings = encodings
+	resp.Body = body
+	if len(encodings) > 0 {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return nil
+}
+
+// BodyReader reads a body within BodyLimits. Only the decompressed size and the read timeout apply to the bodies
+// created with NewBodyReader, as they are already decoded.
+type BodyReader struct {
+	raw       io.Reader
+	limits    BodyLimits
+	network   bool
+	encodings []string
+	info      *FetchInfo
+
+	decoded   io.Reader
+	wire      int64
+	wireErr   error
+	read      int64
+	err       error
+	truncated bool
+	timer     *time.Timer
+	timedOut  int32
+}
+
+// NewBodyReader returns a reader of r that applies the limits. If r is an io.Closer, it is closed when the read
+// timeout passes, so that a pending read is interrupted.
+func NewBodyReader(r io.Reader, limits BodyLimits) *BodyReader {
+	b := &BodyReader{raw: r, limits: limits.withDefaults()}
+	if b.limits.ReadTimeout > 0 {
+		b.timer = time.AfterFunc(b.limits.ReadTimeout, func() {
+			atomic.StoreInt32(&b.timedOut, 1)
+			if c, ok := r.(io.Closer); ok {
+				_ = c.Close()
+			}
+		})
+	}
+	return b
+}
+
+// Truncated reports whether the body was cut short by a limit, which only happens when BodyLimits.Truncate is set.
+func (b *BodyReader) Truncated() bool {
+	return b.truncated
+}
+
+func (b *BodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if atomic.LoadInt32(&b.timedOut) == 1 {
+		return 0, b.stop(ErrReadTimeout)
+	}
+	if b.decoded == nil {
+		decoded, err := b.decode()
+		if err != nil {
+			return 0, b.fail(err)
+		}
+		b.decoded = decoded
+	}
+
+	// One byte past the limit is read, to tell a body that ends at the limit from one that exceeds it
+	limit := b.limits.MaxDecompressedSize
+	if limit > 0 && int64(len(p)) > limit-b.read+1 {
+		p = p[:limit-b.read+1]
+	}
+	n, err := b.decoded.Read(p)
+	if limit > 0 && b.read+int64(n) > limit {
+		n = int(limit - b.read)
+		b.read = limit
+		return n, b.stop(&BodyTooLargeError{Limit: limit, Decompressed: true})
+	}
+	b.read += int64(n)
+	if err != nil {
+		err = b.fail(err)
+	}
+	return n, err
+}
+
+// fail turns the error of a read into the limit that caused it, if any: a decoder reading a body cut short by the
+// size limit or the read timeout returns errors of its own.
+func (b *BodyReader) fail(err error) error {
+	switch {
+	case b.wireErr != nil:
+		return b.stop(b.wireErr)
+	case atomic.LoadInt32(&b.timedOut) == 1:
+		return b.stop(ErrReadTimeout)
+	case err == io.EOF:
+		return err
+	}
+	b.err = err
+	return err
+}
+
+// stop ends the body because of a limit, with the limit's error, or with io.EOF if truncating.
+func (b *BodyReader) stop(err error) error {
+	if b.limits.Truncate {
+		b.truncated = true
+		if b.info != nil {
+			b.info.Truncated = true
+		}
+		err = io.EOF
+	}
+	b.err = err
+	return err
+}
+
+// decode returns the decoded body, undoing the content encodings in the reverse order they were applied.
+func (b *BodyReader) decode() (io.Reader, error) {
+	var r io.Reader = wireReader{b}
+	for i := len(b.encodings) - 1; i >= 0; i-- {
+		var err error
+		switch b.encodings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = newDeflateReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// newDeflateReader reads a deflate body. The deflate encoding is a zlib stream, but some servers send a raw deflate
+// stream instead.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// Close releases the body, and closes it if it is an io.Closer.
+func (b *BodyReader) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if c, ok := b.raw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// wireReader reads the body as it comes from the network, up to BodyLimits.MaxSize. Past the limit, it ends the
+// stream and records the error for BodyReader.fail, as decoders don't always pass the errors of their reader along.
+type wireReader struct {
+	b *BodyReader
+}
+
+func (w wireReader) Read(p []byte) (int, error) {
+	b := w.b
+	if b.wireErr != nil {
+		return 0, io.EOF
+	}
+	limit := b.limits.MaxSize
+	if !b.network {
+		limit = 0
+	}
+	if limit > 0 && int64(len(p)) > limit-b.wire+1 {
+		p = p[:limit-b.wire+1]
+	}
+	n, err := b.raw.Read(p)
+	if limit > 0 && b.wire+int64(n) > limit {
+		n = int(limit - b.wire)
+		b.wire = limit
+		b.wireErr = &BodyTooLargeError{Limit: limit}
+		return n, io.EOF
+	}
+	b.wire += int64(n)
+	return n, err
+}
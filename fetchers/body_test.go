@@ -0,0 +1,195 @@
+package fetchers_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return data
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStandardHTTPFetcherLimits(t *testing.T) {
+	page := []byte("<html><head><title>Compressed</title></head><body>" + strings.Repeat("<p>Hello</p>", 100) + "</body></html>")
+	// A gzip bomb: a few kilobytes on the wire that decompress to 10MB
+	bomb := make([]byte, 10*1024*1024)
+
+	tests := []struct {
+		name             string
+		encoding         string
+		body             []byte
+		delay            time.Duration
+		limits           fetchers.BodyLimits
+		expectedBody     []byte
+		expectedError    error
+		expectedTooLarge *fetchers.BodyTooLargeError
+		expectedFetchErr string
+	}{
+		{name: "identity", body: page, expectedBody: page},
+		{name: "gzip", encoding: "gzip", body: page, expectedBody: page},
+		{name: "deflate", encoding: "deflate", body: page, expectedBody: page},
+		{name: "raw deflate", encoding: "raw-deflate", body: page, expectedBody: page},
+		{name: "brotli", encoding: "br", body: page, expectedBody: page},
+		{
+			name:             "body too large",
+			body:             page,
+			limits:           fetchers.BodyLimits{MaxSize: 100},
+			expectedTooLarge: &fetchers.BodyTooLargeError{Limit: 100},
+		},
+		{
+			name:         "body at the limit",
+			body:         page,
+			limits:       fetchers.BodyLimits{MaxSize: int64(len(page))},
+			expectedBody: page,
+		},
+		{
+			name:             "compressed body too large",
+			encoding:         "gzip",
+			body:             page,
+			limits:           fetchers.BodyLimits{MaxSize: 30},
+			expectedTooLarge: &fetchers.BodyTooLargeError{Limit: 30},
+		},
+		{
+			name:             "gzip bomb",
+			encoding:         "gzip",
+			body:             bomb,
+			limits:           fetchers.BodyLimits{MaxDecompressedSize: 1024 * 1024},
+			expectedTooLarge: &fetchers.BodyTooLargeError{Limit: 1024 * 1024, Decompressed: true},
+		},
+		{
+			name:         "truncated",
+			encoding:     "br",
+			body:         page,
+			limits:       fetchers.BodyLimits{MaxDecompressedSize: 50, Truncate: true},
+			expectedBody: page[:50],
+		},
+		{
+			name:          "read timeout",
+			body:          page,
+			delay:         time.Second,
+			limits:        fetchers.BodyLimits{ReadTimeout: 100 * time.Millisecond},
+			expectedBody:  page[:10],
+			expectedError: fetchers.ErrReadTimeout,
+		},
+		{
+			name:         "truncated on read timeout",
+			body:         page,
+			delay:        time.Second,
+			limits:       fetchers.BodyLimits{ReadTimeout: 100 * time.Millisecond, Truncate: true},
+			expectedBody: page[:10],
+		},
+		{
+			name:             "unsupported encoding",
+			encoding:         "zstd",
+			body:             page,
+			expectedFetchErr: `unsupported content encoding "zstd"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "gzip, deflate, br", r.Header.Get("Accept-Encoding"))
+				w.Header().Set("Content-Type", "text/html")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", strings.TrimPrefix(tt.encoding, "raw-"))
+				}
+				body := compress(t, tt.encoding, tt.body)
+				if tt.delay > 0 {
+					// The start of the page, then nothing until the client gives up
+					_, _ = w.Write(body[:10])
+					w.(http.Flusher).Flush()
+					select {
+					case <-time.After(tt.delay):
+					case <-r.Context().Done():
+						return
+					}
+				}
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			info := &fetchers.FetchInfo{}
+			ctx := fetchers.WithFetchInfo(context.Background(), info)
+			fetcher := &fetchers.StandardHTTPFetcher{Limits: &tt.limits}
+			resp, body, err := fetcher.FetchHTMLContext(ctx, server.URL)
+			if tt.expectedFetchErr != "" {
+				assert.EqualError(t, err, tt.expectedFetchErr)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = body.Close() }()
+			assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+			data, err := io.ReadAll(body)
+			switch {
+			case tt.expectedTooLarge != nil:
+				var tooLarge *fetchers.BodyTooLargeError
+				if assert.True(t, errors.As(err, &tooLarge), "error: %v", err) {
+					assert.Equal(t, tt.expectedTooLarge, tooLarge)
+				}
+				assert.ErrorIs(t, err, fetchers.ErrBodyTooLarge)
+			case tt.expectedError != nil:
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Equal(t, tt.expectedBody, data)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedBody, data)
+				assert.Equal(t, tt.limits.Truncate, info.Truncated)
+			}
+		})
+	}
+}
+
+// Fetchers without limits of their own use the ones carried by the context
+func TestBodyLimitsFromContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><title>Too long</title></html>"))
+	}))
+	defer server.Close()
+
+	ctx := fetchers.WithBodyLimits(context.Background(), fetchers.BodyLimits{MaxSize: 10})
+	_, body, err := (&fetchers.StandardHTTPFetcher{}).FetchHTMLContext(ctx, server.URL)
+	if assert.NoError(t, err) {
+		_, err = io.ReadAll(body)
+		_ = body.Close()
+		assert.EqualError(t, err, "body exceeds max size of 10 bytes")
+	}
+}
@@ -2,19 +2,38 @@ package fetchers
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/media"
 	"github.com/octetic/gophetch/metadata"
 )
 
 const browserlessEndpoint = "https://chrome.browserless.io"
 
+// ScreenshotCapturer takes screenshots of pages. BrowserlessFetcher implements it.
+type ScreenshotCapturer interface {
+	CaptureScreenshot(ctx context.Context, url string, opts BrowserlessScreenshotOptions) (*media.Media, error)
+}
+
+// BrowserlessFetcher fetches pages rendered by browserless, and captures screenshots and PDFs of them. It does not
+// return metadata.
 type BrowserlessFetcher struct {
 	APIToken    string
 	GotoOptions BrowserlessGoToOptions
+	// Endpoint is the base URL of the browserless API, such as a self-hosted instance at "http://localhost:3000".
+	// Default is "https://chrome.browserless.io".
+	Endpoint string
+	// Client is the HTTP client used for requests. If nil, the client carried by the request's context is used,
+	// falling back to http.DefaultClient.
+	Client *http.Client
 }
 
 type BrowserlessMargin struct {
@@ -60,17 +79,35 @@ type BrowserlessClip struct {
 }
 
 type BrowserlessScreenshotOptions struct {
+	// Clip is the area of the page to capture. If zero, the viewport, or the full page, is captured.
 	Clip           BrowserlessClip `json:"clip,omitempty"`
 	FullPage       bool            `json:"fullPage,omitempty"`
 	OmitBackground bool            `json:"omitBackground,omitempty"`
 	Quality        int             `json:"quality,omitempty"`
-	Type           string          `json:"type,omitempty"`
-	Encoding       string          `json:"encoding,omitempty"`
+	// Type is the image format, "png" or "jpeg". Default is "png".
+	Type string `json:"type,omitempty"`
+	// Encoding is "binary" or "base64". Either way, CaptureScreenshot returns the decoded image.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// MarshalJSON leaves out a zero Clip, which omitempty doesn't do for a struct, as browserless would capture an
+// empty area.
+func (o BrowserlessScreenshotOptions) MarshalJSON() ([]byte, error) {
+	type options BrowserlessScreenshotOptions
+	var clip *BrowserlessClip
+	if o.Clip != (BrowserlessClip{}) {
+		clip = &o.Clip
+	}
+	return json.Marshal(struct {
+		options
+		Clip *BrowserlessClip `json:"clip,omitempty"`
+	}{options: options(o), Clip: clip})
 }
 
 type ScreenshotRequest struct {
 	URL  string                       `json:"url,omitempty"`
 	Opts BrowserlessScreenshotOptions `json:"options,omitempty"`
+	GoTo BrowserlessGoToOptions       `json:"gotoOptions,omitempty"`
 }
 
 type ContentRequest struct {
@@ -78,47 +115,108 @@ type ContentRequest struct {
 	GoTo BrowserlessGoToOptions `json:"gotoOptions,omitempty"`
 }
 
-//func (c *Client) GetScreenshotBytes(targetURL string, options ScreenshotOptions) ([]byte, error) {
-//	request := &ScreenshotRequest{
-//		URL:  targetURL,
-//		Opts: options,
-//	}
-//	return c.makeBrowserlessRequest("/screenshot", request)
-//}
-//
-//func (c *Client) GetPdfBytes(targetURL string, options PdfOptions, gotoOptions GoToOptions) ([]byte, error) {
-//	request := &PdfRequest{
-//		URL:  targetURL,
-//		Opts: options,
-//		GoTo: gotoOptions,
-//	}
-//	return c.makeBrowserlessRequest("/pdf", request)
-//}
-
 func (b *BrowserlessFetcher) Name() string {
 	return "browserless"
 }
 
 func (b *BrowserlessFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadCloser, error) {
+	return b.FetchHTMLContext(context.Background(), targetURL)
+}
+
+func (b *BrowserlessFetcher) FetchHTMLContext(ctx context.Context, targetURL string) (*http.Response, io.ReadCloser, error) {
 	request := &ContentRequest{
 		URL:  targetURL,
 		GoTo: b.GotoOptions,
 	}
-	resp, body, err := b.makeBrowserlessRequest("/content", request)
+	resp, body, err := b.makeBrowserlessRequest(ctx, "/content", request)
 	if err != nil {
 		return resp, nil, err
 	}
 	return resp, body, nil
 }
 
-func (b *BrowserlessFetcher) makeBrowserlessRequest(path string, request interface{}) (*http.Response, io.ReadCloser, error) {
+// CaptureScreenshot takes a screenshot of the page at the given URL, once loaded according to GotoOptions. It returns
+// an error if browserless fails, or if the image can't be decoded.
+func (b *BrowserlessFetcher) CaptureScreenshot(ctx context.Context, targetURL string, opts BrowserlessScreenshotOptions) (*media.Media, error) {
+	request := &ScreenshotRequest{
+		URL:  targetURL,
+		Opts: opts,
+		GoTo: b.GotoOptions,
+	}
+	data, err := b.capture(ctx, "/screenshot", request)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Encoding == "base64" {
+		if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err != nil {
+			return nil, fmt.Errorf("browserless screenshot: %w", err)
+		}
+	}
+
+	m, err := media.NewImageFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("browserless screenshot: %w", err)
+	}
+	m.URL = targetURL
+	return m, nil
+}
+
+// CapturePDF prints the page at the given URL to a PDF document, once loaded according to GotoOptions. It returns an
+// error if browserless fails, or if it doesn't return a PDF document.
+func (b *BrowserlessFetcher) CapturePDF(ctx context.Context, targetURL string, opts BrowserlessPdfOptions) (*media.Media, error) {
+	request := &BrowserlessPdfRequest{
+		URL:  targetURL,
+		Opts: opts,
+		GoTo: b.GotoOptions,
+	}
+	data, err := b.capture(ctx, "/pdf", request)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := media.NewPDFFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("browserless pdf: %w", err)
+	}
+	m.URL = targetURL
+	return m, nil
+}
+
+// capture makes a browserless request and returns the response body, failing if the status isn't 200 OK.
+func (b *BrowserlessFetcher) capture(ctx context.Context, path string, request interface{}) ([]byte, error) {
+	resp, body, err := b.makeBrowserlessRequest(ctx, path, request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(body, 512))
+		return nil, fmt.Errorf("browserless %s: unexpected status %s: %s", path, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, media.DefaultMaxMediaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > media.DefaultMaxMediaSize {
+		return nil, fmt.Errorf("browserless %s: response exceeds max size of %d bytes", path, media.DefaultMaxMediaSize)
+	}
+	return data, nil
+}
+
+func (b *BrowserlessFetcher) makeBrowserlessRequest(ctx context.Context, path string, request interface{}) (*http.Response, io.ReadCloser, error) {
 	jsonData, err := json.Marshal(request)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Create the URL with the token in the query parameters
-	apiPath := browserlessEndpoint + path
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = browserlessEndpoint
+	}
+	apiPath := strings.TrimSuffix(endpoint, "/") + path
 	u, err := url.Parse(apiPath)
 	if err != nil {
 		return nil, nil, err
@@ -128,7 +226,7 @@ func (b *BrowserlessFetcher) makeBrowserlessRequest(path string, request interfa
 	u.RawQuery = q.Encode()
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -137,9 +235,7 @@ func (b *BrowserlessFetcher) makeBrowserlessRequest(path string, request interfa
 	req.Header.Add("Cache-Control", "no-cache")
 	req.Header.Add("Content-Type", "application/json")
 
-	// Create a new HTTP client and make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Resolve(httpclient.WithoutSession(ctx), b.Client).Do(req)
 	if err != nil {
 		return resp, nil, err
 	}
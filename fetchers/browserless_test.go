@@ -0,0 +1,195 @@
+package fetchers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/media"
+)
+
+const testCapturePDF = "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+	"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+	"3 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n"
+
+func testPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBrowserlessCapture(t *testing.T) {
+	screenshot := testPNG(t, 64, 48)
+
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.URL.Query().Get("token"))
+		var request map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+
+		options, _ := request["options"].(map[string]interface{})
+		switch {
+		case request["url"] == "https://example.com/broken":
+			http.Error(w, "navigation failed", http.StatusInternalServerError)
+		case r.URL.Path == "/screenshot" && options["encoding"] == "base64":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(screenshot)))
+		case r.URL.Path == "/screenshot":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(screenshot)
+		case r.URL.Path == "/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte(testCapturePDF))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := &fetchers.BrowserlessFetcher{
+		APIToken:    "secret",
+		Endpoint:    server.URL + "/",
+		GotoOptions: fetchers.BrowserlessGoToOptions{WaitUntil: "networkidle2"},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name              string
+		capture           func() (*media.Media, error)
+		expectedError     string
+		expectedType      media.Type
+		expectedExtension string
+		expectedRequest   map[string]interface{}
+	}{
+		{
+			name: "screenshot",
+			capture: func() (*media.Media, error) {
+				return fetcher.CaptureScreenshot(ctx, "https://example.com/", fetchers.BrowserlessScreenshotOptions{Type: "png"})
+			},
+			expectedType:      media.ImageType,
+			expectedExtension: ".png",
+			expectedRequest: map[string]interface{}{
+				"url":         "https://example.com/",
+				"options":     map[string]interface{}{"type": "png"},
+				"gotoOptions": map[string]interface{}{"waitUntil": "networkidle2"},
+			},
+		},
+		{
+			name: "base64 screenshot",
+			capture: func() (*media.Media, error) {
+				opts := fetchers.BrowserlessScreenshotOptions{
+					Encoding: "base64",
+					Clip:     fetchers.BrowserlessClip{Width: 64, Height: 48},
+				}
+				return fetcher.CaptureScreenshot(ctx, "https://example.com/", opts)
+			},
+			expectedType:      media.ImageType,
+			expectedExtension: ".png",
+			expectedRequest: map[string]interface{}{
+				"url": "https://example.com/",
+				"options": map[string]interface{}{
+					"encoding": "base64",
+					"clip":     map[string]interface{}{"width": 64.0, "height": 48.0, "x": 0.0, "y": 0.0},
+				},
+				"gotoOptions": map[string]interface{}{"waitUntil": "networkidle2"},
+			},
+		},
+		{
+			name: "pdf",
+			capture: func() (*media.Media, error) {
+				return fetcher.CapturePDF(ctx, "https://example.com/", fetchers.BrowserlessPdfOptions{Format: "A4"})
+			},
+			expectedType:      media.DocumentType,
+			expectedExtension: ".pdf",
+			expectedRequest: map[string]interface{}{
+				"url":         "https://example.com/",
+				"options":     map[string]interface{}{"format": "A4", "margin": map[string]interface{}{}},
+				"gotoOptions": map[string]interface{}{"waitUntil": "networkidle2"},
+			},
+		},
+		{
+			name: "error",
+			capture: func() (*media.Media, error) {
+				return fetcher.CaptureScreenshot(ctx, "https://example.com/broken", fetchers.BrowserlessScreenshotOptions{})
+			},
+			expectedError: "browserless /screenshot: unexpected status 500 Internal Server Error: navigation failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			m, err := tt.capture()
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expectedType, m.MediaType)
+			assert.Equal(t, tt.expectedExtension, m.Extension)
+			assert.Equal(t, "https://example.com/", m.URL)
+			assert.Equal(t, []map[string]interface{}{tt.expectedRequest}, requests)
+			if tt.expectedType == media.ImageType {
+				assert.Equal(t, 64, m.Width)
+				assert.Equal(t, 48, m.Height)
+				assert.Equal(t, screenshot, m.Bytes)
+			}
+		})
+	}
+}
+
+// The content endpoint goes through the configured endpoint too
+func TestBrowserlessEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/content", r.URL.Path)
+		_, _ = w.Write([]byte("<html><title>Rendered</title></html>"))
+	}))
+	defer server.Close()
+
+	fetcher := &fetchers.BrowserlessFetcher{Endpoint: server.URL}
+	_, body, err := fetcher.FetchHTML("https://example.com/")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(body)
+		_ = body.Close()
+		assert.Equal(t, "<html><title>Rendered</title></html>", string(data))
+	}
+}
+
+// The API gets none of the session's cookies and headers, even if they were set for its domain
+func TestBrowserlessSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Cookie"))
+		assert.Empty(t, r.Header.Get("X-Api-Key"))
+		http.SetCookie(w, &http.Cookie{Name: "api", Value: "1"})
+		_, _ = w.Write([]byte("<html><title>Rendered</title></html>"))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	session := httpclient.NewSession("example")
+	session.SetHeader(serverURL.Hostname(), "X-Api-Key", "secret")
+	_ = session.SetCookies(server.URL, &http.Cookie{Name: "consent", Value: "granted"})
+
+	fetcher := &fetchers.BrowserlessFetcher{Endpoint: server.URL}
+	_, body, err := fetcher.FetchHTMLContext(httpclient.WithSession(context.Background(), session), "https://example.com/")
+	if assert.NoError(t, err) {
+		_ = body.Close()
+	}
+	assert.Len(t, session.Jar.Cookies(serverURL), 1)
+}
@@ -0,0 +1,412 @@
+package fetchers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/media"
+	"github.com/octetic/gophetch/metadata"
+)
+
+// CacheStatus reports how a CachingFetcher answered a request. It is empty for fetches that didn't go through a
+// CachingFetcher.
+type CacheStatus string
+
+const (
+	// CacheMiss means the page was fetched, because it wasn't in the cache or couldn't be revalidated.
+	CacheMiss CacheStatus = "miss"
+	// CacheHit means the page was served from the cache without a request.
+	CacheHit CacheStatus = "hit"
+	// CacheRevalidated means the page was served from the cache after the server confirmed it hadn't changed.
+	CacheRevalidated CacheStatus = "revalidated"
+)
+
+// CachedResponse is a response stored by a CachingFetcher.
+type CachedResponse struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+	// FinalURL is the URL the response came from, and Redirects the redirects followed to get there.
+	FinalURL  string     `json:"final_url,omitempty"`
+	Redirects []Redirect `json:"redirects,omitempty"`
+	// Expires is when the response goes stale and has to be revalidated. A zero value means it is stale right away.
+	Expires time.Time `json:"expires"`
+	// Vary holds the values that the request had for the headers named by the Vary header of the response. The
+	// response only answers requests with the same values.
+	Vary http.Header `json:"vary,omitempty"`
+}
+
+// CacheStore stores the responses of a CachingFetcher. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the response stored under the given key, or false if there is none.
+	Get(key string) (*CachedResponse, bool, error)
+	// Set stores a response under the given key, replacing any previous one.
+	Set(key string, resp *CachedResponse) error
+	// Delete removes the response stored under the given key, if any.
+	Delete(key string) error
+}
+
+// CachingFetcher is an HTMLFetcher that caches the pages fetched by another fetcher, following their Cache-Control
+// and Expires headers. Stale pages are revalidated with If-None-Match and If-Modified-Since, and a 304 Not Modified
+// response is turned back into the cached page. The conditional headers are passed to the wrapped fetcher on the
+// context, see httpclient.WithHeader, so only fetchers that send those headers can revalidate.
+//
+// The cache is shared by every request, so responses marked private or varying on every header are not stored, and
+// requests that carry credentials, a Session or a Cookie or Authorization header, bypass the cache altogether.
+// Responses that vary on some headers only answer the requests that have the same values for them on the context.
+//
+// How each request was answered is recorded in the FetchInfo carried by the context. Metadata provided by the
+// wrapped fetcher is not cached, and neither are pages cut short by the BodyLimits, see FetchInfo.Truncated.
+type CachingFetcher struct {
+	// Fetcher is the fetcher used for requests that can't be answered from the cache.
+	Fetcher HTMLFetcher
+	// Store is where the responses are kept.
+	Store CacheStore
+	// DefaultTTL is how long a response without Cache-Control or Expires headers stays fresh. Default is to
+	// revalidate it every time.
+	DefaultTTL time.Duration
+}
+
+// NewCachingFetcher creates a new CachingFetcher that caches the pages fetched by the given fetcher in the given
+// store.
+func NewCachingFetcher(fetcher HTMLFetcher, store CacheStore) *CachingFetcher {
+	return &CachingFetcher{Fetcher: fetcher, Store: store}
+}
+
+func (c *CachingFetcher) Name() string {
+	return c.Fetcher.Name()
+}
+
+func (c *CachingFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return c.FetchHTMLContext(context.Background(), url)
+}
+
+func (c *CachingFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	if hasCredentials(ctx) {
+		// The page may be personalized, and must neither be served to nor be served from other requests
+		setCacheStatus(ctx, CacheMiss)
+		return FetchHTMLContext(ctx, c.Fetcher, url)
+	}
+
+	now := time.Now()
+	cached, found, err := c.Store.Get(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading cache: %w", err)
+	}
+	requestHeader := httpclient.HeaderFromContext(ctx)
+	if found && !cached.matches(requestHeader) {
+		// Another variant of the page is cached, which this request would replace
+		found = false
+	}
+
+	if found && now.Before(cached.Expires) {
+		setCacheStatus(ctx, CacheHit)
+		return cached.response(ctx)
+	}
+
+	// Whether the body was cut short by the BodyLimits is only known from the FetchInfo, once it is read
+	info := FetchInfoFromContext(ctx)
+	fetchCtx := ctx
+	if info == nil {
+		info = &FetchInfo{}
+		fetchCtx = WithFetchInfo(ctx, info)
+	}
+	info.Truncated = false
+	if found {
+		if conditional := cached.conditionalHeader(); len(conditional) > 0 {
+			fetchCtx = httpclient.WithHeader(fetchCtx, conditional)
+		}
+	}
+
+	resp, body, err := FetchHTMLContext(fetchCtx, c.Fetcher, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if found && resp.StatusCode == http.StatusNotModified {
+		closeBody(body)
+		cached.refresh(resp.Header, now, c.DefaultTTL)
+		if err := c.Store.Set(url, cached); err != nil {
+			return nil, nil, fmt.Errorf("writing cache: %w", err)
+		}
+		setCacheStatus(ctx, CacheRevalidated)
+		return cached.response(ctx)
+	}
+
+	setCacheStatus(ctx, CacheMiss)
+	cache := media.ParseCacheHeader(resp.Header)
+	vary := varyNames(resp.Header)
+	if resp.StatusCode != http.StatusOK || cache.NoStore || cache.Private || vary["*"] {
+		if found {
+			_ = c.Store.Delete(url)
+		}
+		return resp, body, nil
+	}
+
+	data, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if info.Truncated {
+		// Only part of the page was read, which later requests would take for the whole page
+		return resp, resp.Body, nil
+	}
+
+	entry := &CachedResponse{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       data,
+		StoredAt:   now,
+		FinalURL:   finalURL(resp),
+		Redirects:  RedirectChain(resp),
+	}
+	for name := range vary {
+		if entry.Vary == nil {
+			entry.Vary = make(http.Header)
+		}
+		entry.Vary[name] = append([]string{}, requestHeader.Values(name)...)
+	}
+	entry.Expires = expiresAt(entry.Header, now, c.DefaultTTL)
+	if err := c.Store.Set(url, entry); err != nil {
+		return nil, nil, fmt.Errorf("writing cache: %w", err)
+	}
+	return resp, resp.Body, nil
+}
+
+func (c *CachingFetcher) HasMetadata() bool {
+	return c.Fetcher.HasMetadata()
+}
+
+func (c *CachingFetcher) Metadata() metadata.Metadata {
+	return c.Fetcher.Metadata()
+}
+
+// response builds a new http.Response from the cached one, and records where it came from in the FetchInfo carried
+// by ctx.
+func (r *CachedResponse) response(ctx context.Context) (*http.Response, io.ReadCloser, error) {
+	if r.FinalURL != "" {
+		setRedirects(ctx, r.FinalURL, r.Redirects)
+	}
+	body := io.NopCloser(bytes.NewReader(r.Body))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          body,
+		ContentLength: int64(len(r.Body)),
+	}, body, nil
+}
+
+// matches reports whether the response answers a request with the given headers, which have the same values as the
+// request the response was stored for, for the headers it varies on.
+func (r *CachedResponse) matches(header http.Header) bool {
+	for name := range varyNames(r.Header) {
+		if strings.Join(header.Values(name), ",") != strings.Join(r.Vary.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// varyNames returns the canonical names of the headers listed by the Vary header, or "*".
+func varyNames(header http.Header) map[string]bool {
+	names := make(map[string]bool)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+	return names
+}
+
+// hasCredentials reports whether the requests made with ctx carry credentials: a Session, a client with a cookie
+// jar, or a Cookie or Authorization header.
+func hasCredentials(ctx context.Context) bool {
+	if httpclient.SessionFromContext(ctx) != nil {
+		return true
+	}
+	if client := httpclient.FromContext(ctx); client != nil && client.Jar != nil {
+		return true
+	}
+	header := httpclient.HeaderFromContext(ctx)
+	return header.Get("Cookie") != "" || header.Get("Authorization") != ""
+}
+
+// conditionalHeader returns the headers that ask the server to only send the page if it has changed.
+func (r *CachedResponse) conditionalHeader() http.Header {
+	header := make(http.Header)
+	if etag := r.Header.Get("ETag"); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified := r.Header.Get("Last-Modified"); lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	return header
+}
+
+// refresh updates the cached response with the headers of a 304 Not Modified response, as the server may have
+// sent new validators or caching directives.
+func (r *CachedResponse) refresh(header http.Header, now time.Time, defaultTTL time.Duration) {
+	for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date"} {
+		if values, ok := header[name]; ok {
+			r.Header[name] = values
+		}
+	}
+	r.StoredAt = now
+	r.Expires = expiresAt(r.Header, now, defaultTTL)
+}
+
+// expiresAt returns when a response with the given headers goes stale.
+func expiresAt(header http.Header, now time.Time, defaultTTL time.Duration) time.Time {
+	cache := media.ParseCacheHeader(header)
+	switch {
+	case cache.NoCache || cache.NoStore:
+		return time.Time{}
+	case cache.MaxAge >= 0:
+		return now.Add(time.Duration(cache.MaxAge) * time.Second)
+	case !cache.Expires.IsZero():
+		return cache.Expires
+	case cache.Available || defaultTTL <= 0:
+		return time.Time{}
+	default:
+		return now.Add(defaultTTL)
+	}
+}
+
+func setCacheStatus(ctx context.Context, status CacheStatus) {
+	if info := FetchInfoFromContext(ctx); info != nil {
+		info.CacheStatus = status
+	}
+}
+
+// MemoryCacheStore is a CacheStore that keeps the responses in memory.
+type MemoryCacheStore struct {
+	mu      sync.RWMutex
+	entries map[string]*CachedResponse
+}
+
+// NewMemoryCacheStore creates a new, empty MemoryCacheStore.
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: make(map[string]*CachedResponse)}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return entry.clone(), true, nil
+}
+
+func (s *MemoryCacheStore) Set(key string, resp *CachedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = resp.clone()
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// clone returns a copy of the response, so callers of a store can't modify the stored one. The body is never
+// modified, so it is shared.
+func (r *CachedResponse) clone() *CachedResponse {
+	c := *r
+	c.Header = r.Header.Clone()
+	return &c
+}
+
+// DiskCacheStore is a CacheStore that keeps every response in its own JSON file in a directory.
+type DiskCacheStore struct {
+	// Dir is the directory the responses are written to. It is created when the first response is stored.
+	Dir string
+}
+
+// NewDiskCacheStore creates a new DiskCacheStore that writes to the given directory.
+func NewDiskCacheStore(dir string) *DiskCacheStore {
+	return &DiskCacheStore{Dir: dir}
+}
+
+func (s *DiskCacheStore) Get(key string) (*CachedResponse, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var entry CachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+func (s *DiskCacheStore) Set(key string, resp *CachedResponse) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(s.Dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *DiskCacheStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path returns the file a key is stored in. Keys are hashed, as URLs can't be used as file names.
+func (s *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
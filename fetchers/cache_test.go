@@ -0,0 +1,196 @@
+package fetchers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+)
+
+// cacheServer serves a page with the given Cache-Control header and an ETag, answering conditional requests with
+// 304 Not Modified.
+func cacheServer(t *testing.T, cacheControl string) (*httptest.Server, *int32, *int32) {
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><title>cached</title></html>"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, &notModified
+}
+
+func TestCachingFetcher(t *testing.T) {
+	stores := map[string]func(t *testing.T) fetchers.CacheStore{
+		"memory": func(t *testing.T) fetchers.CacheStore { return fetchers.NewMemoryCacheStore() },
+		"disk":   func(t *testing.T) fetchers.CacheStore { return fetchers.NewDiskCacheStore(t.TempDir()) },
+	}
+
+	tests := []struct {
+		name                string
+		cacheControl        string
+		expectedStatus      []fetchers.CacheStatus
+		expectedRequests    int32
+		expectedNotModified int32
+	}{
+		{
+			name:             "fresh responses are served from the cache",
+			cacheControl:     "max-age=60",
+			expectedStatus:   []fetchers.CacheStatus{fetchers.CacheMiss, fetchers.CacheHit, fetchers.CacheHit},
+			expectedRequests: 1,
+		},
+		{
+			name:                "stale responses are revalidated",
+			cacheControl:        "no-cache",
+			expectedStatus:      []fetchers.CacheStatus{fetchers.CacheMiss, fetchers.CacheRevalidated, fetchers.CacheRevalidated},
+			expectedRequests:    3,
+			expectedNotModified: 2,
+		},
+		{
+			name:             "no-store responses are not cached",
+			cacheControl:     "no-store",
+			expectedStatus:   []fetchers.CacheStatus{fetchers.CacheMiss, fetchers.CacheMiss, fetchers.CacheMiss},
+			expectedRequests: 3,
+		},
+		{
+			name:             "private responses are not cached",
+			cacheControl:     "private, max-age=60",
+			expectedStatus:   []fetchers.CacheStatus{fetchers.CacheMiss, fetchers.CacheMiss, fetchers.CacheMiss},
+			expectedRequests: 3,
+		},
+	}
+
+	for storeName, newStore := range stores {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				server, requests, notModified := cacheServer(t, tt.cacheControl)
+				fetcher := fetchers.NewCachingFetcher(&fetchers.StandardHTTPFetcher{}, newStore(t))
+
+				for _, expected := range tt.expectedStatus {
+					info := &fetchers.FetchInfo{}
+					resp, body, err := fetcher.FetchHTMLContext(fetchers.WithFetchInfo(context.Background(), info), server.URL)
+					if !assert.NoError(t, err) {
+						return
+					}
+					data, _ := io.ReadAll(body)
+					_ = body.Close()
+
+					assert.Equal(t, expected, info.CacheStatus)
+					assert.Equal(t, http.StatusOK, resp.StatusCode)
+					assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+					assert.Equal(t, "<html><title>cached</title></html>", string(data))
+				}
+				assert.Equal(t, tt.expectedRequests, atomic.LoadInt32(requests))
+				assert.Equal(t, tt.expectedNotModified, atomic.LoadInt32(notModified))
+			})
+		}
+	}
+}
+
+// Pages cut short by the body limits aren't cached, so that the next requests get the whole page
+func TestCachingFetcherTruncated(t *testing.T) {
+	server, requests, _ := cacheServer(t, "max-age=60")
+	fetcher := fetchers.NewCachingFetcher(&fetchers.StandardHTTPFetcher{}, fetchers.NewMemoryCacheStore())
+
+	for _, limits := range []fetchers.BodyLimits{{MaxSize: 10, Truncate: true}, {}} {
+		for _, ctx := range []context.Context{context.Background(), fetchers.WithFetchInfo(context.Background(), &fetchers.FetchInfo{})} {
+			info := fetchers.FetchInfoFromContext(ctx)
+			_, body, err := fetcher.FetchHTMLContext(fetchers.WithBodyLimits(ctx, limits), server.URL)
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, _ := io.ReadAll(body)
+			_ = body.Close()
+
+			if limits.Truncate {
+				assert.Less(t, len(data), 34)
+				assert.True(t, strings.HasPrefix("<html><title>cached</title></html>", string(data)))
+				if info != nil {
+					assert.True(t, info.Truncated)
+					assert.Equal(t, fetchers.CacheMiss, info.CacheStatus)
+				}
+			} else {
+				assert.Equal(t, "<html><title>cached</title></html>", string(data))
+				if info != nil {
+					assert.False(t, info.Truncated)
+					assert.Equal(t, fetchers.CacheHit, info.CacheStatus)
+				}
+			}
+		}
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+}
+
+// Requests with credentials bypass the cache, as their pages may be personalized
+func TestCachingFetcherCredentials(t *testing.T) {
+	server, requests, _ := cacheServer(t, "max-age=60")
+	fetcher := fetchers.NewCachingFetcher(&fetchers.StandardHTTPFetcher{}, fetchers.NewMemoryCacheStore())
+
+	contexts := []context.Context{
+		httpclient.WithSession(context.Background(), httpclient.NewSession("login")),
+		httpclient.WithHeader(context.Background(), http.Header{"Authorization": {"Bearer token"}}),
+		httpclient.WithHeader(context.Background(), http.Header{"Cookie": {"session=1"}}),
+		context.Background(),
+		context.Background(),
+	}
+	for _, ctx := range contexts {
+		_, body, err := fetcher.FetchHTMLContext(ctx, server.URL)
+		if assert.NoError(t, err) {
+			_ = body.Close()
+		}
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(requests))
+}
+
+// A response that varies on a header only answers the requests with the same value for it
+func TestCachingFetcherVary(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "accept-language")
+		_, _ = w.Write([]byte("<html lang=\"" + r.Header.Get("Accept-Language") + "\"></html>"))
+	}))
+	t.Cleanup(server.Close)
+	fetcher := fetchers.NewCachingFetcher(&fetchers.StandardHTTPFetcher{}, fetchers.NewMemoryCacheStore())
+
+	tests := []struct {
+		language       string
+		expectedStatus fetchers.CacheStatus
+	}{
+		{language: "en", expectedStatus: fetchers.CacheMiss},
+		{language: "en", expectedStatus: fetchers.CacheHit},
+		{language: "fr", expectedStatus: fetchers.CacheMiss},
+		{language: "fr", expectedStatus: fetchers.CacheHit},
+	}
+	for _, tt := range tests {
+		info := &fetchers.FetchInfo{}
+		ctx := httpclient.WithHeader(fetchers.WithFetchInfo(context.Background(), info), http.Header{"Accept-Language": {tt.language}})
+		_, body, err := fetcher.FetchHTMLContext(ctx, server.URL)
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, _ := io.ReadAll(body)
+		_ = body.Close()
+		assert.Equal(t, tt.expectedStatus, info.CacheStatus, tt.language)
+		assert.Equal(t, "<html lang=\""+tt.language+"\"></html>", string(data))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,663 @@
+package fetchers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/metadata"
+)
+
+const (
+	defaultCDPEndpoint = "http://localhost:9222"
+	defaultCDPTimeout  = 30 * time.Second
+	// cdpNetworkIdleTime is how long there must be no network requests in flight for the page to be idle.
+	cdpNetworkIdleTime = 500 * time.Millisecond
+	cdpPollInterval    = 100 * time.Millisecond
+)
+
+// CDPWait are the conditions a page must meet, once its load event has fired, before its DOM is read. They are
+// checked in the order of the fields.
+type CDPWait struct {
+	// NetworkIdle waits until no network request has been in flight for 500ms. Pages that keep a connection open,
+	// such as a long poll, never become idle.
+	NetworkIdle bool
+	// Selector waits until an element matches the CSS selector.
+	Selector string
+	// Delay waits a fixed time.
+	Delay time.Duration
+}
+
+// CDPViewport is the size of the browser window the page is rendered in.
+type CDPViewport struct {
+	Width             int
+	Height            int
+	DeviceScaleFactor float64
+	Mobile            bool
+}
+
+// CDPFetcher renders pages in a headless browser through the Chrome DevTools Protocol, such as a local headless
+// Chrome started with --remote-debugging-port or a self-hosted browserless. Every request opens a new tab, waits for
+// the page to render, and returns its DOM serialized as HTML. It does not return metadata.
+//
+// The HTTP status, headers and redirects are those of the main document, and are recorded in the FetchInfo carried
+// by the context. Headers carried by the context, see httpclient.WithHeader, are sent with the requests of the page.
+// The requests are made by the browser, so the client options, such as the SSRF guard, don't apply to them.
+type CDPFetcher struct {
+	// Endpoint is the DevTools endpoint. An http or https URL, such as "http://localhost:9222", is asked for the
+	// browser's WebSocket URL, which is then reached through the same host, so the endpoint may sit behind a proxy
+	// or in a container. A ws or wss URL, such as "ws://localhost:3000?token=...", is used as is. Default is
+	// "http://localhost:9222".
+	Endpoint string
+	// Wait are the conditions the page must meet before its DOM is read.
+	Wait CDPWait
+	// Viewport is the size of the browser window. If nil, the browser's default is used.
+	Viewport *CDPViewport
+	// UserAgent overrides the browser's user agent. If empty, the User-Agent header carried by the context is used,
+	// if any.
+	UserAgent string
+	// Cookies are set in the browser before the page is loaded. Cookies without a domain are set for the page's URL.
+	// The cookies of the session carried by the context, see httpclient.WithSession, are set too.
+	Cookies []*http.Cookie
+	// Timeout is the longest a page may take to render. Default is 30 seconds.
+	Timeout time.Duration
+	// Client is the HTTP client used to reach an http or https Endpoint. If nil, the client carried by the request's
+	// context is used, falling back to http.DefaultClient.
+	Client *http.Client
+}
+
+func (c *CDPFetcher) Name() string {
+	return "cdp"
+}
+
+func (c *CDPFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return c.FetchHTMLContext(context.Background(), url)
+}
+
+func (c *CDPFetcher) FetchHTMLContext(ctx context.Context, targetURL string) (*http.Response, io.ReadCloser, error) {
+	// The browser would open local files and its own pages just as well
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cdp: invalid URL %q: %w", targetURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil, fmt.Errorf("cdp: invalid URL %q: unsupported scheme %q", targetURL, u.Scheme)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCDPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	wsURL, err := c.browserURL(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cdp: %w", err)
+	}
+	conn, err := dialWebSocket(ctx, wsURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cdp: connecting to the browser: %w", err)
+	}
+	session := newCDPSession(conn)
+	defer session.close()
+
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := session.call(ctx, "Target.createTarget", map[string]interface{}{"url": "about:blank"}, &target); err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		// The tab is closed even if ctx is done, as long as the connection is up
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		session.sessionID = ""
+		_ = session.call(closeCtx, "Target.closeTarget", map[string]interface{}{"targetId": target.TargetID}, nil)
+	}()
+
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	params := map[string]interface{}{"targetId": target.TargetID, "flatten": true}
+	if err := session.call(ctx, "Target.attachToTarget", params, &attached); err != nil {
+		return nil, nil, err
+	}
+	session.sessionID = attached.SessionID
+
+	html, err := c.render(ctx, session, targetURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := session.response(targetURL, html)
+	if resp.Request.URL != nil {
+		setRedirects(ctx, resp.Request.URL.String(), session.redirects)
+	}
+	return resp, resp.Body, nil
+}
+
+func (c *CDPFetcher) HasMetadata() bool {
+	return false
+}
+
+func (c *CDPFetcher) Metadata() metadata.Metadata {
+	return metadata.Metadata{}
+}
+
+// browserURL returns the WebSocket URL of the browser.
+func (c *CDPFetcher) browserURL(ctx context.Context) (string, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = defaultCDPEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		return endpoint, nil
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("invalid endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+	}
+
+	versionURL := *u
+	versionURL.Path = strings.TrimSuffix(u.Path, "/") + "/json/version"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpclient.Resolve(httpclient.WithoutSession(ctx), c.Client).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: unexpected status %s", versionURL.Redacted(), resp.Status)
+	}
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("%s: %w", versionURL.Redacted(), err)
+	}
+	debugger, err := url.Parse(version.WebSocketDebuggerURL)
+	if err != nil || debugger.Path == "" {
+		return "", fmt.Errorf("%s: invalid webSocketDebuggerUrl %q", versionURL.Redacted(), version.WebSocketDebuggerURL)
+	}
+
+	// The browser reports the address it listens on, which may not be the one it is reached through
+	wsURL := *u
+	wsURL.Scheme = "ws"
+	if u.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	}
+	wsURL.Path = debugger.Path
+	if wsURL.RawQuery == "" {
+		wsURL.RawQuery = debugger.RawQuery
+	}
+	return wsURL.String(), nil
+}
+
+// render loads the page in the attached tab, waits for it and returns its DOM.
+func (c *CDPFetcher) render(ctx context.Context, s *cdpSession, targetURL string) (string, error) {
+	for _, method := range []string{"Page.enable", "Network.enable"} {
+		if err := s.call(ctx, method, nil, nil); err != nil {
+			return "", err
+		}
+	}
+
+	var tree struct {
+		FrameTree struct {
+			Frame struct {
+				ID string `json:"id"`
+			} `json:"frame"`
+		} `json:"frameTree"`
+	}
+	if err := s.call(ctx, "Page.getFrameTree", nil, &tree); err != nil {
+		return "", err
+	}
+	s.frameID = tree.FrameTree.Frame.ID
+
+	if err := c.setUp(ctx, s, targetURL); err != nil {
+		return "", err
+	}
+
+	var navigation struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := s.call(ctx, "Page.navigate", map[string]interface{}{"url": targetURL}, &navigation); err != nil {
+		return "", err
+	}
+	if navigation.ErrorText != "" {
+		return "", fmt.Errorf("cdp: navigating to %s: %s", targetURL, navigation.ErrorText)
+	}
+
+	if err := s.waitFor(ctx, func() (bool, error) { return s.loaded, nil }); err != nil {
+		return "", err
+	}
+	if c.Wait.NetworkIdle {
+		err := s.waitFor(ctx, func() (bool, error) {
+			return s.loaded && len(s.requests) == 0 && time.Since(s.lastActivity) >= cdpNetworkIdleTime, nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.Wait.Selector != "" {
+		selector, _ := json.Marshal(c.Wait.Selector)
+		err := s.waitFor(ctx, func() (bool, error) {
+			var found bool
+			err := s.evaluate(ctx, "document.querySelector("+string(selector)+") !== null", &found)
+			return found, err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.Wait.Delay > 0 {
+		start := time.Now()
+		if err := s.waitFor(ctx, func() (bool, error) { return time.Since(start) >= c.Wait.Delay, nil }); err != nil {
+			return "", err
+		}
+	}
+
+	var html string
+	const serialize = `(document.doctype ? new XMLSerializer().serializeToString(document.doctype) : "") + ` +
+		`document.documentElement.outerHTML`
+	if err := s.evaluate(ctx, serialize, &html); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// setUp applies the viewport, user agent, headers and cookies to the tab.
+func (c *CDPFetcher) setUp(ctx context.Context, s *cdpSession, targetURL string) error {
+	if c.Viewport != nil {
+		scale := c.Viewport.DeviceScaleFactor
+		if scale == 0 {
+			scale = 1
+		}
+		params := map[string]interface{}{
+			"width":             c.Viewport.Width,
+			"height":            c.Viewport.Height,
+			"deviceScaleFactor": scale,
+			"mobile":            c.Viewport.Mobile,
+		}
+		if err := s.call(ctx, "Emulation.setDeviceMetricsOverride", params, nil); err != nil {
+			return err
+		}
+	}
+
+	header := httpclient.HeaderFromContext(ctx)
+	cookies := c.Cookies
+	// The headers and cookies of the session carried by the context go first, so the fetcher's own take precedence
+	if session := httpclient.SessionFromContext(ctx); session != nil {
+		if u, err := url.Parse(targetURL); err == nil {
+			merged := session.Header(u)
+			for name, values := range header {
+				merged[name] = values
+			}
+			header = merged
+			cookies = append(session.Jar.Cookies(u), cookies...)
+		}
+	}
+
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = header.Get("User-Agent")
+	}
+	if userAgent != "" {
+		if err := s.call(ctx, "Network.setUserAgentOverride", map[string]interface{}{"userAgent": userAgent}, nil); err != nil {
+			return err
+		}
+	}
+
+	extra := make(map[string]string)
+	for name, values := range header {
+		if name != "User-Agent" && len(values) > 0 {
+			extra[name] = strings.Join(values, ", ")
+		}
+	}
+	if len(extra) > 0 {
+		if err := s.call(ctx, "Network.setExtraHTTPHeaders", map[string]interface{}{"headers": extra}, nil); err != nil {
+			return err
+		}
+	}
+
+	if len(cookies) > 0 {
+		params := make([]map[string]interface{}, 0, len(cookies))
+		for _, cookie := range cookies {
+			param := map[string]interface{}{
+				"name":     cookie.Name,
+				"value":    cookie.Value,
+				"secure":   cookie.Secure,
+				"httpOnly": cookie.HttpOnly,
+			}
+			if cookie.Domain != "" {
+				param["domain"] = cookie.Domain
+			} else {
+				param["url"] = targetURL
+			}
+			if cookie.Path != "" {
+				param["path"] = cookie.Path
+			}
+			if !cookie.Expires.IsZero() {
+				param["expires"] = cookie.Expires.Unix()
+			}
+			params = append(params, param)
+		}
+		if err := s.call(ctx, "Network.setCookies", map[string]interface{}{"cookies": params}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cdpMessage is a DevTools protocol message: the response to a command, or an event.
+type cdpMessage struct {
+	ID        int             `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type cdpCommand struct {
+	ID        int         `json:"id"`
+	SessionID string      `json:"sessionId,omitempty"`
+	Method    string      `json:"method"`
+	Params    interface{} `json:"params,omitempty"`
+}
+
+// cdpDocument is the response of the main document.
+type cdpDocument struct {
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+}
+
+// cdpSession is a connection to the browser, attached to a single tab. Commands are sent one at a time, and the
+// events of the tab are handled while waiting for their responses, so the state of the page is only touched by the
+// caller's goroutine.
+type cdpSession struct {
+	conn      *wsConn
+	sessionID string
+	nextID    int
+	messages  chan cdpMessage
+	done      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error // set before done is closed
+
+	frameID      string
+	document     *cdpDocument
+	redirects    []Redirect
+	loaded       bool
+	requests     map[string]bool
+	lastActivity time.Time
+}
+
+func newCDPSession(conn *wsConn) *cdpSession {
+	s := &cdpSession{
+		conn:         conn,
+		messages:     make(chan cdpMessage, 64),
+		done:         make(chan struct{}),
+		closed:       make(chan struct{}),
+		requests:     make(map[string]bool),
+		lastActivity: time.Now(),
+	}
+	go s.read()
+	return s
+}
+
+func (s *cdpSession) read() {
+	defer close(s.done)
+	for {
+		data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.err = err
+			return
+		}
+		var msg cdpMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.err = fmt.Errorf("cdp: invalid message: %w", err)
+			return
+		}
+		select {
+		case s.messages <- msg:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func (s *cdpSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		_ = s.conn.Close()
+	})
+}
+
+// next returns the next message, or nil when tick fires first.
+func (s *cdpSession) next(ctx context.Context, tick <-chan time.Time) (*cdpMessage, error) {
+	select {
+	case msg := <-s.messages:
+		return &msg, nil
+	case <-tick:
+		return nil, nil
+	case <-s.done:
+		// Messages read before the connection went down come first
+		select {
+		case msg := <-s.messages:
+			return &msg, nil
+		default:
+		}
+		if errors.Is(s.err, io.EOF) {
+			return nil, errors.New("cdp: connection closed by the browser")
+		}
+		return nil, fmt.Errorf("cdp: %w", s.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call sends a command and decodes its result into result, if not nil.
+func (s *cdpSession) call(ctx context.Context, method string, params, result interface{}) error {
+	s.nextID++
+	id := s.nextID
+	data, err := json.Marshal(cdpCommand{ID: id, SessionID: s.sessionID, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if err := s.conn.WriteText(data); err != nil {
+		return fmt.Errorf("cdp: %s: %w", method, err)
+	}
+
+	for {
+		msg, err := s.next(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if msg.ID != id {
+			s.handle(msg)
+			continue
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("cdp: %s: %s", method, msg.Error.Message)
+		}
+		if result != nil && len(msg.Result) > 0 {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				return fmt.Errorf("cdp: %s: %w", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+// evaluate runs a JavaScript expression in the page and decodes its value into result.
+func (s *cdpSession) evaluate(ctx context.Context, expression string, result interface{}) error {
+	var evaluation struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	params := map[string]interface{}{"expression": expression, "returnByValue": true}
+	if err := s.call(ctx, "Runtime.evaluate", params, &evaluation); err != nil {
+		return err
+	}
+	if details := evaluation.ExceptionDetails; details != nil {
+		message := details.Exception.Description
+		if message == "" {
+			message = details.Text
+		}
+		return fmt.Errorf("cdp: evaluating script: %s", message)
+	}
+	if len(evaluation.Result.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(evaluation.Result.Value, result)
+}
+
+// waitFor handles the events of the page until done returns true, checking it every cdpPollInterval.
+func (s *cdpSession) waitFor(ctx context.Context, done func() (bool, error)) error {
+	ticker := time.NewTicker(cdpPollInterval)
+	defer ticker.Stop()
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		for {
+			msg, err := s.next(ctx, ticker.C)
+			if err != nil {
+				return err
+			}
+			if msg == nil {
+				break
+			}
+			s.handle(msg)
+		}
+	}
+}
+
+// handle updates the state of the page with an event.
+func (s *cdpSession) handle(msg *cdpMessage) {
+	if msg.Method == "" || msg.SessionID != s.sessionID || s.sessionID == "" {
+		return
+	}
+
+	var event struct {
+		RequestID string `json:"requestId"`
+		FrameID   string `json:"frameId"`
+		Type      string `json:"type"`
+		Initiator struct {
+			Type string `json:"type"`
+		} `json:"initiator"`
+		Response         *cdpDocument `json:"response"`
+		RedirectResponse *cdpDocument `json:"redirectResponse"`
+	}
+	if err := json.Unmarshal(msg.Params, &event); err != nil {
+		return
+	}
+	isDocument := event.FrameID == s.frameID && event.Type == "Document"
+
+	switch msg.Method {
+	case "Network.requestWillBeSent":
+		s.requests[event.RequestID] = true
+		s.lastActivity = time.Now()
+		if !isDocument {
+			return
+		}
+		if event.RedirectResponse != nil {
+			s.redirects = append(s.redirects, Redirect{
+				URL:        event.RedirectResponse.URL,
+				StatusCode: event.RedirectResponse.Status,
+				Type:       RedirectHTTP,
+			})
+			return
+		}
+		if s.document != nil {
+			// The page navigated away by itself
+			redirectType := RedirectMetaRefresh
+			if event.Initiator.Type == "script" {
+				redirectType = RedirectJavaScript
+			}
+			s.redirects = append(s.redirects, Redirect{URL: s.document.URL, StatusCode: s.document.Status, Type: redirectType})
+			s.document = nil
+		}
+		// A new document is on its way, so wait for it to load
+		s.loaded = false
+	case "Network.responseReceived":
+		if isDocument && event.Response != nil {
+			s.document = event.Response
+		}
+	case "Network.loadingFinished", "Network.loadingFailed":
+		delete(s.requests, event.RequestID)
+		s.lastActivity = time.Now()
+	case "Page.loadEventFired":
+		s.loaded = true
+	}
+}
+
+// response builds the response of the rendered page. Its body is the DOM, so it is always UTF-8 encoded HTML
+// whatever the page was served as.
+func (s *cdpSession) response(targetURL, html string) *http.Response {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	finalURL := targetURL
+	if doc := s.document; doc != nil {
+		if doc.Status != 0 {
+			resp.StatusCode = doc.Status
+			resp.Status = fmt.Sprintf("%d %s", doc.Status, http.StatusText(doc.Status))
+		}
+		for name, value := range doc.Headers {
+			for _, v := range strings.Split(value, "\n") {
+				resp.Header.Add(name, v)
+			}
+		}
+		if doc.URL != "" {
+			finalURL = doc.URL
+		}
+	}
+	for _, name := range []string{"Content-Encoding", "Content-Length", "Transfer-Encoding"} {
+		resp.Header.Del(name)
+	}
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.ContentLength = int64(len(html))
+	resp.Body = io.NopCloser(strings.NewReader(html))
+
+	u, err := url.Parse(finalURL)
+	if err != nil {
+		u, _ = url.Parse(targetURL)
+	}
+	// u is only nil if the target URL is invalid, which the browser refuses to navigate to anyway
+	resp.Request = &http.Request{Method: http.MethodGet, URL: u, Header: make(http.Header)}
+	return resp
+}
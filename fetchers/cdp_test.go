@@ -0,0 +1,278 @@
+package fetchers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+)
+
+// fakeBrowser is a DevTools endpoint that pretends to render a page: the page redirects once, loads a script that
+// finishes after the load event, and adds a #comments element after a few checks.
+type fakeBrowser struct {
+	navigateError string
+
+	mu       sync.Mutex
+	commands map[string]json.RawMessage
+	closed   bool
+}
+
+func (b *fakeBrowser) server() *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		// The browser reports an address the client can't reach
+		_, _ = w.Write([]byte(`{"Browser":"HeadlessChrome","webSocketDebuggerUrl":"ws://127.0.0.1:1/devtools/browser/abc"}`))
+	})
+	mux.Handle("/devtools/browser/abc", websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   b.serve,
+	})
+	return server
+}
+
+func (b *fakeBrowser) serve(ws *websocket.Conn) {
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		_ = websocket.Message.Send(ws, string(data))
+	}
+	event := func(method string, params interface{}) {
+		send(map[string]interface{}{"sessionId": "S1", "method": method, "params": params})
+	}
+
+	selectorChecks := 0
+	for {
+		var data string
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		var cmd struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.Unmarshal([]byte(data), &cmd)
+		b.mu.Lock()
+		b.commands[cmd.Method] = cmd.Params
+		b.mu.Unlock()
+
+		result := map[string]interface{}{}
+		switch cmd.Method {
+		case "Target.createTarget":
+			result["targetId"] = "T1"
+		case "Target.attachToTarget":
+			result["sessionId"] = "S1"
+		case "Target.closeTarget":
+			b.mu.Lock()
+			b.closed = true
+			b.mu.Unlock()
+		case "Page.getFrameTree":
+			result["frameTree"] = map[string]interface{}{"frame": map[string]interface{}{"id": "F1"}}
+		case "Page.navigate":
+			if b.navigateError != "" {
+				result["errorText"] = b.navigateError
+				break
+			}
+			var params struct {
+				URL string `json:"url"`
+			}
+			_ = json.Unmarshal(cmd.Params, &params)
+			final := strings.Replace(params.URL, "/start", "/article", 1)
+
+			event("Network.requestWillBeSent", map[string]interface{}{
+				"requestId": "R1", "frameId": "F1", "type": "Document", "request": map[string]interface{}{"url": params.URL},
+			})
+			event("Network.requestWillBeSent", map[string]interface{}{
+				"requestId": "R1", "frameId": "F1", "type": "Document", "request": map[string]interface{}{"url": final},
+				"redirectResponse": map[string]interface{}{"url": params.URL, "status": 301},
+			})
+			event("Network.responseReceived", map[string]interface{}{
+				"requestId": "R1", "frameId": "F1", "type": "Document",
+				"response": map[string]interface{}{
+					"url":     final,
+					"status":  200,
+					"headers": map[string]string{"Content-Type": "text/html; charset=iso-8859-1", "X-Served-By": "a\nb"},
+				},
+			})
+			result["frameId"] = "F1"
+			result["loaderId"] = "R1"
+			send(map[string]interface{}{"id": cmd.ID, "sessionId": "S1", "result": result})
+
+			event("Network.loadingFinished", map[string]interface{}{"requestId": "R1"})
+			event("Network.requestWillBeSent", map[string]interface{}{
+				"requestId": "R2", "frameId": "F1", "type": "XHR", "request": map[string]interface{}{"url": final + ".json"},
+			})
+			event("Page.loadEventFired", map[string]interface{}{"timestamp": 1})
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				event("Network.loadingFinished", map[string]interface{}{"requestId": "R2"})
+			}()
+			continue
+		case "Runtime.evaluate":
+			var params struct {
+				Expression string `json:"expression"`
+			}
+			_ = json.Unmarshal(cmd.Params, &params)
+			switch {
+			case strings.Contains(params.Expression, "querySelector"):
+				selectorChecks++
+				result["result"] = map[string]interface{}{"type": "boolean", "value": selectorChecks > 2}
+			case strings.Contains(params.Expression, "outerHTML"):
+				result["result"] = map[string]interface{}{
+					"type":  "string",
+					"value": `<!DOCTYPE html><html><head><title>Rendered</title></head><body><div id="comments"></div></body></html>`,
+				}
+			}
+		}
+		send(map[string]interface{}{"id": cmd.ID, "result": result})
+	}
+}
+
+func (b *fakeBrowser) command(method string) map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	params, ok := b.commands[method]
+	if !ok {
+		return nil
+	}
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(params, &decoded)
+	return decoded
+}
+
+func TestCDPFetcher(t *testing.T) {
+	browser := &fakeBrowser{commands: make(map[string]json.RawMessage)}
+	server := browser.server()
+	defer server.Close()
+
+	fetcher := &fetchers.CDPFetcher{
+		Endpoint:  server.URL,
+		Wait:      fetchers.CDPWait{NetworkIdle: true, Selector: "#comments", Delay: 50 * time.Millisecond},
+		Viewport:  &fetchers.CDPViewport{Width: 1280, Height: 800},
+		UserAgent: "Gophetch/1.0",
+		Cookies:   []*http.Cookie{{Name: "session", Value: "abc"}},
+	}
+
+	info := &fetchers.FetchInfo{}
+	ctx := fetchers.WithFetchInfo(context.Background(), info)
+	ctx = httpclient.WithHeader(ctx, http.Header{"Accept-Language": {"fr"}})
+	session := httpclient.NewSession("example")
+	session.SetHeader("example.com", "Accept-Language", "en")
+	session.SetHeader("example.com", "X-Api-Key", "secret")
+	session.SetHeader("example.org", "X-Other-Key", "other")
+	_ = session.SetCookies("https://example.com/", &http.Cookie{Name: "consent", Value: "granted"})
+	ctx = httpclient.WithSession(ctx, session)
+	start := time.Now()
+	resp, body, err := fetcher.FetchHTMLContext(ctx, "https://example.com/start")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = body.Close() }()
+	html, _ := io.ReadAll(body)
+
+	// The network is idle once the script has finished, 500ms later
+	assert.True(t, time.Since(start) >= 700*time.Millisecond)
+	assert.Equal(t, `<!DOCTYPE html><html><head><title>Rendered</title></head><body><div id="comments"></div></body></html>`, string(html))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"a", "b"}, resp.Header.Values("X-Served-By"))
+	assert.Equal(t, "https://example.com/article", resp.Request.URL.String())
+	assert.Equal(t, "https://example.com/article", info.FinalURL)
+	assert.Equal(t, []fetchers.Redirect{
+		{URL: "https://example.com/start", StatusCode: http.StatusMovedPermanently, Type: fetchers.RedirectHTTP},
+	}, info.Redirects)
+
+	assert.Equal(t, map[string]interface{}{"width": 1280.0, "height": 800.0, "deviceScaleFactor": 1.0, "mobile": false},
+		browser.command("Emulation.setDeviceMetricsOverride"))
+	assert.Equal(t, map[string]interface{}{"userAgent": "Gophetch/1.0"}, browser.command("Network.setUserAgentOverride"))
+	assert.Equal(t, map[string]interface{}{"headers": map[string]interface{}{"Accept-Language": "fr", "X-Api-Key": "secret"}},
+		browser.command("Network.setExtraHTTPHeaders"))
+	assert.Equal(t, map[string]interface{}{"cookies": []interface{}{
+		map[string]interface{}{
+			"name": "consent", "value": "granted", "url": "https://example.com/start", "secure": false, "httpOnly": false,
+		},
+		map[string]interface{}{
+			"name": "session", "value": "abc", "url": "https://example.com/start", "secure": false, "httpOnly": false,
+		},
+	}}, browser.command("Network.setCookies"))
+	browser.mu.Lock()
+	assert.True(t, browser.closed)
+	browser.mu.Unlock()
+}
+
+func TestCDPFetcherErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		navigateError string
+		wait          fetchers.CDPWait
+		endpoint      func(server string) string
+		expectedError string
+	}{
+		{
+			name:          "navigation error",
+			navigateError: "net::ERR_NAME_NOT_RESOLVED",
+			expectedError: "cdp: navigating to https://example.com/start: net::ERR_NAME_NOT_RESOLVED",
+		},
+		{
+			name:          "timeout",
+			wait:          fetchers.CDPWait{Selector: "#never", Delay: time.Minute},
+			expectedError: "context deadline exceeded",
+		},
+		{
+			name:          "websocket endpoint",
+			navigateError: "net::ERR_CONNECTION_REFUSED",
+			endpoint:      func(server string) string { return "ws" + strings.TrimPrefix(server, "http") + "/devtools/browser/abc" },
+			expectedError: "net::ERR_CONNECTION_REFUSED",
+		},
+		{
+			name:          "unsupported endpoint",
+			endpoint:      func(string) string { return "ftp://localhost:9222" },
+			expectedError: `unsupported scheme "ftp"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser := &fakeBrowser{commands: make(map[string]json.RawMessage), navigateError: tt.navigateError}
+			server := browser.server()
+			defer server.Close()
+
+			endpoint := server.URL
+			if tt.endpoint != nil {
+				endpoint = tt.endpoint(server.URL)
+			}
+			fetcher := &fetchers.CDPFetcher{Endpoint: endpoint, Wait: tt.wait, Timeout: 300 * time.Millisecond}
+			_, _, err := fetcher.FetchHTMLContext(context.Background(), "https://example.com/start")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expectedError)
+			}
+		})
+	}
+}
+
+// Only web pages are rendered, the browser is never asked to open anything else
+func TestCDPFetcherScheme(t *testing.T) {
+	browser := &fakeBrowser{commands: make(map[string]json.RawMessage)}
+	server := browser.server()
+	defer server.Close()
+
+	fetcher := &fetchers.CDPFetcher{Endpoint: server.URL}
+	for _, targetURL := range []string{"file:///etc/passwd", "chrome://settings", "view-source:https://example.com/", "about:blank"} {
+		_, _, err := fetcher.FetchHTMLContext(context.Background(), targetURL)
+		if assert.Error(t, err, targetURL) {
+			assert.Contains(t, err.Error(), "unsupported scheme")
+		}
+	}
+	assert.Nil(t, browser.command("Target.createTarget"))
+}
@@ -1,6 +1,7 @@
 package fetchers
 
 import (
+	"context"
 	"io"
 	"net/http"
 
@@ -19,3 +20,120 @@ type HTMLFetcher interface {
 	// Metadata returns the metadata for the fetcher, if available.
 	Metadata() metadata.Metadata
 }
+
+// ContextHTMLFetcher is implemented by fetchers that can stop their work when a context is cancelled or its deadline
+// passes. All the fetchers in this package implement it.
+type ContextHTMLFetcher interface {
+	HTMLFetcher
+	// FetchHTMLContext fetches the HTML from the given URL. The context is used for the whole request, including
+	// reading the response body.
+	FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error)
+}
+
+// FetchHTMLContext fetches the HTML from the given URL using the given fetcher. If the fetcher implements
+// ContextHTMLFetcher the context is passed along, otherwise the context is only checked before the fetch starts.
+func FetchHTMLContext(ctx context.Context, fetcher HTMLFetcher, url string) (*http.Response, io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if cf, ok := fetcher.(ContextHTMLFetcher); ok {
+		return cf.FetchHTMLContext(ctx, url)
+	}
+	return fetcher.FetchHTML(url)
+}
+
+// FetchInfo records request-scoped details about a single fetch. A caller attaches one to the context with
+// WithFetchInfo, and fetchers fill in what they know. Unlike the Metadata method, it is never shared between
+// concurrent requests.
+type FetchInfo struct {
+	// Metadata is the metadata returned by fetchers that provide it, such as MicrolinkFetcher.
+	Metadata *metadata.Metadata
+	// CacheStatus is set by CachingFetcher to report whether the page came from its cache.
+	CacheStatus CacheStatus
+	// FinalURL is the URL the page was fetched from after following redirects. It is set by the fetchers that
+	// request the page directly, as the response of an API-based fetcher comes from the API.
+	FinalURL string
+	// Redirects are the redirects followed to reach FinalURL, in order.
+	Redirects []Redirect
+	// Proxy is the proxy the page was fetched through, with its password redacted. It is set by ProxyHTTPFetcher and
+	// ProxyPoolFetcher.
+	Proxy string
+	// Truncated is set when the body hit one of the BodyLimits and was cut short, see BodyLimits.Truncate. It is
+	// only known once the body has been read.
+	Truncated bool
+}
+
+// RedirectType is how a page redirected to the next one.
+type RedirectType string
+
+const (
+	// RedirectHTTP is a redirect with a 3xx status code and a Location header.
+	RedirectHTTP RedirectType = "http"
+	// RedirectMetaRefresh is a <meta http-equiv="refresh"> tag.
+	RedirectMetaRefresh RedirectType = "meta-refresh"
+	// RedirectJavaScript is a script assigning a new location.
+	RedirectJavaScript RedirectType = "javascript"
+)
+
+// Redirect is a single hop in a redirect chain.
+type Redirect struct {
+	// URL is the URL that redirected.
+	URL string `json:"url"`
+	// StatusCode is the status code of the response that redirected.
+	StatusCode int `json:"status_code"`
+	// Type is how the response redirected.
+	Type RedirectType `json:"type"`
+}
+
+// RedirectChain returns the HTTP redirects followed by an http.Client to get the given response, in order.
+func RedirectChain(resp *http.Response) []Redirect {
+	var redirects []Redirect
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		prev := req.Response
+		if prev.Request == nil || prev.Request.URL == nil {
+			break
+		}
+		redirects = append([]Redirect{{
+			URL:        prev.Request.URL.String(),
+			StatusCode: prev.StatusCode,
+			Type:       RedirectHTTP,
+		}}, redirects...)
+	}
+	return redirects
+}
+
+// finalURL returns the URL a response came from, or an empty string if it isn't known.
+func finalURL(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return ""
+	}
+	return resp.Request.URL.String()
+}
+
+// setFinalURL records the URL the response came from, and the redirects followed to get there, in the FetchInfo
+// carried by ctx.
+func setFinalURL(ctx context.Context, resp *http.Response) {
+	if u := finalURL(resp); u != "" {
+		setRedirects(ctx, u, RedirectChain(resp))
+	}
+}
+
+func setRedirects(ctx context.Context, finalURL string, redirects []Redirect) {
+	if info := FetchInfoFromContext(ctx); info != nil {
+		info.FinalURL = finalURL
+		info.Redirects = redirects
+	}
+}
+
+type fetchInfoKey struct{}
+
+// WithFetchInfo returns a copy of ctx that carries the given FetchInfo.
+func WithFetchInfo(ctx context.Context, info *FetchInfo) context.Context {
+	return context.WithValue(ctx, fetchInfoKey{}, info)
+}
+
+// FetchInfoFromContext returns the FetchInfo carried by ctx, or nil if there is none.
+func FetchInfoFromContext(ctx context.Context) *FetchInfo {
+	info, _ := ctx.Value(fetchInfoKey{}).(*FetchInfo)
+	return info
+}
@@ -0,0 +1,298 @@
+package fetchers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/octetic/gophetch/metadata"
+)
+
+// ErrFixtureNotFound is returned by ReplayFetcher and ReplayTransport when no fixture was recorded for a URL.
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// Fixture is a recorded response. It is stored as a JSON file next to a file holding the raw body, both named after
+// the URL, see FixturePath.
+type Fixture struct {
+	// URL is the URL that was requested.
+	URL string `json:"url"`
+	// FinalURL is the URL the response came from, after following redirects.
+	FinalURL string `json:"final_url"`
+	// Redirects are the redirects followed to reach FinalURL.
+	Redirects []Redirect `json:"redirects,omitempty"`
+	// StatusCode is the status code of the response.
+	StatusCode int `json:"status_code"`
+	// Header holds the response headers.
+	Header http.Header `json:"header"`
+	// Fetcher is the name of the fetcher that made the request, if it was recorded by a RecordingFetcher.
+	Fetcher string `json:"fetcher,omitempty"`
+	// RecordedAt is when the response was recorded.
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// FixturePath returns the path of the JSON file holding the fixture for the given URL in the given directory. The
+// body is stored in the same place, with a .body extension instead of .json. The name starts with the host and path
+// of the URL, so the fixtures are easy to find, and ends with a hash of the full URL, so it is unique.
+func FixturePath(dir, rawURL string) string {
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		name = u.Host + u.Path
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, name+"-"+hex.EncodeToString(sum[:6])+".json")
+}
+
+// SaveFixture writes a fixture and its body to the given directory, creating it if needed.
+func SaveFixture(dir string, fixture Fixture, body []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := FixturePath(dir, fixture.URL)
+	if err := os.WriteFile(bodyPath(path), body, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadFixture reads the fixture and body recorded for the given URL from the given directory. It returns an error
+// wrapping ErrFixtureNotFound if there is none.
+func LoadFixture(dir, rawURL string) (Fixture, []byte, error) {
+	path := FixturePath(dir, rawURL)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Fixture{}, nil, fmt.Errorf("%w: %s (expected %s)", ErrFixtureNotFound, rawURL, path)
+	} else if err != nil {
+		return Fixture{}, nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return Fixture{}, nil, fmt.Errorf("reading fixture %s: %w", path, err)
+	}
+
+	body, err := os.ReadFile(bodyPath(path))
+	if err != nil {
+		return Fixture{}, nil, fmt.Errorf("reading fixture %s: %w", path, err)
+	}
+	return fixture, body, nil
+}
+
+func bodyPath(path string) string {
+	return strings.TrimSuffix(path, ".json") + ".body"
+}
+
+// recordResponse saves the response as a fixture, and returns a copy of it whose body can still be read.
+func recordResponse(dir, rawURL, fetcherName string, resp *http.Response, body io.ReadCloser) (*http.Response, error) {
+	data, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := Fixture{
+		URL:        rawURL,
+		FinalURL:   rawURL,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Fetcher:    fetcherName,
+		RecordedAt: time.Now().UTC(),
+	}
+	if u := finalURL(resp); u != "" {
+		fixture.FinalURL = u
+		fixture.Redirects = RedirectChain(resp)
+	}
+	if err := SaveFixture(dir, fixture, data); err != nil {
+		return nil, fmt.Errorf("recording fixture: %w", err)
+	}
+
+	recorded := *resp
+	recorded.Body = io.NopCloser(bytes.NewReader(data))
+	return &recorded, nil
+}
+
+// replayResponse builds the response recorded in a fixture.
+func replayResponse(ctx context.Context, fixture Fixture, body []byte) (*http.Response, error) {
+	finalURL := fixture.FinalURL
+	if finalURL == "" {
+		finalURL = fixture.URL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, finalURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.StatusCode, http.StatusText(fixture.StatusCode)),
+		StatusCode:    fixture.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fixture.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// RecordingFetcher is an HTMLFetcher that saves every response of another fetcher as a fixture in a directory, so
+// it can be served again by a ReplayFetcher.
+type RecordingFetcher struct {
+	// Fetcher is the fetcher whose responses are recorded.
+	Fetcher HTMLFetcher
+	// Dir is the fixture directory.
+	Dir string
+}
+
+func (r *RecordingFetcher) Name() string {
+	return r.Fetcher.Name()
+}
+
+func (r *RecordingFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return r.FetchHTMLContext(context.Background(), url)
+}
+
+func (r *RecordingFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	resp, body, err := FetchHTMLContext(ctx, r.Fetcher, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recorded, err := recordResponse(r.Dir, url, r.Fetcher.Name(), resp, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return recorded, recorded.Body, nil
+}
+
+func (r *RecordingFetcher) HasMetadata() bool {
+	return r.Fetcher.HasMetadata()
+}
+
+func (r *RecordingFetcher) Metadata() metadata.Metadata {
+	return r.Fetcher.Metadata()
+}
+
+// ReplayFetcher is an HTMLFetcher that serves the fixtures recorded by a RecordingFetcher without making any
+// request. A URL without a fixture is an error wrapping ErrFixtureNotFound.
+type ReplayFetcher struct {
+	// Dir is the fixture directory.
+	Dir string
+}
+
+func (r *ReplayFetcher) Name() string {
+	return "replay"
+}
+
+func (r *ReplayFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return r.FetchHTMLContext(context.Background(), url)
+}
+
+func (r *ReplayFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	fixture, body, err := LoadFixture(r.Dir, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := replayResponse(ctx, fixture, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	setRedirects(ctx, resp.Request.URL.String(), fixture.Redirects)
+	return resp, resp.Body, nil
+}
+
+func (r *ReplayFetcher) HasMetadata() bool {
+	return false
+}
+
+func (r *ReplayFetcher) Metadata() metadata.Metadata {
+	return metadata.Metadata{}
+}
+
+// RecordingTransport is an http.RoundTripper that saves the responses to GET and HEAD requests as fixtures. Use it in the
+// client given to Gophetch or the ImageInliner to record the requests made for favicons and images as well.
+type RecordingTransport struct {
+	// Base is the transport making the requests. Default is http.DefaultTransport.
+	Base http.RoundTripper
+	// Dir is the fixture directory.
+	Dir string
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return resp, err
+	}
+	return recordResponse(t.Dir, fixtureURL(req), "", resp, resp.Body)
+}
+
+// ReplayTransport is an http.RoundTripper that serves the fixtures recorded by a RecordingTransport or a
+// RecordingFetcher without making any request. A URL without a fixture is an error wrapping ErrFixtureNotFound.
+type ReplayTransport struct {
+	// Dir is the fixture directory.
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fixture, body, err := LoadFixture(t.Dir, fixtureURL(req))
+	if errors.Is(err, ErrFixtureNotFound) && req.Method == http.MethodHead {
+		// Only the headers are needed, so the response to a GET request will do
+		fixture, body, err = LoadFixture(t.Dir, req.URL.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+
+	resp, err := replayResponse(req.Context(), fixture, body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// fixtureURL returns the URL a request is recorded under. HEAD requests are recorded separately, so they don't
+// overwrite the body of a GET request to the same URL.
+func fixtureURL(req *http.Request) string {
+	u := req.URL.String()
+	if req.Method == http.MethodHead {
+		return u + "#head"
+	}
+	return u
+}
@@ -1,13 +1,16 @@
 package fetchers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/metadata"
 )
 
@@ -50,12 +53,17 @@ func (d MicrolinkDataQueryRule) AsMap(prefix string) map[string]string {
 }
 
 // MicrolinkFetcher is the struct that encapsulates the microlink.io fetcher. It is responsible for fetching the
-// HTML from the given URL. This fetcher returns metadata.
+// HTML from the given URL. This fetcher returns metadata, both through Metadata and, for concurrent use, through
+// the FetchInfo attached to the request's context.
 type MicrolinkFetcher struct {
 	AdBlock   bool
 	APIKey    string
 	Prerender bool
-	metadata  metadata.Metadata
+	// Client is the HTTP client used for requests. If nil, the client carried by the request's context is used,
+	// falling back to http.DefaultClient.
+	Client   *http.Client
+	mu       sync.Mutex
+	metadata metadata.Metadata
 }
 
 func (m *MicrolinkFetcher) Name() string {
@@ -63,8 +71,10 @@ func (m *MicrolinkFetcher) Name() string {
 }
 
 func (m *MicrolinkFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadCloser, error) {
-	//fmt.Println("Fetching HTML from Microlink")
+	return m.FetchHTMLContext(context.Background(), targetURL)
+}
 
+func (m *MicrolinkFetcher) FetchHTMLContext(ctx context.Context, targetURL string) (*http.Response, io.ReadCloser, error) {
 	// Create the URL with the token in the query parameters
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -82,15 +92,13 @@ func (m *MicrolinkFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadC
 	urlString := u.String()
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("GET", urlString, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 	req.Header.Set("x-api-key", m.APIKey)
 
-	// Create a new HTTP client and make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Resolve(httpclient.WithoutSession(ctx), m.Client).Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -111,23 +119,31 @@ func (m *MicrolinkFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadC
 		return resp, nil, err
 	}
 
-	//m.metadata = fetchedJSON.Data
-	m.metadata.URL = fetchedJSON.Data.URL
-	m.metadata.Title = fetchedJSON.Data.Title
-	m.metadata.Description = fetchedJSON.Data.Description
-	m.metadata.Author = fetchedJSON.Data.Author
-	m.metadata.Publisher = fetchedJSON.Data.Publisher
-	m.metadata.SiteName = fetchedJSON.Data.Publisher
-	m.metadata.CanonicalURL = fetchedJSON.Data.URL
-	m.metadata.LeadImageURL = fetchedJSON.Data.Image.URL
-	m.metadata.Meta = fetchedJSON.Data.Meta
-	m.metadata.FaviconURL = fetchedJSON.Data.Logo.URL
-	m.metadata.Video = fetchedJSON.Data.Video
-	m.metadata.Audio = fetchedJSON.Data.Audio
-	m.metadata.Date = fetchedJSON.Data.Date
-	m.metadata.Lang = fetchedJSON.Data.Lang
-	m.metadata.HTML = fetchedJSON.Data.HTML
-	m.metadata.Kind = "link"
+	var meta metadata.Metadata
+	meta.URL = fetchedJSON.Data.URL
+	meta.Title = fetchedJSON.Data.Title
+	meta.Description = fetchedJSON.Data.Description
+	meta.Author = fetchedJSON.Data.Author
+	meta.Publisher = fetchedJSON.Data.Publisher
+	meta.SiteName = fetchedJSON.Data.Publisher
+	meta.CanonicalURL = fetchedJSON.Data.URL
+	meta.LeadImageURL = fetchedJSON.Data.Image.URL
+	meta.Meta = fetchedJSON.Data.Meta
+	meta.FaviconURL = fetchedJSON.Data.Logo.URL
+	meta.Video = fetchedJSON.Data.Video
+	meta.Audio = fetchedJSON.Data.Audio
+	meta.Date = fetchedJSON.Data.Date
+	meta.Lang = fetchedJSON.Data.Lang
+	meta.HTML = fetchedJSON.Data.HTML
+	meta.Kind = "link"
+
+	m.mu.Lock()
+	m.metadata = meta
+	m.mu.Unlock()
+
+	if info := FetchInfoFromContext(ctx); info != nil {
+		info.Metadata = &meta
+	}
 
 	// Find the html content
 	htmlContent := fetchedJSON.Data.HTML
@@ -145,7 +161,11 @@ func (m *MicrolinkFetcher) HasMetadata() bool {
 	return true
 }
 
+// Metadata returns the metadata from the most recent fetch. When the fetcher is shared between goroutines, use the
+// FetchInfo attached to the request's context instead.
 func (m *MicrolinkFetcher) Metadata() metadata.Metadata {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.metadata
 }
 
@@ -0,0 +1,336 @@
+package fetchers_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+)
+
+// forwardProxy is an HTTP proxy that answers the requests itself, with its name and the requested URL, instead of
+// forwarding them. It fails with the given status, if any, and asks for credentials if user is set.
+func forwardProxy(name, user, password string, status *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user != "" {
+			expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+			if r.Header.Get("Proxy-Authorization") != expected {
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return
+			}
+		}
+		if status != nil && *status != 0 {
+			w.WriteHeader(*status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "%s %s", name, r.URL)
+	})
+}
+
+// socks5Proxy starts a SOCKS5 proxy requiring the given credentials, and returns its address.
+func socks5Proxy(t *testing.T, user, password string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocks5(conn, user, password)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSocks5(conn net.Conn, user, password string) {
+	defer func() { _ = conn.Close() }()
+
+	readBytes := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil
+		}
+		return b
+	}
+
+	// Greeting, then username and password authentication (RFC 1929)
+	header := readBytes(2)
+	if header == nil || readBytes(int(header[1])) == nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 2})
+	auth := readBytes(2)
+	if auth == nil {
+		return
+	}
+	gotUser := readBytes(int(auth[1]))
+	passLen := readBytes(1)
+	if passLen == nil {
+		return
+	}
+	gotPassword := readBytes(int(passLen[0]))
+	if string(gotUser) != user || string(gotPassword) != password {
+		_, _ = conn.Write([]byte{1, 1})
+		return
+	}
+	_, _ = conn.Write([]byte{1, 0})
+
+	// Connect request
+	req := readBytes(4)
+	if req == nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(readBytes(4)).String()
+	case 3:
+		host = string(readBytes(int(readBytes(1)[0])))
+	case 4:
+		host = net.IP(readBytes(16)).String()
+	}
+	port := binary.BigEndian.Uint16(readBytes(2))
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer func() { _ = target.Close() }()
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go func() { _, _ = io.Copy(target, conn) }()
+	_, _ = io.Copy(conn, target)
+}
+
+func fetchBody(t *testing.T, fetcher fetchers.HTMLFetcher, url string) (string, *fetchers.FetchInfo, error) {
+	info := &fetchers.FetchInfo{}
+	resp, body, err := fetchers.FetchHTMLContext(fetchers.WithFetchInfo(context.Background(), info), fetcher, url)
+	if err != nil {
+		return "", info, err
+	}
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", info, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return string(data), info, nil
+}
+
+func TestProxyPoolFetcherSchemes(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("target " + r.URL.Path))
+	}))
+	defer target.Close()
+
+	httpProxy := httptest.NewServer(forwardProxy("http", "alice", "secret", nil))
+	defer httpProxy.Close()
+	httpsProxy := httptest.NewTLSServer(forwardProxy("https", "", "", nil))
+	defer httpsProxy.Close()
+	socksAddr := socks5Proxy(t, "bob", "hunter2")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(httpsProxy.Certificate())
+
+	tests := []struct {
+		name          string
+		proxy         string
+		expectedBody  string
+		expectedProxy string
+	}{
+		{
+			name:          "http with credentials",
+			proxy:         strings.Replace(httpProxy.URL, "http://", "http://alice:secret@", 1),
+			expectedBody:  "http " + target.URL + "/page",
+			expectedProxy: strings.Replace(httpProxy.URL, "http://", "http://alice:xxxxx@", 1),
+		},
+		{
+			name:          "https",
+			proxy:         httpsProxy.URL,
+			expectedBody:  "https " + target.URL + "/page",
+			expectedProxy: httpsProxy.URL,
+		},
+		{
+			name:          "socks5 with credentials",
+			proxy:         "socks5://bob:hunter2@" + socksAddr,
+			expectedBody:  "target /page",
+			expectedProxy: "socks5://bob:xxxxx@" + socksAddr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, err := fetchers.NewProxyPoolFetcher(fetchers.ProxyPoolOptions{
+				Proxies:       []string{tt.proxy},
+				ClientOptions: httpclient.Options{TLSConfig: &tls.Config{RootCAs: roots}},
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			body, info, err := fetchBody(t, fetcher, target.URL+"/page")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, body)
+			assert.Equal(t, tt.expectedProxy, info.Proxy)
+		})
+	}
+
+	// The single proxy fetcher is built on the same clients
+	fetcher := &fetchers.ProxyHTTPFetcher{ProxyURL: "socks5://bob:hunter2@" + socksAddr}
+	body, info, err := fetchBody(t, fetcher, target.URL+"/single")
+	assert.NoError(t, err)
+	assert.Equal(t, "target /single", body)
+	assert.Equal(t, "socks5://bob:xxxxx@"+socksAddr, info.Proxy)
+}
+
+func TestProxyPoolFetcherRotation(t *testing.T) {
+	var proxies []string
+	for _, name := range []string{"a", "b", "c"} {
+		server := httptest.NewServer(forwardProxy(name, "", "", nil))
+		defer server.Close()
+		proxies = append(proxies, server.URL)
+	}
+
+	// The proxies answer for the hosts themselves, so the hosts don't need to exist
+	urls := []string{
+		"http://one.example/1", "http://two.example/1", "http://one.example/2",
+		"http://two.example/2", "http://three.example/1", "http://one.example/3",
+	}
+
+	tests := []struct {
+		rotation fetchers.ProxyRotation
+		check    func(t *testing.T, used []string)
+	}{
+		{
+			rotation: fetchers.ProxyRoundRobin,
+			check: func(t *testing.T, used []string) {
+				assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, used)
+			},
+		},
+		{
+			rotation: fetchers.ProxyRandom,
+			check: func(t *testing.T, used []string) {
+				for _, name := range used {
+					assert.Contains(t, []string{"a", "b", "c"}, name)
+				}
+			},
+		},
+		{
+			rotation: fetchers.ProxyStickyPerHost,
+			check: func(t *testing.T, used []string) {
+				assert.Equal(t, []string{"a", "b", "a", "b", "c", "a"}, used)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.rotation), func(t *testing.T) {
+			fetcher, err := fetchers.NewProxyPoolFetcher(fetchers.ProxyPoolOptions{Proxies: proxies, Rotation: tt.rotation})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var used []string
+			for _, u := range urls {
+				body, _, err := fetchBody(t, fetcher, u)
+				assert.NoError(t, err)
+				assert.True(t, strings.HasSuffix(body, " "+u), body)
+				used = append(used, strings.SplitN(body, " ", 2)[0])
+			}
+			tt.check(t, used)
+		})
+	}
+}
+
+func TestProxyPoolFetcherHealth(t *testing.T) {
+	failing := http.StatusBadGateway
+	bad := httptest.NewServer(forwardProxy("bad", "", "", &failing))
+	defer bad.Close()
+	good := httptest.NewServer(forwardProxy("good", "", "", nil))
+	defer good.Close()
+
+	fetcher, err := fetchers.NewProxyPoolFetcher(fetchers.ProxyPoolOptions{
+		Proxies:          []string{bad.URL, good.URL},
+		FailureThreshold: 2,
+		Cooldown:         100 * time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Round robin alternates until the bad proxy has failed twice, then only the good one is used
+	var used []string
+	for i := 0; i < 6; i++ {
+		_, info, _ := fetchBody(t, fetcher, "http://example.com/")
+		used = append(used, info.Proxy)
+	}
+	assert.Equal(t, []string{bad.URL, good.URL, bad.URL, good.URL, good.URL, good.URL}, used)
+
+	status := fetcher.Status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, 2, status[0].Failures)
+	assert.True(t, status[1].Healthy)
+
+	// After the cooldown the bad proxy gets another chance, and a single failure takes it out again
+	time.Sleep(150 * time.Millisecond)
+	failing = 0
+	assert.True(t, fetcher.Status()[0].Healthy)
+	for i := 0; i < 2; i++ {
+		_, info, err := fetchBody(t, fetcher, "http://example.com/")
+		assert.NoError(t, err)
+		used = append(used, info.Proxy)
+	}
+	assert.Contains(t, used[6:], bad.URL)
+	assert.Equal(t, 0, fetcher.Status()[0].Failures)
+
+	// Once every proxy is out, requests fail right away
+	failing = http.StatusServiceUnavailable
+	single, err := fetchers.NewProxyPoolFetcher(fetchers.ProxyPoolOptions{Proxies: []string{bad.URL}, FailureThreshold: 1})
+	assert.NoError(t, err)
+	_, _, _ = fetchBody(t, single, "http://example.com/")
+	_, _, err = fetchBody(t, single, "http://example.com/")
+	assert.True(t, errors.Is(err, fetchers.ErrNoHealthyProxy))
+}
+
+func TestNewProxyPoolFetcherErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts fetchers.ProxyPoolOptions
+	}{
+		{name: "no proxies", opts: fetchers.ProxyPoolOptions{}},
+		{name: "unsupported scheme", opts: fetchers.ProxyPoolOptions{Proxies: []string{"ftp://proxy:21"}}},
+		{name: "missing host", opts: fetchers.ProxyPoolOptions{Proxies: []string{"http://"}}},
+		{name: "unknown rotation", opts: fetchers.ProxyPoolOptions{Proxies: []string{"http://proxy:8080"}, Rotation: "lru"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetchers.NewProxyPoolFetcher(tt.opts)
+			assert.Error(t, err)
+		})
+	}
+}
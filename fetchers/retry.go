@@ -0,0 +1,292 @@
+package fetchers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/octetic/gophetch/httpclient"
+)
+
+// ErrCircuitOpen is returned by RetryPolicy.Fetch when the fetcher has failed too often recently and is taken out of
+// rotation until its cooldown has passed.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// StatusError is returned by RetryPolicy.Fetch when the fetcher responded with a failing status code. The response
+// body has already been closed.
+type StatusError struct {
+	// Fetcher is the name of the fetcher that returned the response.
+	Fetcher string
+	// StatusCode is the status code of the last response.
+	StatusCode int
+	// RetryAfter is the delay requested by the Retry-After header of the last response, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status code %d", e.Fetcher, e.StatusCode)
+}
+
+// RetryOptions configures a RetryPolicy.
+type RetryOptions struct {
+	// MaxAttempts is the number of times a fetcher is tried before falling through to the next one. Default is 3.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every retry, with some jitter added. Default is
+	// 250ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries. A Retry-After header asking for a longer delay stops retrying the
+	// fetcher. Default is 10s.
+	MaxDelay time.Duration
+	// RetryStatuses are the status codes that are retried. Default is 408, 425, 429, 500, 502, 503 and 504.
+	RetryStatuses []int
+	// BreakerThreshold is the number of consecutive failed fetches after which a fetcher's circuit breaker opens.
+	// Any error and retryable status counts as a failure, but not a cancelled context, a blocked destination or a
+	// status that isn't retried. Default is 5, a negative value disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit breaker keeps the fetcher out of rotation. Once it has passed the
+	// fetcher is tried again, and a single failure opens the breaker again. Default is 30s.
+	BreakerCooldown time.Duration
+}
+
+// RetryPolicy wraps the fetches made through the fetcher chain. Retryable statuses and network errors are retried
+// with exponential backoff, honouring the Retry-After header. Any other failing status (400 and above) is returned
+// as a *StatusError right away, so the caller can fall through to the next fetcher. Every fetcher has a circuit
+// breaker, keyed by its name, that takes it out of rotation after repeated failures.
+//
+// A RetryPolicy is safe for concurrent use, and is meant to be shared by all the requests going through a chain.
+type RetryPolicy struct {
+	maxAttempts      int
+	baseDelay        time.Duration
+	maxDelay         time.Duration
+	retryStatuses    map[int]bool
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// NewRetryPolicy creates a new RetryPolicy with the given options.
+func NewRetryPolicy(opts RetryOptions) *RetryPolicy {
+	p := &RetryPolicy{
+		maxAttempts:      3,
+		baseDelay:        250 * time.Millisecond,
+		maxDelay:         10 * time.Second,
+		breakerThreshold: 5,
+		breakerCooldown:  30 * time.Second,
+		breakers:         make(map[string]*breaker),
+	}
+	if opts.MaxAttempts > 0 {
+		p.maxAttempts = opts.MaxAttempts
+	}
+	if opts.BaseDelay > 0 {
+		p.baseDelay = opts.BaseDelay
+	}
+	if opts.MaxDelay > 0 {
+		p.maxDelay = opts.MaxDelay
+	}
+	if opts.BreakerThreshold != 0 {
+		p.breakerThreshold = opts.BreakerThreshold
+	}
+	if opts.BreakerCooldown > 0 {
+		p.breakerCooldown = opts.BreakerCooldown
+	}
+
+	statuses := opts.RetryStatuses
+	if len(statuses) == 0 {
+		statuses = []int{
+			http.StatusRequestTimeout,
+			http.StatusTooEarly,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+	p.retryStatuses = make(map[int]bool, len(statuses))
+	for _, status := range statuses {
+		p.retryStatuses[status] = true
+	}
+
+	return p
+}
+
+// Fetch fetches the HTML from the given URL using the given fetcher, retrying according to the policy. It returns
+// an error wrapping ErrCircuitOpen without calling the fetcher if its circuit breaker is open, and a *StatusError if
+// the fetcher's last response had a failing status.
+func (p *RetryPolicy) Fetch(ctx context.Context, fetcher HTMLFetcher, url string) (*http.Response, io.ReadCloser, error) {
+	name := fetcher.Name()
+	if !p.allow(name, time.Now()) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCircuitOpen, name)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, body, err := FetchHTMLContext(ctx, fetcher, url)
+		if err == nil && resp == nil {
+			closeBody(body)
+			err = fmt.Errorf("%s: no response", name)
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, httpclient.ErrBlockedDestination) {
+				return nil, nil, err
+			}
+			if !isRetryableError(err) {
+				// Errors such as a missing API key or an unusable response won't go away by retrying, but still
+				// count against the fetcher
+				p.record(name, false, time.Now())
+				return nil, nil, err
+			}
+		case resp.StatusCode < http.StatusBadRequest:
+			p.record(name, true, time.Now())
+			return resp, body, nil
+		default:
+			closeBody(body)
+			statusErr := &StatusError{
+				Fetcher:    name,
+				StatusCode: resp.StatusCode,
+				RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+			if !p.retryStatuses[resp.StatusCode] {
+				return nil, nil, statusErr
+			}
+			err, delay = statusErr, statusErr.RetryAfter
+		}
+
+		// The fetch failed in a way that may go away by itself
+		if attempt >= p.maxAttempts || delay > p.maxDelay {
+			p.record(name, false, time.Now())
+			return nil, nil, err
+		}
+		if delay == 0 {
+			delay = p.backoff(attempt)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return nil, nil, sleepErr
+		}
+	}
+}
+
+// allow reports whether the circuit breaker of the given fetcher lets a request through.
+func (p *RetryPolicy) allow(name string, now time.Time) bool {
+	if p.breakerThreshold < 0 {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.breakers[name]
+	return !ok || !now.Before(b.openUntil)
+}
+
+// record updates the circuit breaker of the given fetcher with the outcome of a fetch.
+func (p *RetryPolicy) record(name string, success bool, now time.Time) {
+	if p.breakerThreshold < 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.breakers[name]
+	if !ok {
+		b = &breaker{}
+		p.breakers[name] = b
+	}
+
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= p.breakerThreshold {
+		b.openUntil = now.Add(p.breakerCooldown)
+	}
+}
+
+// backoff returns the delay before the given retry: the base delay doubled for every previous attempt and capped
+// at the maximum, of which a random half is added as jitter.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isRetryableError reports whether a fetch error is a network error that may go away when retrying.
+func isRetryableError(err error) bool {
+	if errors.Is(err, httpclient.ErrBlockedDestination) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	// Every error returned by http.Client is a *url.Error, which is a net.Error itself, so look at what it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date.
+// It returns zero if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// sleep waits for the given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func closeBody(body io.ReadCloser) {
+	if body != nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(body, 4096))
+		_ = body.Close()
+	}
+}
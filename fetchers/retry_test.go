@@ -0,0 +1,205 @@
+package fetchers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+)
+
+// countingFetcher counts the calls made to the standard fetcher it wraps.
+type countingFetcher struct {
+	fetchers.StandardHTTPFetcher
+	calls int32
+}
+
+func (f *countingFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return f.StandardHTTPFetcher.FetchHTMLContext(ctx, url)
+}
+
+// statusServer responds with the given statuses in order, and with 200 once they have all been used.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) *httptest.Server {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []int
+		retryAfter     string
+		expectedStatus int
+		expectedCalls  int32
+	}{
+		{name: "succeeds first time", expectedStatus: http.StatusOK, expectedCalls: 1},
+		{name: "retries unavailable", statuses: []int{503, 502}, expectedStatus: http.StatusOK, expectedCalls: 3},
+		{name: "gives up after max attempts", statuses: []int{503, 503, 503}, expectedStatus: 503, expectedCalls: 3},
+		{name: "does not retry not found", statuses: []int{404}, expectedStatus: 404, expectedCalls: 1},
+		{name: "does not retry forbidden", statuses: []int{403}, expectedStatus: 403, expectedCalls: 1},
+		{name: "gives up on long retry after", statuses: []int{429}, retryAfter: "120", expectedStatus: 429, expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := statusServer(t, tt.retryAfter, tt.statuses...)
+			policy := fetchers.NewRetryPolicy(fetchers.RetryOptions{BaseDelay: time.Millisecond})
+			fetcher := &countingFetcher{}
+
+			resp, body, err := policy.Fetch(context.Background(), fetcher, server.URL)
+			assert.Equal(t, tt.expectedCalls, fetcher.calls)
+			if tt.expectedStatus == http.StatusOK {
+				if assert.NoError(t, err) {
+					_ = body.Close()
+					assert.Equal(t, http.StatusOK, resp.StatusCode)
+				}
+				return
+			}
+
+			var statusErr *fetchers.StatusError
+			if assert.ErrorAs(t, err, &statusErr) {
+				assert.Equal(t, tt.expectedStatus, statusErr.StatusCode)
+				assert.Equal(t, "standard", statusErr.Fetcher)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	server := statusServer(t, "1", http.StatusTooManyRequests)
+	policy := fetchers.NewRetryPolicy(fetchers.RetryOptions{BaseDelay: time.Millisecond})
+
+	start := time.Now()
+	_, body, err := policy.Fetch(context.Background(), &fetchers.StandardHTTPFetcher{}, server.URL)
+	if assert.NoError(t, err) {
+		_ = body.Close()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRetryPolicyCircuitBreaker(t *testing.T) {
+	// A server that has been shut down refuses connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	policy := fetchers.NewRetryPolicy(fetchers.RetryOptions{
+		MaxAttempts:      2,
+		BaseDelay:        time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  100 * time.Millisecond,
+	})
+	fetcher := &countingFetcher{}
+
+	for i := 0; i < 2; i++ {
+		_, _, err := policy.Fetch(context.Background(), fetcher, server.URL)
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, fetchers.ErrCircuitOpen))
+	}
+	assert.Equal(t, int32(4), fetcher.calls)
+
+	// The breaker is open, so the fetcher isn't called
+	_, _, err := policy.Fetch(context.Background(), fetcher, server.URL)
+	assert.ErrorIs(t, err, fetchers.ErrCircuitOpen)
+	assert.Equal(t, int32(4), fetcher.calls)
+
+	// Once the cooldown has passed the fetcher is tried again, and a single failure opens the breaker again
+	time.Sleep(150 * time.Millisecond)
+	_, _, err = policy.Fetch(context.Background(), fetcher, server.URL)
+	assert.False(t, errors.Is(err, fetchers.ErrCircuitOpen))
+	assert.Equal(t, int32(6), fetcher.calls)
+
+	_, _, err = policy.Fetch(context.Background(), fetcher, server.URL)
+	assert.ErrorIs(t, err, fetchers.ErrCircuitOpen)
+}
+
+// resultFetcher returns the given result, and counts its calls.
+type resultFetcher struct {
+	fetchers.StandardHTTPFetcher
+	resp  *http.Response
+	body  io.ReadCloser
+	err   error
+	calls int32
+}
+
+func (f *resultFetcher) FetchHTMLContext(_ context.Context, _ string) (*http.Response, io.ReadCloser, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return f.resp, f.body, f.err
+}
+
+// closeRecorder records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRetryPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		fetcher      *resultFetcher
+		opensBreaker bool
+	}{
+		{name: "plain error", fetcher: &resultFetcher{err: errors.New("unable to find HTML content")}, opensBreaker: true},
+		{name: "no response", fetcher: &resultFetcher{body: &closeRecorder{Reader: strings.NewReader("")}}, opensBreaker: true},
+		{name: "cancelled", fetcher: &resultFetcher{err: context.Canceled}},
+		{name: "blocked destination", fetcher: &resultFetcher{err: httpclient.ErrBlockedDestination}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := fetchers.NewRetryPolicy(fetchers.RetryOptions{BaseDelay: time.Millisecond, BreakerThreshold: 2})
+			for i := 0; i < 2; i++ {
+				resp, body, err := policy.Fetch(context.Background(), tt.fetcher, "https://example.com")
+				assert.Error(t, err)
+				assert.Nil(t, resp)
+				assert.Nil(t, body)
+			}
+			assert.Equal(t, int32(2), tt.fetcher.calls)
+			if recorder, ok := tt.fetcher.body.(*closeRecorder); ok {
+				assert.True(t, recorder.closed)
+			}
+
+			_, _, err := policy.Fetch(context.Background(), tt.fetcher, "https://example.com")
+			assert.Equal(t, tt.opensBreaker, errors.Is(err, fetchers.ErrCircuitOpen))
+		})
+	}
+}
+
+func TestRetryPolicyContext(t *testing.T) {
+	server := statusServer(t, "", 503, 503, 503)
+	policy := fetchers.NewRetryPolicy(fetchers.RetryOptions{BaseDelay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := policy.Fetch(ctx, &fetchers.StandardHTTPFetcher{}, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
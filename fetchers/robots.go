@@ -0,0 +1,426 @@
+package fetchers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/metadata"
+)
+
+// ErrDisallowedByRobots is wrapped by the *RobotsError returned for URLs that robots.txt doesn't allow fetching.
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+const (
+	// defaultRobotsTTL is how long a robots.txt file is cached.
+	defaultRobotsTTL = 24 * time.Hour
+	// robotsErrorTTL is how long the outcome of a failed robots.txt request is cached, so an unreachable server
+	// is tried again soon.
+	robotsErrorTTL = time.Minute
+	// maxRobotsSize is the most of a robots.txt file that is parsed. RFC 9309 requires at least 500 KiB.
+	maxRobotsSize = 500 * 1024
+)
+
+// RobotsError is returned by RobotsFetcher for URLs that robots.txt doesn't allow fetching. It wraps
+// ErrDisallowedByRobots.
+type RobotsError struct {
+	// URL is the URL that was refused.
+	URL string
+	// UserAgent is the user agent the rules were looked up for.
+	UserAgent string
+	// Rule is the Disallow pattern that matched, or an empty string if the whole host is unavailable because its
+	// robots.txt couldn't be fetched.
+	Rule string
+}
+
+func (e *RobotsError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s: %s: robots.txt is unreachable", ErrDisallowedByRobots, e.URL)
+	}
+	return fmt.Sprintf("%s: %s matches %q", ErrDisallowedByRobots, e.URL, e.Rule)
+}
+
+func (e *RobotsError) Unwrap() error {
+	return ErrDisallowedByRobots
+}
+
+// CrawlDelayer is implemented by fetchers that know how long to wait between two requests to the same host, such
+// as RobotsFetcher. Batch and politeness schedulers use it to space out their requests.
+type CrawlDelayer interface {
+	// CrawlDelay returns the minimum delay between two requests to the host of the given URL, or zero if there is
+	// none.
+	CrawlDelay(ctx context.Context, url string) time.Duration
+}
+
+// CrawlDelay returns the crawl delay of the given fetcher for the host of the given URL, or zero if the fetcher
+// doesn't implement CrawlDelayer.
+func CrawlDelay(ctx context.Context, fetcher HTMLFetcher, url string) time.Duration {
+	if cd, ok := fetcher.(CrawlDelayer); ok {
+		return cd.CrawlDelay(ctx, url)
+	}
+	return 0
+}
+
+// Robots holds the rules of a robots.txt file, see RFC 9309.
+type Robots struct {
+	groups []robotsGroup
+	// disallowAll is set for hosts whose robots.txt couldn't be fetched, as RFC 9309 asks to assume a complete
+	// disallow when the server fails.
+	disallowAll bool
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// ParseRobots parses a robots.txt file. Lines that can't be understood are ignored, as the format asks.
+func ParseRobots(data []byte) *Robots {
+	robots := &Robots{}
+	if len(data) > maxRobotsSize {
+		data = data[:maxRobotsSize]
+	}
+
+	var current *robotsGroup
+	// A group starts with one or more user-agent lines, and ends at the first user-agent line after its rules
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), maxRobotsSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				robots.groups = append(robots.groups, robotsGroup{})
+				current = &robots.groups[len(robots.groups)-1]
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// An empty Disallow allows everything, which is the default
+			if value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return robots
+}
+
+// Allowed reports whether the given user agent may fetch the given URL. When it may not, the Disallow pattern that
+// matched is returned as well. The most specific rule wins, and Allow wins a tie.
+func (r *Robots) Allowed(userAgent, rawURL string) (bool, string) {
+	if r.disallowAll {
+		return false, ""
+	}
+
+	path := "/"
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.EscapedPath()
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		if path == "" {
+			path = "/"
+		}
+	}
+	if path == "/robots.txt" {
+		return true, ""
+	}
+
+	var match *robotsRule
+	for _, group := range r.groupsFor(userAgent) {
+		for i, rule := range group.rules {
+			if !robotsMatch(rule.pattern, path) {
+				continue
+			}
+			if match == nil || len(rule.pattern) > len(match.pattern) ||
+				(len(rule.pattern) == len(match.pattern) && rule.allow && !match.allow) {
+				match = &group.rules[i]
+			}
+		}
+	}
+	if match == nil || match.allow {
+		return true, ""
+	}
+	return false, match.pattern
+}
+
+// CrawlDelay returns the Crawl-delay for the given user agent, or zero if there is none.
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, group := range r.groupsFor(userAgent) {
+		if group.crawlDelay > delay {
+			delay = group.crawlDelay
+		}
+	}
+	return delay
+}
+
+// groupsFor returns the groups that apply to a user agent: the groups naming the longest prefix of its product
+// token, such as "gophetch" for "Gophetch/1.0", or the "*" groups if none does. Groups naming the same agent are
+// merged, as RFC 9309 asks.
+func (r *Robots) groupsFor(userAgent string) []robotsGroup {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	best := ""
+	for _, group := range r.groups {
+		for _, agent := range group.agents {
+			if agent != "*" && agent != "" && strings.HasPrefix(token, agent) && len(agent) > len(best) {
+				best = agent
+			}
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+
+	var groups []robotsGroup
+	for _, group := range r.groups {
+		for _, agent := range group.agents {
+			if agent == best {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// robotsMatch reports whether a path matches a robots.txt pattern. Patterns match a prefix of the path, "*" matches
+// any sequence of characters and a trailing "$" anchors the pattern to the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			// The last part has to end the path, as far right as possible
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+// RobotsFetcher is an HTMLFetcher that honours robots.txt. The robots.txt file of every host is fetched once and
+// cached, and URLs it disallows for UserAgent are refused with a *RobotsError instead of being fetched. A
+// robots.txt that doesn't exist allows everything, while a server error disallows the whole host, as RFC 9309 asks.
+//
+// RobotsFetcher implements CrawlDelayer, so the Crawl-delay of a host is available to the scheduler spreading the
+// requests.
+type RobotsFetcher struct {
+	// Fetcher is the fetcher used for the allowed URLs.
+	Fetcher HTMLFetcher
+	// UserAgent is the user agent the rules are looked up for. Its product token, such as "gophetch" for
+	// "Gophetch/1.0", is matched against the user-agent lines. It is also sent when fetching robots.txt.
+	UserAgent string
+	// Client is the HTTP client used to fetch robots.txt. If nil, the client carried by the request's context is
+	// used, falling back to http.DefaultClient.
+	Client *http.Client
+	// TTL is how long a robots.txt file is cached. Default is 24 hours.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	robots  *Robots
+	expires time.Time
+	// err is set if the request fetching robots.txt was cancelled, the entry is then dropped from the cache
+	err error
+	// ready is closed once robots is set, so concurrent requests for a host wait for a single fetch
+	ready chan struct{}
+}
+
+// NewRobotsFetcher creates a new RobotsFetcher that fetches the URLs allowed for the given user agent with the given
+// fetcher.
+func NewRobotsFetcher(fetcher HTMLFetcher, userAgent string) *RobotsFetcher {
+	return &RobotsFetcher{Fetcher: fetcher, UserAgent: userAgent}
+}
+
+func (r *RobotsFetcher) Name() string {
+	return r.Fetcher.Name()
+}
+
+func (r *RobotsFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return r.FetchHTMLContext(context.Background(), url)
+}
+
+func (r *RobotsFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	robots, err := r.Robots(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	if allowed, rule := robots.Allowed(r.UserAgent, url); !allowed {
+		return nil, nil, &RobotsError{URL: url, UserAgent: r.UserAgent, Rule: rule}
+	}
+	return FetchHTMLContext(ctx, r.Fetcher, url)
+}
+
+func (r *RobotsFetcher) HasMetadata() bool {
+	return r.Fetcher.HasMetadata()
+}
+
+func (r *RobotsFetcher) Metadata() metadata.Metadata {
+	return r.Fetcher.Metadata()
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt sets for the host of the given URL. It is zero if there is none, or
+// if robots.txt can't be fetched.
+func (r *RobotsFetcher) CrawlDelay(ctx context.Context, url string) time.Duration {
+	robots, err := r.Robots(ctx, url)
+	if err != nil {
+		return 0
+	}
+	return robots.CrawlDelay(r.UserAgent)
+}
+
+// Robots returns the robots.txt rules for the host of the given URL, fetching them if they aren't cached. An error
+// is only returned for invalid URLs or when the context is done.
+func (r *RobotsFetcher) Robots(ctx context.Context, rawURL string) (*Robots, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("robots.txt: unsupported URL %s", rawURL)
+	}
+	key := u.Scheme + "://" + strings.ToLower(u.Host)
+
+	for {
+		r.mu.Lock()
+		if r.hosts == nil {
+			r.hosts = make(map[string]*robotsEntry)
+		}
+		entry, found := r.hosts[key]
+		if found {
+			select {
+			case <-entry.ready:
+				found = entry.err == nil && time.Now().Before(entry.expires)
+			default:
+			}
+		}
+		if !found {
+			entry = &robotsEntry{ready: make(chan struct{})}
+			r.hosts[key] = entry
+		}
+		r.mu.Unlock()
+
+		if !found {
+			robots, ttl := r.fetchRobots(ctx, key+"/robots.txt")
+			entry.expires = time.Now().Add(ttl)
+			entry.robots = robots
+			if err := ctx.Err(); err != nil {
+				// The request was cut short, so its outcome says nothing about the host
+				entry.err = err
+				r.mu.Lock()
+				if r.hosts[key] == entry {
+					delete(r.hosts, key)
+				}
+				r.mu.Unlock()
+			}
+			close(entry.ready)
+			return entry.robots, entry.err
+		}
+
+		select {
+		case <-entry.ready:
+			if entry.err == nil {
+				return entry.robots, nil
+			}
+			// The request that was fetching robots.txt gave up, try again with ours
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetchRobots fetches and parses a robots.txt file, and returns how long the result may be cached.
+func (r *RobotsFetcher) fetchRobots(ctx context.Context, robotsURL string) (*Robots, time.Duration) {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = defaultRobotsTTL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return &Robots{disallowAll: true}, robotsErrorTTL
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+
+	resp, err := httpclient.Resolve(ctx, r.Client).Do(req)
+	if err != nil {
+		return &Robots{disallowAll: true}, robotsErrorTTL
+	}
+	defer closeBody(resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+		if err != nil {
+			return &Robots{disallowAll: true}, robotsErrorTTL
+		}
+		return ParseRobots(data), ttl
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		// No robots.txt, or one we are not allowed to see, means there are no rules
+		return &Robots{}, ttl
+	default:
+		return &Robots{disallowAll: true}, robotsErrorTTL
+	}
+}
@@ -0,0 +1,144 @@
+package fetchers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/fetchers"
+)
+
+const testRobots = `# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public-*.html$
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 2
+
+User-agent: Gophetch
+User-agent: otherbot
+Disallow: /no-gophetch
+Crawl-delay: 0.5
+
+User-agent: gophetch
+Allow: /no-gophetch/except
+`
+
+func TestRobotsAllowed(t *testing.T) {
+	robots := fetchers.ParseRobots([]byte(testRobots))
+
+	tests := []struct {
+		name         string
+		userAgent    string
+		url          string
+		expected     bool
+		expectedRule string
+	}{
+		{"no matching rule", "SomeBot/2.0", "https://example.com/articles/1", true, ""},
+		{"prefix", "SomeBot/2.0", "https://example.com/private/notes.html", false, "/private/"},
+		{"longer allow wins", "SomeBot/2.0", "https://example.com/private/public-1.html", true, ""},
+		{"anchored allow doesn't match", "SomeBot/2.0", "https://example.com/private/public-1.html?x=1", false, "/private/"},
+		{"wildcard and anchor", "SomeBot/2.0", "https://example.com/docs/file.pdf", false, "/*.pdf$"},
+		{"anchor requires the end", "SomeBot/2.0", "https://example.com/docs/file.pdf.html", true, ""},
+		{"query", "SomeBot/2.0", "https://example.com/search?q=go", false, "/search?"},
+		{"robots.txt is always allowed", "SomeBot/2.0", "https://example.com/robots.txt", true, ""},
+		{"own group replaces the default", "Gophetch/1.0", "https://example.com/private/notes.html", true, ""},
+		{"own group", "Gophetch/1.0", "https://example.com/no-gophetch/page", false, "/no-gophetch"},
+		{"merged groups", "Gophetch/1.0", "https://example.com/no-gophetch/except", true, ""},
+		{"group with several agents", "OtherBot", "https://example.com/no-gophetch", false, "/no-gophetch"},
+		{"agent prefix", "otherbot-news/1.0", "https://example.com/no-gophetch", false, "/no-gophetch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, rule := robots.Allowed(tt.userAgent, tt.url)
+			assert.Equal(t, tt.expected, allowed)
+			assert.Equal(t, tt.expectedRule, rule)
+		})
+	}
+
+	assert.Equal(t, 2*time.Second, robots.CrawlDelay("SomeBot"))
+	assert.Equal(t, 500*time.Millisecond, robots.CrawlDelay("Gophetch/1.0"))
+}
+
+func TestRobotsFetcher(t *testing.T) {
+	tests := []struct {
+		name          string
+		robotsStatus  int
+		path          string
+		expectedError bool
+		expectedRule  string
+		expectedDelay time.Duration
+	}{
+		{name: "allowed", robotsStatus: http.StatusOK, path: "/articles/1", expectedDelay: 500 * time.Millisecond},
+		{name: "disallowed", robotsStatus: http.StatusOK, path: "/no-gophetch", expectedError: true, expectedRule: "/no-gophetch", expectedDelay: 500 * time.Millisecond},
+		{name: "missing robots.txt", robotsStatus: http.StatusNotFound, path: "/no-gophetch"},
+		{name: "server error", robotsStatus: http.StatusServiceUnavailable, path: "/articles/1", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var robotsRequests, pageRequests int32
+			var userAgent atomic.Value
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					atomic.AddInt32(&robotsRequests, 1)
+					userAgent.Store(r.UserAgent())
+					w.WriteHeader(tt.robotsStatus)
+					_, _ = w.Write([]byte(testRobots))
+					return
+				}
+				atomic.AddInt32(&pageRequests, 1)
+				_, _ = w.Write([]byte("<html></html>"))
+			}))
+			defer server.Close()
+
+			fetcher := fetchers.NewRobotsFetcher(&fetchers.StandardHTTPFetcher{}, "Gophetch/1.0")
+
+			// Concurrent requests share a single robots.txt request
+			var wg sync.WaitGroup
+			errs := make([]error, 3)
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					resp, body, err := fetcher.FetchHTMLContext(context.Background(), server.URL+tt.path)
+					errs[i] = err
+					if err == nil {
+						assert.Equal(t, http.StatusOK, resp.StatusCode)
+						_ = body.Close()
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			for _, err := range errs {
+				if !tt.expectedError {
+					assert.NoError(t, err)
+					continue
+				}
+				assert.True(t, errors.Is(err, fetchers.ErrDisallowedByRobots))
+				var robotsErr *fetchers.RobotsError
+				if assert.True(t, errors.As(err, &robotsErr)) {
+					assert.Equal(t, tt.expectedRule, robotsErr.Rule)
+					assert.Equal(t, server.URL+tt.path, robotsErr.URL)
+				}
+			}
+
+			assert.Equal(t, int32(1), atomic.LoadInt32(&robotsRequests))
+			assert.Equal(t, "Gophetch/1.0", userAgent.Load())
+			if tt.expectedError {
+				assert.Equal(t, int32(0), atomic.LoadInt32(&pageRequests))
+			}
+			assert.Equal(t, tt.expectedDelay, fetcher.CrawlDelay(context.Background(), server.URL+"/"))
+		})
+	}
+}
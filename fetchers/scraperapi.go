@@ -1,11 +1,13 @@
 package fetchers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/metadata"
 )
 
@@ -23,6 +25,9 @@ type ScraperapiFetcher struct {
 	SessionNumber   *int    // default: nil
 	BinaryTarget    *bool   // default: false
 	UseOwnHeaders   *bool   // default: false
+	// Client is the HTTP client used for requests. If nil, the client carried by the request's context is used,
+	// falling back to http.DefaultClient.
+	Client *http.Client
 }
 
 func (s *ScraperapiFetcher) Name() string {
@@ -30,7 +35,10 @@ func (s *ScraperapiFetcher) Name() string {
 }
 
 func (s *ScraperapiFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadCloser, error) {
-	//fmt.Println("Fetching HTML from Scraperapi")
+	return s.FetchHTMLContext(context.Background(), targetURL)
+}
+
+func (s *ScraperapiFetcher) FetchHTMLContext(ctx context.Context, targetURL string) (*http.Response, io.ReadCloser, error) {
 	const endpoint = "https://api.scraperapi.com"
 
 	// Create the URL with the token in the query parameters
@@ -79,14 +87,12 @@ func (s *ScraperapiFetcher) FetchHTML(targetURL string) (*http.Response, io.Read
 	urlString := u.String()
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("GET", urlString, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Create a new HTTP client and make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Resolve(httpclient.WithoutSession(ctx), s.Client).Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
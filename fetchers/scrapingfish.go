@@ -1,10 +1,12 @@
 package fetchers
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
 
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/metadata"
 )
 
@@ -12,6 +14,9 @@ import (
 // HTML from the given URL. This fetcher does not return metadata.
 type ScrapingfishFetcher struct {
 	APIKey string
+	// Client is the HTTP client used for requests. If nil, the client carried by the request's context is used,
+	// falling back to http.DefaultClient.
+	Client *http.Client
 }
 
 func (s *ScrapingfishFetcher) Name() string {
@@ -19,7 +24,10 @@ func (s *ScrapingfishFetcher) Name() string {
 }
 
 func (s *ScrapingfishFetcher) FetchHTML(targetURL string) (*http.Response, io.ReadCloser, error) {
-	//fmt.Println("Fetching HTML from Scrapingfish")
+	return s.FetchHTMLContext(context.Background(), targetURL)
+}
+
+func (s *ScrapingfishFetcher) FetchHTMLContext(ctx context.Context, targetURL string) (*http.Response, io.ReadCloser, error) {
 	const endpoint = "https://scraping.narf.ai/api/v1/"
 
 	// Create the URL with the token in the query parameters
@@ -36,14 +44,12 @@ func (s *ScrapingfishFetcher) FetchHTML(targetURL string) (*http.Response, io.Re
 	urlString := u.String()
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("GET", urlString, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Create a new HTTP client and make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Resolve(httpclient.WithoutSession(ctx), s.Client).Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1,27 +1,58 @@
 package fetchers
 
 import (
+	"context"
 	"io"
 	"net/http"
 
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/metadata"
 )
 
 // StandardHTTPFetcher is the struct that encapsulates the standard HTTP fetcher using the standard library.
-// It does not support metadata.
-type StandardHTTPFetcher struct{}
+// It does not support metadata. Headers carried by the context, see httpclient.WithHeader, are sent with the request.
+//
+// Responses compressed with gzip, deflate or brotli are decoded, and the body is read within BodyLimits, see
+// LimitBody.
+type StandardHTTPFetcher struct {
+	// Client is the HTTP client used for requests. If nil, the client carried by the request's context is used,
+	// falling back to http.DefaultClient.
+	Client *http.Client
+	// Limits bounds the size of the body and the time it takes to read it. If nil, the limits carried by the
+	// request's context are used, see WithBodyLimits, falling back to the default limits.
+	Limits *BodyLimits
+}
 
 func (s *StandardHTTPFetcher) Name() string {
 	return "standard"
 }
 
 func (s *StandardHTTPFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
-	//fmt.Println("Fetching HTML from Standard HTTP")
+	return s.FetchHTMLContext(context.Background(), url)
+}
+
+func (s *StandardHTTPFetcher) FetchHTMLContext(ctx context.Context, url string) (*http.Response, io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setAcceptEncoding(req)
+	httpclient.ApplyHeader(ctx, req)
 
-	resp, err := http.Get(url)
+	resp, err := httpclient.Resolve(ctx, s.Client).Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
+	setFinalURL(ctx, resp)
+
+	limits := BodyLimitsFromContext(ctx)
+	if s.Limits != nil {
+		limits = *s.Limits
+	}
+	if err := LimitBody(ctx, resp, limits); err != nil {
+		_ = resp.Body.Close()
+		return nil, nil, err
+	}
 
 	return resp, resp.Body, nil
 }
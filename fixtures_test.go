@@ -0,0 +1,76 @@
+package gophetch_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/fetchers"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var icon bytes.Buffer
+	_ = png.Encode(&icon, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/favicon.ico":
+			w.Header().Set("Content-Type", "image/x-icon")
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(icon.Bytes())
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head><title>Recorded</title></head><body></body></html>`))
+		}
+	}))
+
+	dir := t.TempDir()
+	pageURL := server.URL + "/article"
+	readable := `<p><img src="` + server.URL + `/image.png"></p>`
+
+	// Record the page, the favicon probe and the image
+	recordingClient := &http.Client{Transport: &fetchers.RecordingTransport{Dir: dir}}
+	g := gophetch.New(&fetchers.RecordingFetcher{Fetcher: &fetchers.StandardHTTPFetcher{}, Dir: dir})
+	g.SetHTTPClient(recordingClient)
+	recorded, err := g.FetchAndParseContext(context.Background(), pageURL)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/favicon.ico", recorded.Metadata.FaviconURL)
+
+	inliner := gophetch.NewImageInliner(gophetch.ImageInlinerOptions{HTTPClient: recordingClient})
+	recordedHTML, err := inliner.InlineImagesContext(context.Background(), readable)
+	assert.NoError(t, err)
+	assert.Contains(t, recordedHTML, "data:image/png;base64,")
+
+	// Replay everything with the server gone
+	server.Close()
+
+	replayClient := &http.Client{Transport: &fetchers.ReplayTransport{Dir: dir}}
+	g = gophetch.New(&fetchers.ReplayFetcher{Dir: dir})
+	g.SetHTTPClient(replayClient)
+	replayed, err := g.FetchAndParseContext(context.Background(), pageURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Recorded", replayed.Metadata.Title)
+		assert.Equal(t, recorded.Metadata, replayed.Metadata)
+		assert.Equal(t, http.StatusOK, replayed.StatusCode)
+		assert.Equal(t, "replay", replayed.FetcherName)
+	}
+
+	inliner = gophetch.NewImageInliner(gophetch.ImageInlinerOptions{HTTPClient: replayClient})
+	replayedHTML, err := inliner.InlineImagesContext(context.Background(), readable)
+	assert.NoError(t, err)
+	assert.Equal(t, recordedHTML, replayedHTML)
+
+	// A URL that was never recorded fails loudly
+	_, err = g.FetchAndParseContext(context.Background(), server.URL+"/missing")
+	assert.ErrorIs(t, err, fetchers.ErrFixtureNotFound)
+	assert.True(t, strings.Contains(err.Error(), "/missing"))
+}
@@ -2,27 +2,79 @@
 package gophetch
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/html"
 
 	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/media"
 	"github.com/octetic/gophetch/metadata"
+	"github.com/octetic/gophetch/rules"
 	"github.com/octetic/gophetch/sites"
 )
 
-// Gophetch is the main struct that encapsulates the parser, extractor, and fetchers.
+// ErrTimeout is returned when a fetch, parse, or image download runs past its context's deadline or an HTTP timeout.
+// The underlying error, such as context.DeadlineExceeded, is kept in the chain.
+var ErrTimeout = errors.New("timeout exceeded")
+
+// Gophetch is the main struct that encapsulates the extractor, fetchers, and site registry.
+//
+// A single Gophetch is safe for concurrent use once it has been configured. Every call parses into its own Parser
+// and site-specific rules only apply to the request they were selected for, so the shared Extractor and
+// SiteRegistry are never modified while fetching.
 type Gophetch struct {
+	// Parser is no longer used: every call parses the page with its own Parser, and the results are in Result.
+	// It is still set by New so that code using it as a standalone parser keeps working.
+	//
+	// Deprecated: use the HTMLNode, Headers, IsHTML and MimeType fields of Result.
 	Parser       *Parser
 	Extractor    *Extractor
 	Fetchers     []fetchers.HTMLFetcher
 	SiteRegistry map[string]sites.Site
 	Logger       *slog.Logger
+	// HTTPClient is the client used by the default fetcher, the media downloads, and the rules that probe URLs. It
+	// is carried on the request's context, so a client already set there with httpclient.WithClient takes
+	// precedence. Default is http.DefaultClient.
+	HTTPClient *http.Client
+	// RetryPolicy, if set, retries failed fetches, makes responses with a failing status fall through to the next
+	// fetcher, and takes failing fetchers out of rotation. Default is to try every fetcher once and accept any
+	// response.
+	RetryPolicy *fetchers.RetryPolicy
+	// MaxClientRedirects is how many redirects made by the page itself, with a meta refresh or a script assigning
+	// a new location, are followed per fetch. Default is to not follow them.
+	MaxClientRedirects int
+	// Previewer, if set, takes a screenshot of the fetched HTML pages that have no lead image, such as an og:image,
+	// and reports it in Result.Preview. Failures are logged and leave Result.Preview empty.
+	Previewer fetchers.ScreenshotCapturer
+	// PreviewOptions are the options of the screenshots taken by Previewer.
+	PreviewOptions fetchers.BrowserlessScreenshotOptions
+	// Strategy decides which fetchers of the chain fetch a URL, and in which order. Default is OrderedStrategy.
+	Strategy ChainStrategy
+	// EscalateDetected makes the chain pass over the HTML responses that Detect finds to be a bot block or a soft
+	// error, as if the fetcher had failed. If the last fetcher gets one too, a PageError is returned. Default is to
+	// accept them and report them in Result.Blocked and Result.SoftError.
+	EscalateDetected bool
+	// BodyLimits bounds the size of the pages and the time it takes to read them. It applies to the parser and to
+	// the fetchers that read pages themselves, such as fetchers.StandardHTTPFetcher, unless they set their own.
+	// Default is fetchers.DefaultMaxBodySize and fetchers.DefaultMaxDecompressedSize, with no read timeout.
+	BodyLimits *fetchers.BodyLimits
+
+	siteMu sync.RWMutex
+
+	sessionMu sync.Mutex
+	sessions  map[string]*httpclient.Session
 }
 
 // Result is the struct that encapsulates the extracted metadata, along with the response data.
@@ -35,6 +87,41 @@ type Result struct {
 	Response    *http.Response
 	StatusCode  int
 	FetcherName string
+	// Errors holds the non-fatal errors returned by individual rules while extracting the metadata.
+	Errors []error
+	// Kind is the kind of content the URL points to. HTML pages are KindArticle, other kinds of content are
+	// described without being parsed as HTML, see Kind.
+	Kind Kind
+	// Media describes images, audio and video files.
+	Media *media.Media
+	// PDF holds the document information of PDF files.
+	PDF *media.PDFInfo
+	// CacheStatus reports whether the page was served from the cache of a fetchers.CachingFetcher, revalidated, or
+	// fetched. It is empty if the fetcher doesn't cache.
+	CacheStatus fetchers.CacheStatus
+	// FinalURL is the URL the content was fetched from after following redirects. It is the target URL if there
+	// were none, or if the fetcher doesn't report them.
+	FinalURL string
+	// Redirects are the redirects followed to reach FinalURL, in order.
+	Redirects []fetchers.Redirect
+	// Proxy is the proxy the content was fetched through, with its password redacted. It is empty if the fetcher
+	// doesn't use a proxy.
+	Proxy string
+	// Preview is a screenshot of the page taken by Gophetch.Previewer, when the page has no lead image.
+	Preview *media.Media
+	// Escalations are the fetchers of the chain passed over before FetcherName, and why, in order.
+	Escalations []Escalation
+	// Blocked is set if the page is a bot block, such as a challenge or a captcha wall, rather than the content asked
+	// for, see Detect. The metadata then describes the block page.
+	Blocked *Detection
+	// SoftError is set if the page is an error page, or a consent interstitial, served with a success status.
+	SoftError *Detection
+	// Items are the microdata and RDFa Lite items of the page, such as a Product, a Recipe or an Event, see
+	// rules.ParseItems.
+	Items []*rules.Item
+	// Truncated is set if the page was cut short by BodyLimits, which only happens when BodyLimits.Truncate is set.
+	// The metadata is then extracted from the part of the page that was read.
+	Truncated bool
 }
 
 // New creates a new Gophetch struct with the provided fetchers.
@@ -58,40 +145,77 @@ func (g *Gophetch) SetLogger(logger *slog.Logger) {
 	g.Logger = logger
 }
 
+// SetHTTPClient sets the HTTP client used for outbound requests, see httpclient.New for building one.
+func (g *Gophetch) SetHTTPClient(client *http.Client) {
+	g.HTTPClient = client
+}
+
+// SetRetryPolicy sets the policy used for the fetches made through the fetcher chain.
+func (g *Gophetch) SetRetryPolicy(policy *fetchers.RetryPolicy) {
+	g.RetryPolicy = policy
+}
+
+// SetBodyLimits sets the limits of the pages fetched and parsed.
+func (g *Gophetch) SetBodyLimits(limits fetchers.BodyLimits) {
+	g.BodyLimits = &limits
+}
+
+// SetStrategy sets the strategy deciding which fetchers of the chain fetch a URL.
+func (g *Gophetch) SetStrategy(strategy ChainStrategy) {
+	g.Strategy = strategy
+}
+
 // ReadAndParse accepts two parameters: an io.Reader containing the HTML to be parsed, and a
 // target URL string. It reads the HTML content from the provided io.Reader, parses it to extract metadata, and
 // encapsulates the extracted metadata, along with the response data, into a Result struct which is then returned.
 // This method is useful when the HTML content is already available and does not need to be fetched from the internet.
 func (g *Gophetch) ReadAndParse(r io.Reader, targetURL string) (Result, error) {
-	err := g.Parser.Parse(r, nil, targetURL)
+	return g.ReadAndParseContext(context.Background(), r, targetURL)
+}
+
+// ReadAndParseContext is like ReadAndParse, but stops reading and extracting once the context is done. If the
+// context's deadline is exceeded, the returned error wraps ErrTimeout.
+func (g *Gophetch) ReadAndParseContext(ctx context.Context, r io.Reader, targetURL string) (Result, error) {
+	ctx = g.withHTTPClient(ctx)
+	parser := g.newParser()
+	err := parser.ParseContext(ctx, r, nil, targetURL)
 	if err != nil {
 		return Result{
-			HTMLNode:    g.Parser.Node(),
-			Headers:     g.Parser.Headers(),
-			IsHTML:      g.Parser.IsHTML(),
-			MimeType:    g.Parser.MimeType(),
+			HTMLNode:    parser.Node(),
+			Headers:     parser.Headers(),
+			IsHTML:      parser.IsHTML(),
+			MimeType:    parser.MimeType(),
 			Response:    nil,
 			StatusCode:  0,
 			FetcherName: "",
-		}, err
+		}, wrapTimeout(err, targetURL)
 	}
 
 	fetchedData := Result{
-		HTMLNode:    g.Parser.Node(),
-		Headers:     g.Parser.Headers(),
-		IsHTML:      g.Parser.IsHTML(),
-		MimeType:    g.Parser.MimeType(),
+		HTMLNode:    parser.Node(),
+		Headers:     parser.Headers(),
+		IsHTML:      parser.IsHTML(),
+		MimeType:    parser.MimeType(),
 		Response:    nil,
 		StatusCode:  0,
 		FetcherName: "",
+		Kind:        KindArticle,
+		Truncated:   parser.Truncated(),
 	}
+	fetchedData.Blocked, fetchedData.SoftError = Detect(nil, 0, parser.Node())
+	// The rules read the items, and other parts of the page, again
+	defer rules.CacheDocument(parser.Node())()
+	fetchedData.Items = rules.ParseItems(parser.Node(), parser.URL())
 
-	data, err := g.Extractor.ExtractMetadata(g.Parser.Node(), g.Parser.URL())
+	data, ruleErrs, err := g.Extractor.ExtractMetadataContext(ctx, parser.Node(), parser.URL())
+	fetchedData.Errors = ruleErrs
 	if err != nil {
-		return fetchedData, err
+		return fetchedData, wrapTimeout(err, targetURL)
 	}
 
 	fetchedData.Metadata = data
+	fetchedData.Metadata.Meta.Charset = parser.Charset()
+	fetchedData.Metadata.Kind = string(KindArticle)
 	return fetchedData, nil
 }
 
@@ -100,102 +224,343 @@ func (g *Gophetch) ReadAndParse(r io.Reader, targetURL string) (Result, error) {
 // extracted metadata, along with the response data, into a Result struct which is then returned. This method is
 // useful when the HTML content needs to be fetched from the internet before parsing.
 func (g *Gophetch) FetchAndParse(targetURL string) (Result, error) {
-	var err error
-	var body io.ReadCloser
-	var resp *http.Response
-	var fetcherName string
+	return g.FetchAndParseContext(context.Background(), targetURL)
+}
+
+// FetchAndParseContext is like FetchAndParse, but the context is carried through fetcher selection, reading the
+// body, and extracting the metadata. Once the context is done no further fetchers are tried. If the context's
+// deadline is exceeded, the returned error wraps ErrTimeout.
+//
+// The metadata is extracted against the URL the page was fetched from after following redirects, which is
+// reported in Result.FinalURL along with the redirect chain.
+func (g *Gophetch) FetchAndParseContext(ctx context.Context, targetURL string) (Result, error) {
+	ctx = g.withHTTPClient(ctx)
+
+	var redirects []fetchers.Redirect
+	visited := make(map[string]bool)
+	clientHops := 0
+	pageURL := targetURL
+	for {
+		f, err := g.fetch(ctx, pageURL)
+		if err != nil {
+			return Result{}, wrapTimeout(err, targetURL)
+		}
+
+		finalURL := pageURL
+		if f.info.FinalURL != "" {
+			finalURL = f.info.FinalURL
+		}
+		redirects = append(redirects, f.info.Redirects...)
+		visited[pageURL] = true
+		visited[finalURL] = true
+
+		// Client-side redirects are followed until the limit, never going back to a page already seen
+		var follow func(string) bool
+		if clientHops < g.MaxClientRedirects {
+			follow = func(u string) bool { return !visited[u] }
+		}
+
+		result, next, err := g.parse(ctx, f, finalURL, follow)
+		if next == nil {
+			result.FinalURL = finalURL
+			result.Redirects = redirects
+			if err == nil {
+				g.preview(ctx, &result)
+			}
+			return result, err
+		}
+
+		g.Logger.Info("Following "+string(next.Type)+" redirect", slog.String("from", finalURL), slog.String("to", next.URL))
+		redirects = append(redirects, fetchers.Redirect{URL: finalURL, StatusCode: f.resp.StatusCode, Type: next.Type})
+		clientHops++
+		pageURL = next.URL
+	}
+}
 
+// fetchResult is a response returned by the fetcher chain.
+type fetchResult struct {
+	resp        *http.Response
+	body        io.ReadCloser
+	fetcherName string
+	info        *fetchers.FetchInfo
+	metadata    metadata.Metadata
+	hasMetadata bool
+	escalations []Escalation
+}
+
+// fetch runs the fetcher chain with the strategy until a fetcher returns a response it accepts.
+func (g *Gophetch) fetch(ctx context.Context, targetURL string) (fetchResult, error) {
 	// If no fetchers are provided, use the standard HTTP fetcher
-	if len(g.Fetchers) == 0 {
-		g.Fetchers = append(g.Fetchers, &fetchers.StandardHTTPFetcher{})
+	chain := g.Fetchers
+	if len(chain) == 0 {
+		chain = []fetchers.HTMLFetcher{&fetchers.StandardHTTPFetcher{}}
+	}
+	strategy := g.Strategy
+	if strategy == nil {
+		strategy = OrderedStrategy{}
+	}
+	if g.BodyLimits != nil {
+		ctx = fetchers.WithBodyLimits(ctx, *g.BodyLimits)
 	}
 
-	var data metadata.Metadata
-	hasMetadata := false
-	for _, fetcher := range g.Fetchers {
+	attempt := func(ctx context.Context, fetcher fetchers.HTMLFetcher) (*FetchAttempt, error) {
 		g.Logger.Info("Fetching HTML from " + fetcher.Name())
-		resp, body, err = fetcher.FetchHTML(targetURL)
-		if err == nil {
-			data = fetcher.Metadata()
-			hasMetadata = fetcher.HasMetadata()
-			fetcherName = fetcher.Name()
-			g.Logger.Info("Fetched HTML from "+fetcher.Name(), slog.Int("status_code", resp.StatusCode))
-			break
+		a := &FetchAttempt{Fetcher: fetcher, Info: &fetchers.FetchInfo{}}
+		fetchCtx := fetchers.WithFetchInfo(ctx, a.Info)
+		var err error
+		if g.RetryPolicy != nil {
+			a.Response, a.Body, err = g.RetryPolicy.Fetch(fetchCtx, fetcher, targetURL)
 		} else {
+			a.Response, a.Body, err = fetchers.FetchHTMLContext(fetchCtx, fetcher, targetURL)
+		}
+		if err == nil && (a.Response == nil || a.Body == nil) {
+			if a.Body != nil {
+				_ = a.Body.Close()
+			}
+			err = fmt.Errorf("unable to fetch HTML from %s", targetURL)
+		}
+		if err != nil {
 			g.Logger.Error("Error fetching HTML from "+fetcher.Name(), slog.String("error", err.Error()))
+			return nil, err
 		}
+		g.Logger.Info("Fetched HTML from "+fetcher.Name(), slog.Int("status_code", a.Response.StatusCode))
+		if g.EscalateDetected {
+			if err := checkDetected(a, targetURL); err != nil {
+				g.Logger.Info("Got a page that isn't the content from "+fetcher.Name(), slog.String("error", err.Error()))
+				return nil, err
+			}
+		}
+		return a, nil
 	}
 
+	a, escalations, err := strategy.Fetch(ctx, targetURL, chain, attempt)
+	for _, e := range escalations {
+		g.Logger.Info("Escalated from "+e.Fetcher, slog.String("reason", e.Reason))
+	}
 	if err != nil {
-		return Result{}, err
-	} else if resp == nil || body == nil {
-		return Result{}, fmt.Errorf("unable to fetch HTML from %s", targetURL)
+		return fetchResult{}, err
+	} else if a == nil {
+		return fetchResult{}, fmt.Errorf("unable to fetch HTML from %s", targetURL)
 	}
 
+	f := fetchResult{
+		resp:        a.Response,
+		body:        a.Body,
+		fetcherName: a.Fetcher.Name(),
+		info:        a.Info,
+		escalations: escalations,
+	}
+	f.metadata, f.hasMetadata = fetcherMetadata(a.Fetcher, a.Info)
+	return f, nil
+}
+
+// parse extracts the metadata from a fetched response, and closes its body. The page is parsed as if it was found
+// at pageURL. If follow is set and the page redirects on the client side to a URL it accepts, that redirect is
+// returned instead of a result.
+func (g *Gophetch) parse(ctx context.Context, f fetchResult, pageURL string, follow func(string) bool) (Result, *clientRedirect, error) {
 	defer func(body io.ReadCloser) {
 		_ = body.Close()
-	}(body)
+	}(f.body)
+	resp := f.resp
+
+	// Only HTML pages go through the parser and the rules. Fetchers that provide metadata always return HTML.
+	content := bufio.NewReaderSize(f.body, sniffLen)
+	if !f.hasMetadata {
+		start, _ := content.Peek(sniffLen)
+		if kind := kindOf(sniffMediaType(resp.Header.Get("Content-Type"), start)); kind != KindArticle {
+			result := parseContent(ctx, kind, resp, content, pageURL)
+			result.FetcherName = f.fetcherName
+			result.Escalations = f.escalations
+			result.CacheStatus = f.info.CacheStatus
+			result.Proxy = f.info.Proxy
+			return result, nil, wrapTimeout(ctx.Err(), pageURL)
+		}
+	}
 
-	err = g.Parser.Parse(body, resp, targetURL)
+	parser := g.newParser()
+	err := parser.ParseContext(ctx, content, resp, pageURL)
 	if err != nil {
-		return Result{}, err
+		return Result{}, nil, wrapTimeout(err, pageURL)
+	}
+
+	if follow != nil && !f.hasMetadata {
+		if next, found := findClientRedirect(parser.Node(), parser.BaseURL()); found && follow(next.URL) {
+			return Result{}, &next, nil
+		}
 	}
 
 	fetchedData := Result{
-		HTMLNode:    g.Parser.Node(),
-		Headers:     g.Parser.Headers(),
-		IsHTML:      g.Parser.IsHTML(),
+		HTMLNode:    parser.Node(),
+		Headers:     parser.Headers(),
+		IsHTML:      parser.IsHTML(),
 		Metadata:    metadata.Metadata{},
-		MimeType:    g.Parser.MimeType(),
+		MimeType:    parser.MimeType(),
 		Response:    resp,
 		StatusCode:  resp.StatusCode,
-		FetcherName: fetcherName,
+		FetcherName: f.fetcherName,
+		Escalations: f.escalations,
+		Kind:        KindArticle,
+		CacheStatus: f.info.CacheStatus,
+		Proxy:       f.info.Proxy,
+		Truncated:   parser.Truncated() || f.info.Truncated,
 	}
+	fetchedData.Blocked, fetchedData.SoftError = Detect(resp.Header, resp.StatusCode, parser.Node())
+	// The rules read the items, and other parts of the page, again
+	defer rules.CacheDocument(parser.Node())()
+	fetchedData.Items = rules.ParseItems(parser.Node(), parser.URL())
 
 	// If the fetcher provided metadata, use that instead
-	if hasMetadata {
-		fetchedData.Metadata = data
-		result, err := g.Extractor.ExtractRuleByKey(g.Parser.Node(), g.Parser.URL(), "readable")
+	if f.hasMetadata {
+		fetchedData.Metadata = f.metadata
+		fetchedData.Metadata.Meta.Charset = parser.Charset()
+		fetchedData.Metadata.Kind = string(KindArticle)
+		result, err := g.Extractor.ExtractRuleByKeyContext(ctx, parser.Node(), parser.URL(), "readable")
 		if err == nil {
-			result.ApplyMetadata("readable", g.Parser.URL(), &fetchedData.Metadata)
+			result.ApplyMetadata("readable", parser.BaseURL(), &fetchedData.Metadata)
 		}
-		result2, err := g.Extractor.ExtractRuleByKey(g.Parser.Node(), g.Parser.URL(), "lead_image")
+		result2, err := g.Extractor.ExtractRuleByKeyContext(ctx, parser.Node(), parser.URL(), "lead_image")
 		if err == nil {
-			result2.ApplyMetadata("lead_image", g.Parser.URL(), &fetchedData.Metadata)
+			result2.ApplyMetadata("lead_image", parser.BaseURL(), &fetchedData.Metadata)
 		}
-		return fetchedData, nil
+		return fetchedData, nil, nil
 	}
 
-	domain, err := ExtractDomain(targetURL)
+	domain, err := ExtractDomain(pageURL)
 	if err != nil {
-		return fetchedData, err
+		return fetchedData, nil, err
 	}
 
+	// Site-specific rules only apply to this request, the shared extractor is left untouched
+	extractor := g.Extractor
 	if site, found := g.findSite(domain); found {
-		g.Extractor.ApplySiteSpecificRules(site)
+		extractor = extractor.WithSite(site)
 	}
 
-	data, err = g.Extractor.ExtractMetadata(g.Parser.Node(), g.Parser.URL())
-
+	data, ruleErrs, err := extractor.ExtractMetadataContext(rules.WithFetchTime(ctx, fetchTime(resp.Header)), parser.Node(), parser.URL())
+	fetchedData.Errors = ruleErrs
 	if err != nil {
-		return fetchedData, err
+		return fetchedData, nil, wrapTimeout(err, pageURL)
 	}
 
 	fetchedData.Metadata = data
-	return fetchedData, nil
+	fetchedData.Metadata.Meta.Charset = parser.Charset()
+	fetchedData.Metadata.Kind = string(KindArticle)
+	return fetchedData, nil, nil
+}
+
+// fetchTime returns when the response was sent according to its Date header, so that the relative dates of a
+// cached page are resolved against the time it was fetched.
+func fetchTime(header http.Header) time.Time {
+	if t, err := http.ParseTime(header.Get("Date")); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// newParser returns a parser that reads pages within the configured limits.
+func (g *Gophetch) newParser() *Parser {
+	parser := NewParser()
+	if g.BodyLimits != nil {
+		parser.Limits = *g.BodyLimits
+	}
+	return parser
+}
+
+// preview takes a screenshot of an HTML page without a lead image, if a Previewer is set.
+func (g *Gophetch) preview(ctx context.Context, result *Result) {
+	if g.Previewer == nil || result.Kind != KindArticle || result.Metadata.LeadImageURL != "" {
+		return
+	}
+	preview, err := g.Previewer.CaptureScreenshot(ctx, result.FinalURL, g.PreviewOptions)
+	if err != nil {
+		g.Logger.Error("Error capturing preview of "+result.FinalURL, slog.String("error", err.Error()))
+		return
+	}
+	result.Preview = preview
 }
 
 // RegisterSite registers a site with the Gophetch instance. This allows the Gophetch instance to apply
-// site-specific rules when extracting metadata from the HTML content.
+// site-specific rules when extracting metadata from the HTML content. It is safe to call while other goroutines
+// are fetching.
 func (g *Gophetch) RegisterSite(site sites.Site) {
+	g.siteMu.Lock()
+	defer g.siteMu.Unlock()
 	g.SiteRegistry[site.DomainKey()] = site
 }
 
 func (g *Gophetch) findSite(domain string) (sites.Site, bool) {
+	g.siteMu.RLock()
+	defer g.siteMu.RUnlock()
 	site, found := g.SiteRegistry[domain]
 	return site, found
 }
 
+// Session returns the named session, creating an empty one if there is none by that name. Fetches and image
+// downloads made with a context returned by WithSession use its cookies and headers.
+func (g *Gophetch) Session(name string) *httpclient.Session {
+	g.sessionMu.Lock()
+	defer g.sessionMu.Unlock()
+	if session, ok := g.sessions[name]; ok {
+		return session
+	}
+	if g.sessions == nil {
+		g.sessions = make(map[string]*httpclient.Session)
+	}
+	session := httpclient.NewSession(name)
+	g.sessions[name] = session
+	return session
+}
+
+// AddSession registers a session under its name, such as one read with httpclient.LoadSession, replacing the
+// session of the same name if any.
+func (g *Gophetch) AddSession(session *httpclient.Session) {
+	g.sessionMu.Lock()
+	defer g.sessionMu.Unlock()
+	if g.sessions == nil {
+		g.sessions = make(map[string]*httpclient.Session)
+	}
+	g.sessions[session.Name] = session
+}
+
+// WithSession returns a copy of ctx that carries the named session, see Session. Pass it to FetchAndParseContext
+// and to ImageInliner.InlineImagesContext so that the page and its images are fetched with the same cookies.
+func (g *Gophetch) WithSession(ctx context.Context, name string) context.Context {
+	return httpclient.WithSession(ctx, g.Session(name))
+}
+
+// CrawlDelay returns the longest delay the fetchers in the chain ask for between two requests to the host of the
+// given URL, see fetchers.CrawlDelayer. It is zero if none of them does.
+func (g *Gophetch) CrawlDelay(ctx context.Context, targetURL string) time.Duration {
+	var delay time.Duration
+	for _, fetcher := range g.Fetchers {
+		if d := fetchers.CrawlDelay(g.withHTTPClient(ctx), fetcher, targetURL); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// withHTTPClient attaches the configured HTTP client to the context, unless the context already carries one.
+func (g *Gophetch) withHTTPClient(ctx context.Context) context.Context {
+	if g.HTTPClient == nil || httpclient.FromContext(ctx) != nil {
+		return ctx
+	}
+	return httpclient.WithClient(ctx, g.HTTPClient)
+}
+
+// fetcherMetadata returns the metadata provided by the fetcher for the current request, if any. Metadata recorded
+// in the request's FetchInfo is preferred, as the fetcher's own Metadata method may have been overwritten by a
+// concurrent request.
+func fetcherMetadata(fetcher fetchers.HTMLFetcher, info *fetchers.FetchInfo) (metadata.Metadata, bool) {
+	if info.Metadata != nil {
+		return *info.Metadata, true
+	}
+	if fetcher.HasMetadata() {
+		return fetcher.Metadata(), true
+	}
+	return metadata.Metadata{}, false
+}
+
 // ExtractDomain extracts the domain from a given URL string
 func ExtractDomain(rawURL string) (string, error) {
 	u, err := url.Parse(rawURL)
@@ -211,3 +576,18 @@ func ExtractDomain(rawURL string) (string, error) {
 
 	return domain, nil
 }
+
+// wrapTimeout wraps context deadline and network timeout errors with ErrTimeout, so callers can test for a timeout
+// with errors.Is regardless of where in the pipeline it happened. The subject, usually the target URL, is included
+// in the message.
+func wrapTimeout(err error, subject string) error {
+	if err == nil || errors.Is(err, ErrTimeout) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %s: %w", ErrTimeout, subject, err)
+	}
+	return err
+}
@@ -0,0 +1,381 @@
+package gophetch_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/httpclient"
+	"github.com/octetic/gophetch/media"
+	"github.com/octetic/gophetch/metadata"
+)
+
+func TestFetchAndParseContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Hello</title><link rel="icon" href="/icon.png"></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	t.Run("fetches and parses", func(t *testing.T) {
+		g := gophetch.New()
+		result, err := g.FetchAndParseContext(context.Background(), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "Hello", result.Metadata.Title)
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		g := gophetch.New()
+		_, err := g.FetchAndParseContext(ctx, server.URL+"/slow")
+		assert.ErrorIs(t, err, gophetch.ErrTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("cancelled before fetching", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		g := gophetch.New()
+		_, err := g.FetchAndParseContext(ctx, server.URL)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, errors.Is(err, gophetch.ErrTimeout))
+	})
+}
+
+func TestHTTPClient(t *testing.T) {
+	var mu sync.Mutex
+	userAgents := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents[r.URL.Path] = r.UserAgent()
+		mu.Unlock()
+
+		if r.URL.Path == "/favicon.ico" {
+			w.Header().Set("Content-Type", "image/x-icon")
+			_, _ = w.Write([]byte{0, 0, 1, 0})
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Hello</title></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	g := gophetch.New()
+	g.SetHTTPClient(httpclient.New(httpclient.Options{UserAgent: "gophetch-test"}))
+
+	_, err := g.FetchAndParseContext(context.Background(), server.URL+"/page")
+	assert.NoError(t, err)
+
+	// Both the page and the favicon probe made by the favicon rule go through the configured client
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "gophetch-test", userAgents["/page"])
+	assert.Equal(t, "gophetch-test", userAgents["/favicon.ico"])
+}
+
+func TestBlockedDestination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Internal</title></head></html>`))
+	}))
+	defer server.Close()
+
+	guard, err := httpclient.NewGuard(httpclient.GuardOptions{})
+	assert.NoError(t, err)
+
+	g := gophetch.New()
+	g.SetHTTPClient(httpclient.New(httpclient.Options{Guard: guard}))
+
+	_, err = g.FetchAndParseContext(context.Background(), server.URL)
+	assert.ErrorIs(t, err, httpclient.ErrBlockedDestination)
+}
+
+// staticFetcher returns the same page for every URL.
+type staticFetcher struct {
+	name string
+	html string
+}
+
+func (f *staticFetcher) Name() string {
+	return f.name
+}
+
+func (f *staticFetcher) FetchHTML(_ string) (*http.Response, io.ReadCloser, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(f.html)),
+	}
+	return resp, resp.Body, nil
+}
+
+func (f *staticFetcher) HasMetadata() bool {
+	return false
+}
+
+func (f *staticFetcher) Metadata() metadata.Metadata {
+	return metadata.Metadata{}
+}
+
+func TestRetryPolicyFallsThrough(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	fallback := &staticFetcher{name: "fallback", html: `<html><head><title>Fallback</title></head></html>`}
+
+	t.Run("without a policy the failing response is used", func(t *testing.T) {
+		g := gophetch.New(&fetchers.StandardHTTPFetcher{}, fallback)
+		result, err := g.FetchAndParseContext(context.Background(), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "standard", result.FetcherName)
+		assert.Equal(t, http.StatusForbidden, result.StatusCode)
+	})
+
+	t.Run("with a policy the next fetcher is used", func(t *testing.T) {
+		g := gophetch.New(&fetchers.StandardHTTPFetcher{}, fallback)
+		g.SetRetryPolicy(fetchers.NewRetryPolicy(fetchers.RetryOptions{}))
+		result, err := g.FetchAndParseContext(context.Background(), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "fallback", result.FetcherName)
+		assert.Equal(t, "Fallback", result.Metadata.Title)
+	})
+
+	t.Run("the status error is returned when every fetcher fails", func(t *testing.T) {
+		g := gophetch.New(&fetchers.StandardHTTPFetcher{})
+		g.SetRetryPolicy(fetchers.NewRetryPolicy(fetchers.RetryOptions{}))
+		_, err := g.FetchAndParseContext(context.Background(), server.URL)
+		var statusErr *fetchers.StatusError
+		if assert.ErrorAs(t, err, &statusErr) {
+			assert.Equal(t, http.StatusForbidden, statusErr.StatusCode)
+		}
+	})
+}
+
+func TestResultCacheStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Cached</title></head></html>`))
+	}))
+	defer server.Close()
+
+	g := gophetch.New(fetchers.NewCachingFetcher(&fetchers.StandardHTTPFetcher{}, fetchers.NewMemoryCacheStore()))
+
+	for _, expected := range []fetchers.CacheStatus{fetchers.CacheMiss, fetchers.CacheHit} {
+		result, err := g.FetchAndParseContext(context.Background(), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result.CacheStatus)
+		assert.Equal(t, "Cached", result.Metadata.Title)
+	}
+}
+
+func TestRelativeURLsResolvedAgainstBase(t *testing.T) {
+	page := `<html><head>
+		<base href="https://cdn.example.net/site/">
+		<title>Base</title>
+		<link rel="canonical" href="../articles/post?page=2">
+		<link rel="icon" href="icons/favicon.png">
+		<link rel="alternate" type="application/rss+xml" href="./feed.xml">
+		<meta property="og:image" content="images/lead.png">
+	</head><body><p>Hello</p></body></html>`
+
+	g := gophetch.New()
+	result, err := g.ReadAndParse(strings.NewReader(page), "https://example.com/blog/post.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.net/articles/post?page=2", result.Metadata.CanonicalURL)
+	assert.Equal(t, "https://cdn.example.net/site/icons/favicon.png", result.Metadata.FaviconURL)
+	assert.Equal(t, []string{"https://cdn.example.net/site/feed.xml"}, result.Metadata.FeedURLs)
+	assert.Equal(t, "https://cdn.example.net/site/images/lead.png", result.Metadata.LeadImageURL)
+}
+
+func TestResultItems(t *testing.T) {
+	page := `<html><body><div itemscope itemtype="https://schema.org/Product">
+		<h1 itemprop="name">Kettle</h1><a itemprop="url" href="/kettle">Kettle</a>
+	</div></body></html>`
+
+	g := gophetch.New()
+	result, err := g.ReadAndParse(strings.NewReader(page), "https://example.com/shop/")
+	assert.NoError(t, err)
+	if assert.Len(t, result.Items, 1) {
+		assert.Equal(t, []string{"https://schema.org/Product"}, result.Items[0].Types)
+		assert.Equal(t, []any{"Kettle"}, result.Items[0].Properties["name"])
+		assert.Equal(t, []any{"https://example.com/kettle"}, result.Items[0].Properties["url"])
+	}
+}
+
+// Relative dates are resolved against the time the page was served
+func TestPublishedAt(t *testing.T) {
+	served := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Date", served.Format(http.TimeFormat))
+		_, _ = w.Write([]byte(`<html><head><meta property="og:updated_time" content="2024-03-10T12:30:00+01:00"></head>
+			<body><span class="post-date">2 hours ago</span></body></html>`))
+	}))
+	defer server.Close()
+
+	result, err := gophetch.New().FetchAndParseContext(context.Background(), server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "2 hours ago", result.Metadata.Date)
+	if assert.NotNil(t, result.Metadata.PublishedAt) {
+		assert.True(t, served.Add(-2*time.Hour).Equal(result.Metadata.PublishedAt.Time))
+		assert.Equal(t, "2 hours ago", result.Metadata.PublishedAt.Raw)
+	}
+	if assert.NotNil(t, result.Metadata.ModifiedAt) {
+		assert.True(t, served.Add(-30*time.Minute).Equal(result.Metadata.ModifiedAt.Time))
+		assert.Equal(t, 0.9, result.Metadata.ModifiedAt.Confidence)
+	}
+}
+
+type testPreviewer struct {
+	urls []string
+}
+
+func (p *testPreviewer) CaptureScreenshot(_ context.Context, url string, opts fetchers.BrowserlessScreenshotOptions) (*media.Media, error) {
+	p.urls = append(p.urls, url)
+	return &media.Media{URL: url, Format: opts.Type, MediaType: media.ImageType}, nil
+}
+
+func TestPreview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.URL.Path == "/with-image" {
+			_, _ = w.Write([]byte(`<html><head><meta property="og:image" content="/lead.png"></head><body></body></html>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>No image</title></head><body><p>Text</p></body></html>`))
+	}))
+	defer server.Close()
+
+	previewer := &testPreviewer{}
+	g := gophetch.New()
+	g.Previewer = previewer
+	g.PreviewOptions = fetchers.BrowserlessScreenshotOptions{Type: "jpeg"}
+
+	result, err := g.FetchAndParseContext(context.Background(), server.URL+"/without-image")
+	assert.NoError(t, err)
+	if assert.NotNil(t, result.Preview) {
+		assert.Equal(t, server.URL+"/without-image", result.Preview.URL)
+		assert.Equal(t, "jpeg", result.Preview.Format)
+	}
+
+	result, err = g.FetchAndParseContext(context.Background(), server.URL+"/with-image")
+	assert.NoError(t, err)
+	assert.Nil(t, result.Preview)
+	assert.Equal(t, []string{server.URL + "/without-image"}, previewer.urls)
+}
+
+func TestBodyLimits(t *testing.T) {
+	page := `<html><head><title>Long page</title></head><body>` + strings.Repeat("<p>Lorem ipsum</p>", 1000) + `</body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	t.Run("too large", func(t *testing.T) {
+		g := gophetch.New()
+		g.SetBodyLimits(fetchers.BodyLimits{MaxSize: 1000})
+		_, err := g.FetchAndParseContext(context.Background(), server.URL)
+		assert.ErrorIs(t, err, fetchers.ErrBodyTooLarge)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		g := gophetch.New()
+		g.SetBodyLimits(fetchers.BodyLimits{MaxSize: 1000, Truncate: true})
+		result, err := g.FetchAndParseContext(context.Background(), server.URL)
+		if assert.NoError(t, err) {
+			assert.True(t, result.Truncated)
+			assert.Equal(t, "Long page", result.Metadata.Title)
+		}
+	})
+
+	t.Run("parsed from a reader", func(t *testing.T) {
+		g := gophetch.New()
+		g.SetBodyLimits(fetchers.BodyLimits{MaxDecompressedSize: 1000})
+		_, err := g.ReadAndParse(strings.NewReader(page), "https://example.com/")
+		assert.EqualError(t, err, "body exceeds max decompressed size of 1000 bytes")
+
+		g.SetBodyLimits(fetchers.BodyLimits{MaxDecompressedSize: 1000, Truncate: true})
+		result, err := g.ReadAndParse(strings.NewReader(page), "https://example.com/")
+		if assert.NoError(t, err) {
+			assert.True(t, result.Truncated)
+			assert.Equal(t, "Long page", result.Metadata.Title)
+		}
+	})
+}
+
+func TestSession(t *testing.T) {
+	var icon bytes.Buffer
+	_ = png.Encode(&icon, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Both the page and its images are only served with the consent cookie
+		if c, err := r.Cookie("consent"); err != nil || c.Value != "granted" {
+			http.Error(w, "consent required", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/image.png" {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(icon.Bytes())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Members only</title></head><body><img src="/image.png"></body></html>`))
+	}))
+	defer server.Close()
+
+	g := gophetch.New()
+	assert.NoError(t, g.Session("members").SetCookies(server.URL, &http.Cookie{Name: "consent", Value: "granted"}))
+	assert.Same(t, g.Session("members"), g.Session("members"))
+
+	ctx := g.WithSession(context.Background(), "members")
+	result, err := g.FetchAndParseContext(ctx, server.URL+"/article")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Members only", result.Metadata.Title)
+
+	base, _ := url.Parse(result.FinalURL)
+	inliner := gophetch.NewImageInliner(gophetch.ImageInlinerOptions{RelativeURL: base})
+	inlined, err := inliner.InlineImagesContext(ctx, `<img src="/image.png">`)
+	if assert.NoError(t, err) {
+		assert.Contains(t, inlined, `src="data:image/png;base64,`)
+	}
+
+	// Without the session, the page is refused
+	result, err = g.FetchAndParseContext(context.Background(), server.URL+"/article")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, result.StatusCode)
+	}
+}
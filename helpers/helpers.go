@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"fmt"
 	"net/url"
 	"strings"
 
@@ -40,46 +41,23 @@ func CreateUniqueFilename(url *url.URL) string {
 }
 
 // FixRelativePath converts a relative path to an absolute path for the given URL.
+//
+// Deprecated: Use ResolveURL, which this function calls.
 func FixRelativePath(url *url.URL, path string) string {
-	path = strings.TrimSpace(path)
-
-	if strings.HasPrefix(path, "http") {
-		return path
-	}
-
-	if strings.HasPrefix(path, "data:") {
-		return path
-	}
-
-	var buf strings.Builder
-
-	if strings.HasPrefix(path, "//") {
-		if url.Scheme != "" {
-			buf.WriteString(url.Scheme + ":")
-		}
-		buf.WriteString(path)
-		return buf.String()
-	}
-
-	if url.Scheme != "" {
-		buf.WriteString(url.Scheme + ":")
-	}
-
-	if url.Host != "" || url.Path != "" || url.User != nil {
-		buf.WriteString("//")
-
-		if ui := url.User; ui != nil {
-			buf.WriteString(ui.String() + "@")
-		}
+	return ResolveURL(url, path)
+}
 
-		buf.WriteString(url.Host)
+// PrettySize formats a size in bytes for humans, e.g. "1.5 MB".
+func PrettySize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
 	}
 
-	if url.Host != "" && path != "" && path[0] != '/' {
-		buf.WriteByte('/')
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
 	}
-
-	buf.WriteString(path)
-
-	return buf.String()
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTP"[exp])
 }
@@ -79,3 +79,23 @@ func TestFixRelativePath(t *testing.T) {
 		})
 	}
 }
+
+func TestPrettySize(t *testing.T) {
+	testCases := []struct {
+		size     int64
+		expected string
+	}{
+		{size: 0, expected: "0 B"},
+		{size: 1023, expected: "1023 B"},
+		{size: 1024, expected: "1.0 KB"},
+		{size: 1536, expected: "1.5 KB"},
+		{size: 5 * 1024 * 1024, expected: "5.0 MB"},
+		{size: 3 * 1024 * 1024 * 1024, expected: "3.0 GB"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, helpers.PrettySize(tc.size))
+		})
+	}
+}
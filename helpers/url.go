@@ -3,6 +3,8 @@ package helpers
 import (
 	"net/url"
 	"strings"
+
+	"golang.org/x/net/html"
 )
 
 // Params is a list of tracking parameters to remove from URLs.
@@ -64,3 +66,64 @@ func deleteParams(u string, keys []string) string {
 	}
 	return parsedURL.String()
 }
+
+// ResolveURL resolves a URL found in a document against the document's base URL, following RFC 3986. References
+// with a scheme other than http or https, such as data: or mailto: URLs, are returned as they are. If base is nil or
+// ref can't be parsed, ref is returned as it is.
+func ResolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	r, err := url.Parse(ref)
+	if err != nil || base == nil {
+		return ref
+	}
+	if r.Scheme != "" && r.Scheme != "http" && r.Scheme != "https" {
+		return ref
+	}
+	return base.ResolveReference(r).String()
+}
+
+// DocumentBase returns the URL relative URLs in a document are resolved against: the first <base href> of the
+// document, itself resolved against the document's URL, or the document's URL if there is none.
+func DocumentBase(doc *html.Node, docURL *url.URL) *url.URL {
+	href, found := findBaseHref(doc)
+	if !found {
+		return docURL
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return docURL
+	}
+	if docURL == nil {
+		if ref.IsAbs() {
+			return ref
+		}
+		return nil
+	}
+	base := docURL.ResolveReference(ref)
+	if base.Scheme != "http" && base.Scheme != "https" {
+		// A javascript: or data: base would make every link unusable, browsers ignore those as well
+		return docURL
+	}
+	return base
+}
+
+// findBaseHref returns the href of the first <base> element that has one.
+func findBaseHref(n *html.Node) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	if n.Type == html.ElementNode && n.Data == "base" {
+		for _, a := range n.Attr {
+			if a.Key == "href" {
+				return a.Val, true
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href, found := findBaseHref(c); found {
+			return href, true
+		}
+	}
+	return "", false
+}
@@ -1,9 +1,12 @@
 package helpers_test
 
 import (
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
 
 	"github.com/octetic/gophetch/helpers"
 )
@@ -88,3 +91,160 @@ func TestIsURLValid(t *testing.T) {
 		})
 	}
 }
+
+// TestResolveURLRFC3986 checks the resolver against the reference resolution examples of RFC 3986, section 5.4.
+func TestResolveURLRFC3986(t *testing.T) {
+	base, err := url.Parse("http://a/b/c/d;p?q")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		ref  string
+		want string
+	}{
+		// 5.4.1. Normal Examples
+		{"g:h", "g:h"},
+		{"g", "http://a/b/c/g"},
+		{"./g", "http://a/b/c/g"},
+		{"g/", "http://a/b/c/g/"},
+		{"/g", "http://a/g"},
+		{"//g", "http://g"},
+		{"?y", "http://a/b/c/d;p?y"},
+		{"g?y", "http://a/b/c/g?y"},
+		{"#s", "http://a/b/c/d;p?q#s"},
+		{"g#s", "http://a/b/c/g#s"},
+		{"g?y#s", "http://a/b/c/g?y#s"},
+		{";x", "http://a/b/c/;x"},
+		{"g;x", "http://a/b/c/g;x"},
+		{"g;x?y#s", "http://a/b/c/g;x?y#s"},
+		{"", "http://a/b/c/d;p?q"},
+		{".", "http://a/b/c/"},
+		{"./", "http://a/b/c/"},
+		{"..", "http://a/b/"},
+		{"../", "http://a/b/"},
+		{"../g", "http://a/b/g"},
+		{"../..", "http://a/"},
+		{"../../", "http://a/"},
+		{"../../g", "http://a/g"},
+
+		// 5.4.2. Abnormal Examples
+		{"../../../g", "http://a/g"},
+		{"../../../../g", "http://a/g"},
+		{"/./g", "http://a/g"},
+		{"/../g", "http://a/g"},
+		{"g.", "http://a/b/c/g."},
+		{".g", "http://a/b/c/.g"},
+		{"g..", "http://a/b/c/g.."},
+		{"..g", "http://a/b/c/..g"},
+		{"./../g", "http://a/b/g"},
+		{"./g/.", "http://a/b/c/g/"},
+		{"g/./h", "http://a/b/c/g/h"},
+		{"g/../h", "http://a/b/c/h"},
+		{"g;x=1/./y", "http://a/b/c/g;x=1/y"},
+		{"g;x=1/../y", "http://a/b/c/y"},
+		{"g?y/./x", "http://a/b/c/g?y/./x"},
+		{"g?y/../x", "http://a/b/c/g?y/../x"},
+		{"g#s/./x", "http://a/b/c/g#s/./x"},
+		{"g#s/../x", "http://a/b/c/g#s/../x"},
+		{"http:g", "http:g"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			assert.Equal(t, tc.want, helpers.ResolveURL(base, tc.ref))
+		})
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	base, err := url.Parse("https://example.com/articles/2024/post.html?page=1")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		base *url.URL
+		ref  string
+		want string
+	}{
+		{
+			name: "surrounding spaces",
+			base: base,
+			ref:  "  ../img.png ",
+			want: "https://example.com/articles/img.png",
+		},
+		{
+			name: "data URL",
+			base: base,
+			ref:  "data:image/gif;base64,R0lGODlhAQABAAAAACw=",
+			want: "data:image/gif;base64,R0lGODlhAQABAAAAACw=",
+		},
+		{
+			name: "mailto URL",
+			base: base,
+			ref:  "mailto:someone@example.com",
+			want: "mailto:someone@example.com",
+		},
+		{
+			name: "no base",
+			base: nil,
+			ref:  "../img.png",
+			want: "../img.png",
+		},
+		{
+			name: "unparsable reference",
+			base: base,
+			ref:  "http://[::1",
+			want: "http://[::1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, helpers.ResolveURL(tc.base, tc.ref))
+		})
+	}
+}
+
+func TestDocumentBase(t *testing.T) {
+	docURL, err := url.Parse("https://example.com/articles/post.html")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "no base",
+			html: `<html><head><title>Post</title></head></html>`,
+			want: "https://example.com/articles/post.html",
+		},
+		{
+			name: "absolute base",
+			html: `<html><head><base href="https://cdn.example.net/static/"></head></html>`,
+			want: "https://cdn.example.net/static/",
+		},
+		{
+			name: "relative base",
+			html: `<html><head><base href="../assets/"></head></html>`,
+			want: "https://example.com/assets/",
+		},
+		{
+			name: "first base with href wins",
+			html: `<html><head><base target="_blank"><base href="/one/"><base href="/two/"></head></html>`,
+			want: "https://example.com/one/",
+		},
+		{
+			name: "javascript base is ignored",
+			html: `<html><head><base href="javascript:void(0)"></head></html>`,
+			want: "https://example.com/articles/post.html",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, helpers.DocumentBase(doc, docURL).String())
+		})
+	}
+}
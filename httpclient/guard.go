@@ -0,0 +1,150 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// ErrBlockedDestination is returned when a request would connect to an address that the client's Guard doesn't
+// allow. The address is included in the error message.
+var ErrBlockedDestination = errors.New("blocked destination")
+
+// DefaultDeniedCIDRs are the networks a Guard blocks unless they are explicitly allowed: loopback, private,
+// link-local (which includes the cloud metadata endpoints), carrier-grade NAT, multicast, the IPv6 transition
+// prefixes that embed an IPv4 address (NAT64, 6to4 and Teredo), and other special-purpose ranges.
+var DefaultDeniedCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001::/32",
+	"2001:db8::/32",
+	"2002::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// GuardOptions configures a Guard.
+type GuardOptions struct {
+	// Allow lists the networks that may be reached even though they are denied, e.g. an internal service that is
+	// meant to be fetched. Entries are CIDRs or single IP addresses.
+	Allow []string
+	// Deny lists additional networks to block on top of DefaultDeniedCIDRs. Entries are CIDRs or single IP
+	// addresses.
+	Deny []string
+	// Ports restricts the ports that may be connected to. Default is any port.
+	Ports []int
+}
+
+// Guard blocks outbound connections to internal addresses. It checks the resolved IP address right before the
+// connection is made, so it also applies to redirects and to host names that resolve to a different address than
+// they did when the URL was validated.
+//
+// When the client connects through a proxy, the Guard checks the address of the proxy, not the one of the target.
+type Guard struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	ports map[int]bool
+}
+
+// NewGuard creates a new Guard with the given options. It returns an error if a network can't be parsed.
+func NewGuard(opts GuardOptions) (*Guard, error) {
+	g := &Guard{}
+
+	var err error
+	if g.allow, err = parseNetworks(opts.Allow); err != nil {
+		return nil, err
+	}
+	if g.deny, err = parseNetworks(append(append([]string{}, DefaultDeniedCIDRs...), opts.Deny...)); err != nil {
+		return nil, err
+	}
+
+	if len(opts.Ports) > 0 {
+		g.ports = make(map[int]bool, len(opts.Ports))
+		for _, port := range opts.Ports {
+			g.ports[port] = true
+		}
+	}
+
+	return g, nil
+}
+
+// Check returns an error wrapping ErrBlockedDestination if the given IP address and port may not be connected to.
+func (g *Guard) Check(ip net.IP, port int) error {
+	if g.ports != nil && !g.ports[port] {
+		return fmt.Errorf("%w: port %d is not allowed", ErrBlockedDestination, port)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if containsIP(g.allow, ip) {
+		return nil
+	}
+	if containsIP(g.deny, ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, ip)
+	}
+	return nil
+}
+
+// Control checks the address a dialer is about to connect to. It has the signature of net.Dialer.Control.
+func (g *Guard) Control(_, address string, _ syscall.RawConn) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, address)
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.Atoi(portStr)
+	if ip == nil || err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, address)
+	}
+	return g.Check(ip, port)
+}
+
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
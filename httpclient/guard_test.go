@@ -0,0 +1,135 @@
+package httpclient_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/httpclient"
+)
+
+func TestGuardCheck(t *testing.T) {
+	guard, err := httpclient.NewGuard(httpclient.GuardOptions{
+		Allow: []string{"10.1.2.0/24"},
+		Deny:  []string{"8.8.4.4"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{ip: "93.184.216.34", blocked: false},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", blocked: false},
+		{ip: "127.0.0.1", blocked: true},
+		{ip: "::1", blocked: true},
+		{ip: "::ffff:127.0.0.1", blocked: true},
+		{ip: "10.0.0.1", blocked: true},
+		{ip: "172.20.1.1", blocked: true},
+		{ip: "192.168.1.1", blocked: true},
+		{ip: "169.254.169.254", blocked: true},
+		{ip: "fd00:ec2::254", blocked: true},
+		{ip: "fe80::1", blocked: true},
+		{ip: "100.64.0.1", blocked: true},
+		{ip: "2002:7f00:1::1", blocked: true},
+		{ip: "2001:0:4136:e378:8000:63bf:3fff:fdd2", blocked: true},
+		{ip: "64:ff9b::a9fe:a9fe", blocked: true},
+		{ip: "0.0.0.0", blocked: true},
+		{ip: "8.8.4.4", blocked: true},
+		{ip: "10.1.2.3", blocked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := guard.Check(net.ParseIP(tt.ip), 443)
+			if tt.blocked {
+				assert.ErrorIs(t, err, httpclient.ErrBlockedDestination)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	_, err = httpclient.NewGuard(httpclient.GuardOptions{Deny: []string{"not-a-network"}})
+	assert.Error(t, err)
+}
+
+func TestGuardClient(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	port := func(server *httptest.Server) int {
+		u, _ := url.Parse(server.URL)
+		p, _ := strconv.Atoi(u.Port())
+		return p
+	}
+
+	t.Run("blocks loopback by default", func(t *testing.T) {
+		guard, err := httpclient.NewGuard(httpclient.GuardOptions{})
+		assert.NoError(t, err)
+		client := httpclient.New(httpclient.Options{Guard: guard})
+
+		_, err = client.Get(target.URL)
+		assert.ErrorIs(t, err, httpclient.ErrBlockedDestination)
+
+		// Host names are checked once they are resolved
+		_, err = client.Get("http://localhost:" + strconv.Itoa(port(target)))
+		assert.ErrorIs(t, err, httpclient.ErrBlockedDestination)
+	})
+
+	t.Run("allows listed networks", func(t *testing.T) {
+		guard, err := httpclient.NewGuard(httpclient.GuardOptions{Allow: []string{"127.0.0.0/8"}})
+		assert.NoError(t, err)
+		client := httpclient.New(httpclient.Options{Guard: guard})
+
+		resp, err := client.Get(redirector.URL)
+		if assert.NoError(t, err) {
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	// The guard would only see the address of the proxy, so the proxy of the base transport, or of the environment,
+	// isn't used
+	t.Run("ignores the default proxy", func(t *testing.T) {
+		guard, err := httpclient.NewGuard(httpclient.GuardOptions{})
+		assert.NoError(t, err)
+		proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+		base := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+
+		client := httpclient.New(httpclient.Options{Transport: base, Guard: guard})
+		if transport, ok := client.Transport.(*http.Transport); assert.True(t, ok) {
+			assert.Nil(t, transport.Proxy)
+		}
+
+		client = httpclient.New(httpclient.Options{Transport: base, Guard: guard, Proxy: proxyURL})
+		if transport, ok := client.Transport.(*http.Transport); assert.True(t, ok) {
+			assert.NotNil(t, transport.Proxy)
+		}
+	})
+
+	t.Run("checks redirects and ports", func(t *testing.T) {
+		guard, err := httpclient.NewGuard(httpclient.GuardOptions{
+			Allow: []string{"127.0.0.1"},
+			Ports: []int{port(redirector)},
+		})
+		assert.NoError(t, err)
+		client := httpclient.New(httpclient.Options{Guard: guard})
+
+		// The redirector itself is reachable, but the target it redirects to is on a port that isn't allowed
+		_, err = client.Get(redirector.URL)
+		assert.ErrorIs(t, err, httpclient.ErrBlockedDestination)
+	})
+}
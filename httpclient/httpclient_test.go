@@ -0,0 +1,75 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/httpclient"
+)
+
+func TestNew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(r.UserAgent()))
+	}))
+	defer server.Close()
+
+	t.Run("sets the user agent", func(t *testing.T) {
+		client := httpclient.New(httpclient.Options{UserAgent: "gophetch-test"})
+		resp, err := client.Get(server.URL)
+		if assert.NoError(t, err) {
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("User-Agent", "custom")
+		resp, err = client.Do(req)
+		if assert.NoError(t, err) {
+			defer resp.Body.Close()
+		}
+		assert.Equal(t, "custom", req.Header.Get("User-Agent"), "the caller's request must not be modified")
+	})
+
+	t.Run("uses the redirect policy", func(t *testing.T) {
+		errNoRedirect := errors.New("no redirects")
+		client := httpclient.New(httpclient.Options{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return errNoRedirect
+			},
+		})
+		_, err := client.Get(server.URL + "/redirect")
+		assert.ErrorIs(t, err, errNoRedirect)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	explicit := &http.Client{}
+	fromContext := &http.Client{}
+	ctx := httpclient.WithClient(context.Background(), fromContext)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		client   *http.Client
+		expected *http.Client
+	}{
+		{name: "explicit client", ctx: ctx, client: explicit, expected: explicit},
+		{name: "context client", ctx: ctx, client: nil, expected: fromContext},
+		{name: "default client", ctx: context.Background(), client: nil, expected: http.DefaultClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Same(t, tt.expected, httpclient.Resolve(tt.ctx, tt.client))
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Session is a cookie jar and a set of headers shared by the requests made with it, such as a consent cookie or a
+// login session that a site requires before serving its content. Like cookies, headers are scoped to a domain. A
+// session is attached to a context with WithSession, and the clients returned by Resolve for that context use it.
+// It is safe for concurrent use.
+type Session struct {
+	// Name identifies the session.
+	Name string
+	// Jar holds the cookies of the session. Cookies set by the responses are kept, and sent with the next requests.
+	Jar *Jar
+
+	mu sync.RWMutex
+	// headers are the headers of the session, by domain.
+	headers map[string]http.Header
+}
+
+// NewSession creates a session with an empty cookie jar and no headers.
+func NewSession(name string) *Session {
+	return &Session{Name: name, Jar: NewJar(), headers: make(map[string]http.Header)}
+}
+
+// SetCookies seeds the session with cookies for the given URL, as if the URL had set them.
+func (s *Session) SetCookies(rawURL string, cookies ...*http.Cookie) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	s.Jar.SetCookies(u, cookies)
+	return nil
+}
+
+// SetHeader sets a header sent with the requests of the session to the given domain and its subdomains, unless the
+// request already has it.
+func (s *Session) SetHeader(domain, name, value string) {
+	domain = canonicalDomain(domain)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.headers[domain] == nil {
+		s.headers[domain] = make(http.Header)
+	}
+	s.headers[domain].Set(name, value)
+}
+
+// Header returns a copy of the headers sent with the requests of the session to the given URL. The headers set for
+// a subdomain take precedence over those of its parent domains.
+func (s *Session) Header(u *url.URL) http.Header {
+	host := canonicalDomain(u.Hostname())
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := make([]string, 0, len(s.headers))
+	for domain := range s.headers {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return len(domains[i]) < len(domains[j]) })
+
+	header := make(http.Header)
+	for _, domain := range domains {
+		for name, values := range s.headers[domain] {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	return header
+}
+
+// canonicalDomain returns the domain in lower case, without the leading dot of a cookie domain.
+func canonicalDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(domain, "."))
+}
+
+// sessionFile is how a session is stored on disk.
+type sessionFile struct {
+	Name    string                 `json:"name"`
+	Headers map[string]http.Header `json:"headers,omitempty"`
+	Cookies []storedCookie         `json:"cookies"`
+}
+
+// Save writes the session, its headers and the cookies that haven't expired to a JSON file, readable only by the
+// current user as it holds credentials. The file is replaced atomically.
+func (s *Session) Save(path string) error {
+	s.mu.RLock()
+	headers := make(map[string]http.Header, len(s.headers))
+	for domain, header := range s.headers {
+		headers[domain] = header.Clone()
+	}
+	s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(sessionFile{Name: s.Name, Headers: headers, Cookies: s.Jar.stored()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSession reads a session written by Session.Save. Cookies that have expired since are dropped.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file sessionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	s := NewSession(file.Name)
+	for domain, header := range file.Headers {
+		domain = canonicalDomain(domain)
+		if s.headers[domain] == nil {
+			s.headers[domain] = make(http.Header)
+		}
+		for name, values := range header {
+			s.headers[domain][http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	for _, c := range file.Cookies {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return nil, err
+		}
+		s.Jar.SetCookies(u, []*http.Cookie{c.cookie()})
+	}
+	return s, nil
+}
+
+// transport returns a transport that sets the session's headers for their domains on the requests that don't have
+// them.
+func (s *Session) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &sessionTransport{base: base, session: s}
+}
+
+// client returns a copy of the client that uses the session's cookie jar and headers.
+func (s *Session) client(client *http.Client) *http.Client {
+	c := *client
+	c.Jar = s.Jar
+	c.Transport = s.transport(client.Transport)
+	return &c
+}
+
+// sessionTransport sets the headers of a session on the requests to their domains that don't already have them.
+type sessionTransport struct {
+	base    http.RoundTripper
+	session *Session
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := t.session.Header(req.URL)
+	missing := false
+	for name := range header {
+		if _, ok := req.Header[name]; !ok {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request, so set the headers on a copy
+	req = req.Clone(req.Context())
+	for name, values := range header {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx that carries the given session. The clients returned by Resolve for it use the
+// session's cookies and headers.
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// WithoutSession returns a copy of ctx that doesn't carry the session of ctx, if any. It is used for the requests
+// made to the APIs of third-party services, which must not get the cookies and headers meant for the sites.
+func WithoutSession(ctx context.Context) context.Context {
+	if SessionFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionKey{}, (*Session)(nil))
+}
+
+// SessionFromContext returns the session carried by ctx, or nil if there is none.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// Jar is an http.CookieJar that can be saved and loaded with its Session. It follows the cookie rules of
+// net/http/cookiejar, with the public suffix list.
+type Jar struct {
+	jar *cookiejar.Jar
+
+	mu sync.Mutex
+	// cookies are the cookies set so far, by domain, path and name, so they can be saved.
+	cookies map[string]storedCookie
+}
+
+// NewJar creates an empty cookie jar.
+func NewJar() *Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &Jar{jar: jar, cookies: make(map[string]storedCookie)}
+}
+
+// SetCookies implements http.CookieJar.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	for _, c := range cookies {
+		stored := storedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host}).String(),
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if stored.Path == "" || !strings.HasPrefix(stored.Path, "/") {
+			stored.Path = defaultCookiePath(u.Path)
+		}
+		key := strings.ToLower(strings.TrimPrefix(c.Domain, ".")) + ";" + stored.Path + ";" + c.Name
+		if c.Domain == "" {
+			key = strings.ToLower(u.Hostname()) + ";" + stored.Path + ";" + c.Name
+		}
+
+		switch {
+		case c.MaxAge < 0, !c.Expires.IsZero() && !c.Expires.After(now):
+			delete(j.cookies, key)
+			continue
+		case c.MaxAge > 0:
+			expires := now.Add(time.Duration(c.MaxAge) * time.Second)
+			stored.Expires = &expires
+		case !c.Expires.IsZero():
+			expires := c.Expires
+			stored.Expires = &expires
+		}
+		j.cookies[key] = stored
+	}
+}
+
+// Cookies implements http.CookieJar.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// stored returns the cookies that haven't expired, sorted so that saving a session gives the same file.
+func (j *Jar) stored() []storedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(j.cookies))
+	for key, c := range j.cookies {
+		if c.Expires != nil && !c.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cookies := make([]storedCookie, 0, len(keys))
+	for _, key := range keys {
+		cookies = append(cookies, j.cookies[key])
+	}
+	return cookies
+}
+
+// storedCookie is a cookie along with the origin that set it.
+type storedCookie struct {
+	URL      string     `json:"url"`
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Domain   string     `json:"domain,omitempty"`
+	Path     string     `json:"path"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty"`
+}
+
+func (c storedCookie) cookie() *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if c.Expires != nil {
+		cookie.Expires = *c.Expires
+	}
+	return cookie
+}
+
+// defaultCookiePath is the path of a cookie set without one, see RFC 6265 section 5.1.4.
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
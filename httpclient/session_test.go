@@ -0,0 +1,154 @@
+package httpclient_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/httpclient"
+)
+
+func TestSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "remember", Value: "yes", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "1", Path: "/"})
+			http.Redirect(w, r, "/logout-tracking", http.StatusFound)
+		case "/logout-tracking":
+			http.SetCookie(w, &http.Cookie{Name: "tracking", Path: "/", MaxAge: -1})
+		default:
+			var cookies []string
+			for _, c := range r.Cookies() {
+				cookies = append(cookies, c.Name+"="+c.Value)
+			}
+			sort.Strings(cookies)
+			_, _ = io.WriteString(w, r.Header.Get("X-Api-Key")+" "+r.Header.Get("Accept-Language")+" "+strings.Join(cookies, " "))
+		}
+	}))
+	defer server.Close()
+
+	get := func(ctx context.Context, path string, header http.Header) string {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := httpclient.Resolve(ctx, nil).Do(req)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	session := httpclient.NewSession("example")
+	session.SetHeader(serverURL.Hostname(), "X-Api-Key", "secret")
+	session.SetHeader(serverURL.Hostname(), "Accept-Language", "fr")
+	session.SetHeader("example.com", "Accept-Language", "de")
+	assert.NoError(t, session.SetCookies(server.URL, &http.Cookie{Name: "consent", Value: "granted"}))
+	ctx := httpclient.WithSession(context.Background(), session)
+
+	// Seeded cookies and headers are sent, the request's own headers take precedence
+	assert.Equal(t, "secret en consent=granted", get(ctx, "/page", http.Header{"Accept-Language": {"en"}}))
+
+	// Cookies set by the responses are kept, including along redirects
+	get(ctx, "/login", nil)
+	assert.Equal(t, "secret fr consent=granted remember=yes session=abc", get(ctx, "/page", nil))
+
+	// Requests without the session don't send anything
+	assert.Equal(t, "  ", get(context.Background(), "/page", nil))
+
+	t.Run("saves and loads", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "session.json")
+		if !assert.NoError(t, session.Save(path)) {
+			return
+		}
+		stat, err := os.Stat(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+		}
+
+		loaded, err := httpclient.LoadSession(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "example", loaded.Name)
+		assert.Equal(t, session.Header(serverURL), loaded.Header(serverURL))
+		ctx := httpclient.WithSession(context.Background(), loaded)
+		assert.Equal(t, "secret fr consent=granted remember=yes session=abc", get(ctx, "/page", nil))
+	})
+
+	t.Run("drops expired cookies", func(t *testing.T) {
+		session := httpclient.NewSession("expiring")
+		u, _ := url.Parse(server.URL)
+		session.Jar.SetCookies(u, []*http.Cookie{
+			{Name: "short", Value: "1", Expires: time.Now().Add(50 * time.Millisecond)},
+			{Name: "long", Value: "2", Expires: time.Now().Add(time.Hour)},
+		})
+		time.Sleep(100 * time.Millisecond)
+
+		path := filepath.Join(t.TempDir(), "session.json")
+		if assert.NoError(t, session.Save(path)) {
+			loaded, err := httpclient.LoadSession(path)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "  long=2", get(httpclient.WithSession(context.Background(), loaded), "/page", nil))
+			}
+		}
+	})
+}
+
+// Headers are sent to the domain they are set for, and its subdomains
+func TestSessionHeader(t *testing.T) {
+	session := httpclient.NewSession("example")
+	session.SetHeader(".Example.com", "Accept-Language", "fr")
+	session.SetHeader("news.example.com", "Accept-Language", "en")
+	session.SetHeader("news.example.com", "X-Api-Key", "secret")
+
+	tests := []struct {
+		url      string
+		expected http.Header
+	}{
+		{url: "https://example.com/", expected: http.Header{"Accept-Language": {"fr"}}},
+		{url: "https://www.example.com/", expected: http.Header{"Accept-Language": {"fr"}}},
+		{url: "https://news.example.com/", expected: http.Header{"Accept-Language": {"en"}, "X-Api-Key": {"secret"}}},
+		{url: "https://api.news.example.com/", expected: http.Header{"Accept-Language": {"en"}, "X-Api-Key": {"secret"}}},
+		{url: "https://notexample.com/", expected: http.Header{}},
+		{url: "https://example.com.evil.net/", expected: http.Header{}},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		assert.Equal(t, tt.expected, session.Header(u), tt.url)
+	}
+
+	// Requests without the session, such as those made to third-party APIs, don't get anything
+	ctx := httpclient.WithoutSession(httpclient.WithSession(context.Background(), session))
+	assert.Nil(t, httpclient.SessionFromContext(ctx))
+	assert.Nil(t, httpclient.Resolve(ctx, nil).Jar)
+}
+
+// The client given to Resolve is copied, not modified, to use the session
+func TestResolveSession(t *testing.T) {
+	client := &http.Client{Timeout: time.Second}
+	session := httpclient.NewSession("example")
+	resolved := httpclient.Resolve(httpclient.WithSession(context.Background(), session), client)
+
+	assert.NotSame(t, client, resolved)
+	assert.Equal(t, time.Second, resolved.Timeout)
+	assert.Same(t, session.Jar, resolved.Jar)
+	assert.Nil(t, client.Jar)
+	assert.Nil(t, client.Transport)
+}
@@ -1,9 +1,11 @@
 package gophetch
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"golang.org/x/net/html"
 
 	"github.com/octetic/gophetch/helpers"
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/media"
 )
 
@@ -58,6 +61,12 @@ type ImageFetcher interface {
 	NewImageFromURL(url string, maxSize int) (*media.Media, error)
 }
 
+// ContextImageFetcher is implemented by image fetchers whose downloads can be cancelled with a context.
+type ContextImageFetcher interface {
+	ImageFetcher
+	NewImageFromURLContext(ctx context.Context, url string, maxSize int) (*media.Media, error)
+}
+
 // RealImageFetcher uses the actual implementation
 type RealImageFetcher struct{}
 
@@ -66,6 +75,11 @@ func (r *RealImageFetcher) NewImageFromURL(url string, maxSize int) (*media.Medi
 	return media.NewImageFromURL(url, maxSize)
 }
 
+// NewImageFromURLContext fetches an image from the given URL, bound to the given context.
+func (r *RealImageFetcher) NewImageFromURLContext(ctx context.Context, url string, maxSize int) (*media.Media, error) {
+	return media.NewImageFromURLContext(ctx, url, maxSize)
+}
+
 // UploadFunc is the function signature to use for uploading images to cloud storage.
 type UploadFunc func(*media.Media) (string, error)
 
@@ -85,6 +99,8 @@ type ImageInliner struct {
 	maxHeight      int
 	mediaProxyURL  string
 	relativeURL    *url.URL
+	httpClient     *http.Client
+	session        *httpclient.Session
 }
 
 // ImageInlinerOptions are options for creating a new ImageInliner.
@@ -111,8 +127,15 @@ type ImageInlinerOptions struct {
 	MaxHeight int
 	// MediaProxyURL is the URL to prefix to the image URLs when using the InlineMediaProxy strategy.
 	MediaProxyURL string
-	// RelativeURL is the URL to use to fix relative URLs by making them absolute.
+	// RelativeURL is the URL of the document, used to make relative image URLs absolute. A <base href> in the
+	// document takes precedence.
 	RelativeURL *url.URL
+	// HTTPClient is the client used to download images when the context doesn't carry one. Default is
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Session is the session whose cookies and headers are sent with the image downloads when the context doesn't
+	// carry one, see Gophetch.WithSession. Default is no session.
+	Session *httpclient.Session
 }
 
 // NewImageInliner creates a new ImageInliner with the given fetcher, upload function, and storage strategy.
@@ -174,17 +197,34 @@ func NewImageInliner(opts ImageInlinerOptions) *ImageInliner {
 		maxHeight:      maxHeight,
 		mediaProxyURL:  opts.MediaProxyURL,
 		relativeURL:    opts.RelativeURL,
+		httpClient:     opts.HTTPClient,
+		session:        opts.Session,
 	}
 }
 
 // InlineImages replaces image URLs with either base64 inline versions or cloud URLs based on the set strategy.
 func (inliner *ImageInliner) InlineImages(readableHTML string) (string, error) {
+	return inliner.InlineImagesContext(context.Background(), readableHTML)
+}
+
+// InlineImagesContext is like InlineImages, but the image downloads are bound to the given context. If the context
+// is done before all images are processed, an error is returned instead of a partially inlined document. If the
+// context's deadline is exceeded, the error wraps ErrTimeout.
+func (inliner *ImageInliner) InlineImagesContext(ctx context.Context, readableHTML string) (string, error) {
 	var wg sync.WaitGroup
 
+	if inliner.httpClient != nil && httpclient.FromContext(ctx) == nil {
+		ctx = httpclient.WithClient(ctx, inliner.httpClient)
+	}
+	if inliner.session != nil && httpclient.SessionFromContext(ctx) == nil {
+		ctx = httpclient.WithSession(ctx, inliner.session)
+	}
+
 	doc, err := html.Parse(strings.NewReader(readableHTML))
 	if err != nil {
 		return "", err
 	}
+	base := helpers.DocumentBase(doc, inliner.relativeURL)
 
 	// Find all image nodes
 	imgSelector, err := cascadia.Compile("img, video, picture > source")
@@ -212,15 +252,15 @@ func (inliner *ImageInliner) InlineImages(readableHTML string) (string, error) {
 					switch inliner.inlineStrategy {
 					case InlineAll:
 						// StrategyInline as base64
-						attr.Val = inliner.fetchAndInline(attr)
+						attr.Val = inliner.fetchAndInline(ctx, attr, base)
 					case InlineNone:
 						// Upload to cloud storage and replace URL
-						attr.Val = inliner.uploadAndReplaceAttr(attr)
+						attr.Val = inliner.uploadAndReplaceAttr(ctx, attr, base)
 					case InlineHybrid:
 						// Hybrid strategy
-						attr.Val = inliner.processHybrid(attr)
+						attr.Val = inliner.processHybrid(ctx, attr, base)
 					case InlineMediaProxy:
-						attr.Val = inliner.prefixProxy(attr)
+						attr.Val = inliner.prefixProxy(attr, base)
 					}
 				}
 			}
@@ -230,6 +270,10 @@ func (inliner *ImageInliner) InlineImages(readableHTML string) (string, error) {
 	// Wait for all go routines to finish
 	wg.Wait()
 
+	if err := ctx.Err(); err != nil {
+		return "", wrapTimeout(err, "inlining images")
+	}
+
 	// Convert the modified doc back to HTML string
 	var b strings.Builder
 	if err := html.Render(&b, doc); err != nil {
@@ -239,8 +283,8 @@ func (inliner *ImageInliner) InlineImages(readableHTML string) (string, error) {
 	return b.String(), nil
 }
 
-func (inliner *ImageInliner) fetchAndInline(attr *html.Attribute) string {
-	urls, descriptors := inliner.parseSrcAndSrcset(attr)
+func (inliner *ImageInliner) fetchAndInline(ctx context.Context, attr *html.Attribute, base *url.URL) string {
+	urls, descriptors := inliner.parseSrcAndSrcset(attr, base)
 	if attr.Key == "srcset" {
 		urls, descriptors = inliner.selectSrcsetURL(urls, descriptors)
 	}
@@ -248,7 +292,7 @@ func (inliner *ImageInliner) fetchAndInline(attr *html.Attribute) string {
 	var newURLs []string
 
 	for i, u := range urls {
-		img, err := inliner.fetcher.NewImageFromURL(u, int(inliner.maxContentSize))
+		img, err := inliner.fetchImage(ctx, u)
 		if err != nil {
 			log.Printf("Failed to download image: %v", err)
 			continue
@@ -265,8 +309,8 @@ func (inliner *ImageInliner) fetchAndInline(attr *html.Attribute) string {
 }
 
 // This strategy does not download an image. Instead, it prefixes the URL with the proxy URL.
-func (inliner *ImageInliner) prefixProxy(attr *html.Attribute) string {
-	urls, descriptors := inliner.parseSrcAndSrcset(attr)
+func (inliner *ImageInliner) prefixProxy(attr *html.Attribute, base *url.URL) string {
+	urls, descriptors := inliner.parseSrcAndSrcset(attr, base)
 	if attr.Key == "srcset" {
 		urls, descriptors = inliner.selectSrcsetURL(urls, descriptors)
 	}
@@ -274,10 +318,6 @@ func (inliner *ImageInliner) prefixProxy(attr *html.Attribute) string {
 	var newURLs []string
 
 	for i, u := range urls {
-		if inliner.relativeURL != nil {
-			u = helpers.FixRelativePath(inliner.relativeURL, u)
-		}
-
 		qryURL := url.QueryEscape(u)
 		// if the mediaProxyURL already has an ending slash, remove it
 		if strings.HasSuffix(inliner.mediaProxyURL, "/") {
@@ -295,8 +335,8 @@ func (inliner *ImageInliner) prefixProxy(attr *html.Attribute) string {
 	return strings.Join(newURLs, ", ")
 }
 
-func (inliner *ImageInliner) processHybrid(attr *html.Attribute) string {
-	urls, descriptors := inliner.parseSrcAndSrcset(attr)
+func (inliner *ImageInliner) processHybrid(ctx context.Context, attr *html.Attribute, base *url.URL) string {
+	urls, descriptors := inliner.parseSrcAndSrcset(attr, base)
 	if attr.Key == "srcset" {
 		urls, descriptors = inliner.selectSrcsetURL(urls, descriptors)
 	}
@@ -304,7 +344,7 @@ func (inliner *ImageInliner) processHybrid(attr *html.Attribute) string {
 	var newURLs []string
 
 	for i, u := range urls {
-		img, err := inliner.fetcher.NewImageFromURL(u, int(inliner.maxContentSize))
+		img, err := inliner.fetchImage(ctx, u)
 		if err != nil {
 			newURLs = append(newURLs, u)
 			continue
@@ -330,8 +370,8 @@ func (inliner *ImageInliner) processHybrid(attr *html.Attribute) string {
 	return strings.Join(newURLs, ", ")
 }
 
-func (inliner *ImageInliner) uploadAndReplaceAttr(attr *html.Attribute) string {
-	urls, descriptors := inliner.parseSrcAndSrcset(attr)
+func (inliner *ImageInliner) uploadAndReplaceAttr(ctx context.Context, attr *html.Attribute, base *url.URL) string {
+	urls, descriptors := inliner.parseSrcAndSrcset(attr, base)
 	if attr.Key == "srcset" {
 		urls, descriptors = inliner.selectSrcsetURL(urls, descriptors)
 	}
@@ -339,7 +379,7 @@ func (inliner *ImageInliner) uploadAndReplaceAttr(attr *html.Attribute) string {
 	var newURLs []string
 
 	for i, u := range urls {
-		img, err := inliner.fetcher.NewImageFromURL(u, int(inliner.maxContentSize))
+		img, err := inliner.fetchImage(ctx, u)
 		if err != nil {
 			log.Printf("Failed to download image: %v", err)
 			continue
@@ -360,28 +400,41 @@ func (inliner *ImageInliner) uploadAndReplaceAttr(attr *html.Attribute) string {
 	return strings.Join(newURLs, ", ")
 }
 
-func (inliner *ImageInliner) parseSrcAndSrcset(attr *html.Attribute) ([]string, []string) {
+// fetchImage downloads the image with the configured fetcher, passing the context along when the fetcher supports it.
+func (inliner *ImageInliner) fetchImage(ctx context.Context, u string) (*media.Media, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cf, ok := inliner.fetcher.(ContextImageFetcher); ok {
+		return cf.NewImageFromURLContext(ctx, u, int(inliner.maxContentSize))
+	}
+	return inliner.fetcher.NewImageFromURL(u, int(inliner.maxContentSize))
+}
+
+// parseSrcAndSrcset returns the URLs of a src, poster or srcset attribute, resolved against base, along with the
+// descriptors of a srcset.
+func (inliner *ImageInliner) parseSrcAndSrcset(attr *html.Attribute, base *url.URL) ([]string, []string) {
 	var urls []string
 	var descriptors []string
 
-	if attr.Key == "src" {
-		urls = []string{attr.Val}
+	if attr.Key == "srcset" {
+		urls, descriptors = ExtractSrcset(attr.Val, base)
 	} else {
-		urls, descriptors = ExtractSrcset(attr.Val, inliner.relativeURL)
+		urls = []string{helpers.ResolveURL(base, attr.Val)}
 	}
 
 	return urls, descriptors
 }
 
 // ExtractSrcset attempts to match all srcset URLs including their descriptors,
-// accounting for commas within the URLs.
+// accounting for commas within the URLs. The URLs are resolved against relativeURL, if given.
 func ExtractSrcset(srcset string, relativeURL *url.URL) ([]string, []string) {
 	// This regex captures the URL and the descriptor as separate groups
-	// - (?:https?://|//|/)\S+ is a capturing group that matches a URL starting with https:// and continues without any space or comma.
+	// - [^\s,]\S* is a capturing group that matches a URL, absolute or relative, and continues without any space.
 	// - \s+\d+(?:\.\d+)?[wx] matches one or more spaces followed by one or more digits (with optional decimal) and then 'w' or 'x', which represent the descriptors.
 	// - (,|\s|$) ensures that this pattern is followed by a comma, whitespace, or the end of the string, meaning it's the end of a URL/descriptor segment.
 	// re := regexp.MustCompile(`(https://\S+)((\s+\d+(?:\.\d+)?[wx])+)(?:,|$)`)
-	re := regexp.MustCompile(`((?:https?://|//|/)\S+)((\s+\d+(?:\.\d+)?[wx])+)(?:,|$)`)
+	re := regexp.MustCompile(`([^\s,]\S*)((\s+\d+(?:\.\d+)?[wx])+)(?:,|$)`)
 
 	// Find all matches for the pattern.
 	matches := re.FindAllStringSubmatch(strings.TrimSpace(srcset), -1)
@@ -391,9 +444,7 @@ func ExtractSrcset(srcset string, relativeURL *url.URL) ([]string, []string) {
 
 	for _, match := range matches {
 		if len(match) > 2 {
-			if relativeURL != nil {
-				match[1] = helpers.FixRelativePath(relativeURL, match[1])
-			}
+			match[1] = helpers.ResolveURL(relativeURL, match[1])
 			urls = append(urls, match[1])                                  // The URL is in the first capture group
 			descriptors = append(descriptors, strings.TrimSpace(match[2])) // The descriptor is in the second capture group
 		}
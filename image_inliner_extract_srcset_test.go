@@ -123,6 +123,16 @@ func TestExtractSrcset(t *testing.T) {
 			},
 			expectedDescs: []string{"484w 1x", "968w 2x", "1936w 3x"},
 		},
+		{
+			name:   "multiple sources with document relative URLs",
+			srcset: `../images/image1.png 1x, image2.png?w=2 2x,./image3.png 3x`,
+			expectedURLs: []string{
+				"https://example.com/foo/images/image1.png",
+				"https://example.com/foo/bar/image2.png?w=2",
+				"https://example.com/foo/bar/image3.png",
+			},
+			expectedDescs: []string{"1x", "2x", "3x"},
+		},
 		{
 			name:          "empty srcset",
 			srcset:        ``,
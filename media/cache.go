@@ -15,6 +15,8 @@ type Cache struct {
 	NoCache        bool
 	NoStore        bool
 	MustRevalidate bool
+	// Private means the response is meant for a single user, and must not be stored by a shared cache.
+	Private bool
 }
 
 // ParseCacheHeader takes a http.Header and returns the parsed Cache
@@ -38,6 +40,7 @@ func parseCacheControlHeader(header http.Header) (Cache, bool) {
 		NoCache:        false,
 		NoStore:        false,
 		MustRevalidate: false,
+		Private:        false,
 	}
 
 	// Extract Cache-Control header
@@ -50,13 +53,17 @@ func parseCacheControlHeader(header http.Header) (Cache, bool) {
 		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
 		switch parts[0] {
 		case "max-age":
-			ccInfo.MaxAge = parseMaxAge(parts[1])
+			if len(parts) == 2 {
+				ccInfo.MaxAge = parseMaxAge(parts[1])
+			}
 		case "no-cache":
 			ccInfo.NoCache = true
 		case "no-store":
 			ccInfo.NoStore = true
 		case "must-revalidate":
 			ccInfo.MustRevalidate = true
+		case "private":
+			ccInfo.Private = true
 		}
 	}
 
@@ -55,6 +55,17 @@ func TestParseCacheHeader(t *testing.T) {
 				MustRevalidate: true,
 			},
 		},
+		{
+			name: "Cache-Control private",
+			header: http.Header{
+				"Cache-Control": []string{"private, max-age=60"},
+			},
+			expected: media.Cache{
+				Available: true,
+				MaxAge:    60,
+				Private:   true,
+			},
+		},
 		{
 			name: "Cache-Control no-cache, no-store",
 			header: http.Header{
@@ -134,6 +145,19 @@ func TestParseCacheHeader(t *testing.T) {
 				MustRevalidate: false,
 			},
 		},
+		{
+			name: "Max-Age directive without a value",
+			header: http.Header{
+				"Cache-Control": []string{"max-age, must-revalidate"},
+			},
+			expected: media.Cache{
+				Available:      true,
+				MaxAge:         -1,
+				NoCache:        false,
+				NoStore:        false,
+				MustRevalidate: true,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -144,6 +168,7 @@ func TestParseCacheHeader(t *testing.T) {
 			assert.Equal(t, tc.expected.NoCache, actual.NoCache, "NoCache mismatch")
 			assert.Equal(t, tc.expected.NoStore, actual.NoStore, "NoStore mismatch")
 			assert.Equal(t, tc.expected.MustRevalidate, actual.MustRevalidate, "MustRevalidate mismatch")
+			assert.Equal(t, tc.expected.Private, actual.Private, "Private mismatch")
 
 			// TODO: add more specific requirements on how to compare `Expires`
 			if !tc.expected.Expires.IsZero() {
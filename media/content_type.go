@@ -1,9 +1,12 @@
 package media
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/octetic/gophetch/httpclient"
 )
 
 var contentTypeToExt = map[string][]string{
@@ -172,7 +175,16 @@ func ExtensionByContentType(contentType string) (string, error) {
 // cannot be extracted using a HEAD request, it will attempt to get it by making a GET request
 // to the URL and reviewing the first 512 KB. An error is returned if the Content-Type header still cannot be extracted.
 func ContentTypeFromURL(url string) (string, error) {
-	resp, err := http.Head(url)
+	return ContentTypeFromURLContext(context.Background(), url)
+}
+
+// ContentTypeFromURLContext is like ContentTypeFromURL, but the requests are bound to the given context.
+func ContentTypeFromURLContext(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpclient.Resolve(ctx, nil).Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -182,7 +194,7 @@ func ContentTypeFromURL(url string) (string, error) {
 
 	// Check for a successful or redirected response
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		meta, err := FetchMetadataFromHeader(url, defaultMaxBytes)
+		meta, err := FetchMetadataFromHeaderContext(ctx, url, defaultMaxBytes)
 		if err != nil {
 			return "", err
 		}
@@ -2,6 +2,7 @@ package media
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -11,9 +12,12 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/octetic/gophetch/httpclient"
 )
 
 // DefaultMaxMediaSize represents the default maximum number of bytes we are willing to download for an image. (10 MB)
@@ -26,6 +30,7 @@ const (
 	VideoType
 	AudioType
 	VectorImageType // For SVGs, ICOs, etc.
+	DocumentType    // For PDFs
 )
 
 type Media struct {
@@ -179,13 +184,37 @@ func NewImageFromBytes(data []byte) (*Media, error) {
 	}, nil
 }
 
+// NewPDFFromBytes returns the PDF document in the given bytes. It returns an error if data is not a PDF file.
+func NewPDFFromBytes(data []byte) (*Media, error) {
+	if !isPDF(data) {
+		return nil, errors.New("not a PDF file")
+	}
+
+	return &Media{
+		Bytes:       data,
+		ContentSize: int64(len(data)),
+		Metadata: Metadata{
+			ContentSize: int64(len(data)),
+			ContentType: "application/pdf",
+		},
+		Format:    "pdf",
+		Extension: ".pdf",
+		MediaType: DocumentType,
+	}, nil
+}
+
 // NewMediaFromURL will download the media from the given URL and return the media and metadata, but only if it is within the MaxMediaSize.
 func NewMediaFromURL(mediaURL string, maxSize int) (*Media, error) {
+	return NewMediaFromURLContext(context.Background(), mediaURL, maxSize)
+}
+
+// NewMediaFromURLContext is like NewMediaFromURL, but the download is bound to the given context.
+func NewMediaFromURLContext(ctx context.Context, mediaURL string, maxSize int) (*Media, error) {
 	if maxSize <= 0 {
 		maxSize = DefaultMaxMediaSize
 	}
 
-	resp, err := http.Get(mediaURL)
+	resp, err := get(ctx, mediaURL)
 	if err != nil {
 		return nil, err
 	}
@@ -218,7 +247,12 @@ func NewMediaFromURL(mediaURL string, maxSize int) (*Media, error) {
 
 // NewImageFromURL will download the image from the given URL and return the image and metadata, but only if it is within the MaxImageSize.
 func NewImageFromURL(imgURL string, maxSize int) (*Media, error) {
-	resp, err := http.Get(imgURL)
+	return NewImageFromURLContext(context.Background(), imgURL, maxSize)
+}
+
+// NewImageFromURLContext is like NewImageFromURL, but the download is bound to the given context.
+func NewImageFromURLContext(ctx context.Context, imgURL string, maxSize int) (*Media, error) {
+	resp, err := get(ctx, imgURL)
 	if err != nil {
 		return nil, err
 	}
@@ -402,6 +436,48 @@ func NewAudioVideoFromHTTPResponse(resp *http.Response, mediaURL string, maxSize
 	return media, nil
 }
 
+// NewMediaFromHTTPHeader describes the media in the given response from its headers only, without reading the body.
+// This is useful for audio and video files, which are too large to download just to learn their type and size. The
+// content size is zero if the server didn't send a Content-Length.
+func NewMediaFromHTTPHeader(resp *http.Response, mediaURL string) *Media {
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	extension, err := ExtensionByContentType(contentType)
+	if err != nil {
+		extension = ""
+	}
+
+	var size int64
+	if resp.ContentLength > 0 {
+		size = resp.ContentLength
+	}
+
+	mediaType := ImageType
+	switch {
+	case strings.HasPrefix(contentType, "video/"):
+		mediaType = VideoType
+	case strings.HasPrefix(contentType, "audio/"):
+		mediaType = AudioType
+	case strings.HasPrefix(contentType, "image/svg"), contentType == "image/x-icon",
+		contentType == "image/vnd.microsoft.icon":
+		mediaType = VectorImageType
+	}
+
+	return &Media{
+		ContentSize: size,
+		Metadata: Metadata{
+			ContentSize: size,
+			ContentType: contentType,
+		},
+		Extension: extension,
+		URL:       mediaURL,
+		Cache:     ParseCacheHeader(resp.Header),
+		MediaType: mediaType,
+	}
+}
+
 // NewImageFromDataURI will parse the data URI and return the image and metadata. It will attempt to get the
 // ContentType, Width, Height, Format, and ContentSize from the data URI as well.
 func NewImageFromDataURI(dataURI string) (*Media, error) {
@@ -432,3 +508,13 @@ func DataURIToBytes(dataURI string) ([]byte, error) {
 	// Decode the Base64 data
 	return base64.StdEncoding.DecodeString(data)
 }
+
+// get issues a GET request for the given URL that is bound to the given context. It uses the client carried by the
+// context, see httpclient.WithClient.
+func get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.Resolve(ctx, nil).Do(req)
+}
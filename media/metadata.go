@@ -1,12 +1,12 @@
 package media
 
 import (
+	"context"
 	"fmt"
 	_ "image/gif"  // This is required to initialize the GIF decoder
 	_ "image/jpeg" // This is required to initialize the JPEG decoder
 	_ "image/png"  // This is required to initialize the PNG decoder
 	"io"
-	"net/http"
 
 	_ "github.com/biessek/golang-ico"
 	_ "golang.org/x/image/bmp"
@@ -28,7 +28,12 @@ var defaultMaxBytes = 524288 // 512 KB
 // be extracted within the first maxBytes, an error is returned. This is useful for validating images without
 // downloading the entire image.
 func FetchMetadataFromHeader(imgURL string, maxBytes int) (Metadata, error) {
-	resp, err := http.Get(imgURL)
+	return FetchMetadataFromHeaderContext(context.Background(), imgURL, maxBytes)
+}
+
+// FetchMetadataFromHeaderContext is like FetchMetadataFromHeader, but the request is bound to the given context.
+func FetchMetadataFromHeaderContext(ctx context.Context, imgURL string, maxBytes int) (Metadata, error) {
+	resp, err := get(ctx, imgURL)
 	if err != nil {
 		return Metadata{}, err
 	}
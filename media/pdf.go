@@ -0,0 +1,395 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// maxPDFStreamSize is the most we are willing to inflate from a single compressed object stream.
+	maxPDFStreamSize = 4 * 1024 * 1024
+	// maxPDFInflatedSize is the most we are willing to inflate from all the object streams of a file.
+	maxPDFInflatedSize = 16 * 1024 * 1024
+	// maxPDFObjectStreams is the most object streams we are willing to inflate from a file.
+	maxPDFObjectStreams = 256
+)
+
+// PDFInfo holds the document information of a PDF file.
+type PDFInfo struct {
+	Title      string
+	Author     string
+	Subject    string
+	Keywords   string
+	Creator    string
+	Producer   string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Pages      int
+}
+
+var (
+	pdfInfoRefRegex  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfPagesRegex    = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfPageRegex     = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfCountRegex    = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfStreamRegex   = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pdfObjStmNRegex  = regexp.MustCompile(`/N\s+(\d+)`)
+	pdfObjStmFirstRe = regexp.MustCompile(`/First\s+(\d+)`)
+
+	// pdfDictStringRegexes match the keys of the text strings read from the document information dictionary.
+	pdfDictStringRegexes = map[string]*regexp.Regexp{}
+)
+
+func init() {
+	for _, key := range []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer", "CreationDate", "ModDate"} {
+		pdfDictStringRegexes[key] = regexp.MustCompile(`/` + key + `\s*([(<])`)
+	}
+}
+
+// isPDF reports whether data starts with the header of a PDF file.
+func isPDF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-"))
+}
+
+// ParsePDFInfo reads the document information dictionary and the page count of a PDF file. Both plain objects and
+// the compressed object streams used since PDF 1.5 are supported. It returns an error if data is not a PDF file.
+func ParsePDFInfo(data []byte) (PDFInfo, error) {
+	if !isPDF(data) {
+		return PDFInfo{}, errors.New("not a PDF file")
+	}
+
+	objects := pdfObjectStreams(data)
+
+	var info PDFInfo
+	if dict, ok := pdfInfoDict(data, objects); ok {
+		info.Title = pdfDictString(dict, "Title")
+		info.Author = pdfDictString(dict, "Author")
+		info.Subject = pdfDictString(dict, "Subject")
+		info.Keywords = pdfDictString(dict, "Keywords")
+		info.Creator = pdfDictString(dict, "Creator")
+		info.Producer = pdfDictString(dict, "Producer")
+		info.CreatedAt = parsePDFDate(pdfDictString(dict, "CreationDate"))
+		info.ModifiedAt = parsePDFDate(pdfDictString(dict, "ModDate"))
+	}
+
+	sources := [][]byte{data}
+	for _, obj := range objects {
+		sources = append(sources, obj)
+	}
+	info.Pages = pdfPageCount(sources)
+
+	return info, nil
+}
+
+// pdfInfoDict finds the document information dictionary referenced by the trailer, either as a plain object or
+// inside an object stream.
+func pdfInfoDict(data []byte, objects map[int][]byte) ([]byte, bool) {
+	// The last trailer is the most recent one
+	refs := pdfInfoRefRegex.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return nil, false
+	}
+	ref := refs[len(refs)-1]
+	num, _ := strconv.Atoi(string(ref[1]))
+
+	if obj, ok := objects[num]; ok {
+		return obj, true
+	}
+
+	objRegex := regexp.MustCompile(`(?s)(?:^|[^0-9])` + string(ref[1]) + `\s+` + string(ref[2]) + `\s+obj(.*?)endobj`)
+	matches := objRegex.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[len(matches)-1][1], true
+}
+
+// pdfObjectStreams inflates the compressed object streams of a PDF file, and returns the objects they hold by
+// object number. It stops once maxPDFObjectStreams streams or maxPDFInflatedSize bytes are inflated.
+func pdfObjectStreams(data []byte) map[int][]byte {
+	objects := make(map[int][]byte)
+	streams, inflated := 0, 0
+	for _, loc := range pdfStreamRegex.FindAllIndex(data, -1) {
+		if streams >= maxPDFObjectStreams || inflated >= maxPDFInflatedSize {
+			break
+		}
+
+		// The stream dictionary starts after the object's header
+		objStart := bytes.LastIndex(data[:loc[0]], []byte("obj"))
+		if objStart < 0 {
+			continue
+		}
+		dict := data[objStart:loc[0]]
+		if !bytes.Contains(dict, []byte("/ObjStm")) || !bytes.Contains(dict, []byte("/FlateDecode")) {
+			continue
+		}
+
+		end := bytes.Index(data[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		streams++
+		limit := maxPDFStreamSize
+		if left := maxPDFInflatedSize - inflated; left < limit {
+			limit = left
+		}
+		content, err := inflate(data[loc[1]:loc[1]+end], limit)
+		inflated += len(content)
+		if err != nil {
+			continue
+		}
+
+		n := pdfDictInt(dict, pdfObjStmNRegex)
+		first := pdfDictInt(dict, pdfObjStmFirstRe)
+		if n <= 0 || first <= 0 || first > len(content) {
+			continue
+		}
+
+		// The stream starts with pairs of object numbers and offsets relative to the first object
+		header := strings.Fields(string(content[:first]))
+		for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+			num, err1 := strconv.Atoi(header[i])
+			offset, err2 := strconv.Atoi(header[i+1])
+			// The offsets of a corrupt stream can point anywhere, even before the first object
+			if err1 != nil || err2 != nil || offset < 0 || offset > len(content)-first {
+				continue
+			}
+			objEnd := len(content)
+			if i+3 < len(header) {
+				if next, err := strconv.Atoi(header[i+3]); err == nil && next > offset && next <= len(content)-first {
+					objEnd = first + next
+				}
+			}
+			if objEnd < first+offset {
+				continue
+			}
+			objects[num] = content[first+offset : objEnd]
+		}
+	}
+	return objects
+}
+
+// pdfPageCount returns the page count from the root of the page tree, which has the highest count, falling back to
+// counting the page objects.
+func pdfPageCount(sources [][]byte) int {
+	pages := 0
+	for _, source := range sources {
+		for _, loc := range pdfPagesRegex.FindAllIndex(source, -1) {
+			dict := pdfEnclosingDict(source, loc[0])
+			if m := pdfCountRegex.FindSubmatch(dict); m != nil {
+				if count, err := strconv.Atoi(string(m[1])); err == nil && count > pages {
+					pages = count
+				}
+			}
+		}
+	}
+	if pages > 0 {
+		return pages
+	}
+
+	for _, source := range sources {
+		pages += len(pdfPageRegex.FindAllIndex(source, -1))
+	}
+	return pages
+}
+
+// pdfEnclosingDict returns the dictionary around the given position, or a window around it if the dictionary
+// can't be delimited.
+func pdfEnclosingDict(data []byte, pos int) []byte {
+	start := bytes.LastIndex(data[:pos], []byte("<<"))
+	if start < 0 {
+		start = 0
+	}
+	end := bytes.Index(data[pos:], []byte(">>"))
+	if end < 0 {
+		end = len(data) - pos
+	}
+	return data[start : pos+end]
+}
+
+func pdfDictInt(dict []byte, re *regexp.Regexp) int {
+	m := re.FindSubmatch(dict)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	return n
+}
+
+// pdfDictString returns the text string stored under the given key of the document information dictionary, or an
+// empty string.
+func pdfDictString(dict []byte, key string) string {
+	re, ok := pdfDictStringRegexes[key]
+	if !ok {
+		return ""
+	}
+	loc := re.FindSubmatchIndex(dict)
+	if loc == nil {
+		return ""
+	}
+
+	var raw []byte
+	if dict[loc[2]] == '(' {
+		raw = pdfLiteralString(dict[loc[2]+1:])
+	} else {
+		raw = pdfHexString(dict[loc[2]+1:])
+	}
+	return strings.TrimSpace(pdfTextString(raw))
+}
+
+// pdfLiteralString decodes a literal string, starting right after its opening parenthesis.
+func pdfLiteralString(data []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case '\\':
+			i++
+			if i >= len(data) {
+				return out
+			}
+			switch e := data[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string on the next one
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				value := 0
+				j := i
+				for ; j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7'; j++ {
+					value = value*8 + int(data[j]-'0')
+				}
+				i = j - 1
+				c = byte(value)
+			default:
+				c = e
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// pdfHexString decodes a hexadecimal string, starting right after its opening angle bracket.
+func pdfHexString(data []byte) []byte {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		value, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(value)
+	}
+	return out
+}
+
+// pdfTextString converts a PDF text string to UTF-8. Text strings are either UTF-16BE with a byte order mark, or
+// PDFDocEncoding, which matches Latin-1 for the printable characters.
+func pdfTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(raw) >= 3 && raw[0] == 0xef && raw[1] == 0xbb && raw[2] == 0xbf {
+		return string(raw[3:])
+	}
+
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// parsePDFDate parses a PDF date such as "D:20230415103000+02'00'". Any trailing part may be missing.
+func parsePDFDate(value string) time.Time {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "D:")
+	digits := 0
+	for digits < len(value) && digits < 14 && value[digits] >= '0' && value[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 {
+		return time.Time{}
+	}
+
+	// Fill in the missing parts with their lowest value
+	stamp := value[:digits] + "0101000000"[digits-4:]
+	t, err := time.Parse("20060102150405", stamp)
+	if err != nil {
+		return time.Time{}
+	}
+
+	zone := strings.ReplaceAll(value[digits:], "'", "")
+	if len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		hours, errH := strconv.Atoi(zone[1:3])
+		minutes := 0
+		if len(zone) >= 5 {
+			minutes, _ = strconv.Atoi(zone[3:5])
+		}
+		if errH == nil {
+			offset := hours*3600 + minutes*60
+			if zone[0] == '-' {
+				offset = -offset
+			}
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", offset))
+		}
+	}
+	return t
+}
+
+// inflate decompresses zlib data, up to limit bytes.
+func inflate(data []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	content, err := io.ReadAll(io.LimitReader(r, int64(limit)))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return content, nil
+}
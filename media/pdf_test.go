@@ -0,0 +1,141 @@
+package media_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/media"
+)
+
+// plainPDF is a minimal PDF with uncompressed objects.
+const plainPDF = `%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 >>
+endobj
+3 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+4 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+5 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+6 0 obj
+<< /Title (Annual Report \(2023\)) /Author <FEFF004A006F00EB006C> /Subject (Caf\351 finances)
+/Producer (Writer) /CreationDate (D:20230415103000+02'00') >>
+endobj
+trailer
+<< /Size 7 /Root 1 0 R /Info 6 0 R >>
+%%EOF
+`
+
+// compressedPDF builds a PDF 1.5 file whose info dictionary and page tree are in a compressed object stream.
+func compressedPDF() []byte {
+	objects := []string{
+		"<< /Type /Pages /Kids [] /Count 12 >>",
+		"<< /Title (Compressed Title) /Author (Jane Doe) /ModDate (D:2021) >>",
+	}
+	var header, body bytes.Buffer
+	for i, obj := range objects {
+		_, _ = fmt.Fprintf(&header, "%d %d ", i+2, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	return objectStreamPDF(header.String(), body.String())
+}
+
+// objectStreamPDF builds a PDF 1.5 file whose objects 2 and 3 are in a compressed object stream, given the header of
+// the stream, with the numbers and offsets of the objects, and their contents.
+func objectStreamPDF(header, body string) []byte {
+	var stream bytes.Buffer
+	w := zlib.NewWriter(&stream)
+	_, _ = w.Write([]byte(header + body))
+	_ = w.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.5\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	_, _ = fmt.Fprintf(&pdf, "4 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(header), stream.Len())
+	pdf.Write(stream.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("5 0 obj\n<< /Type /XRef /Root 1 0 R /Info 3 0 R /Size 6 >>\nstream\n\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestParsePDFInfo(t *testing.T) {
+	t.Run("plain objects", func(t *testing.T) {
+		info, err := media.ParsePDFInfo([]byte(plainPDF))
+		assert.NoError(t, err)
+		assert.Equal(t, "Annual Report (2023)", info.Title)
+		assert.Equal(t, "Joël", info.Author)
+		assert.Equal(t, "Café finances", info.Subject)
+		assert.Equal(t, "Writer", info.Producer)
+		assert.Equal(t, 3, info.Pages)
+		assert.True(t, info.CreatedAt.Equal(time.Date(2023, 4, 15, 8, 30, 0, 0, time.UTC)))
+	})
+
+	t.Run("compressed object stream", func(t *testing.T) {
+		info, err := media.ParsePDFInfo(compressedPDF())
+		assert.NoError(t, err)
+		assert.Equal(t, "Compressed Title", info.Title)
+		assert.Equal(t, "Jane Doe", info.Author)
+		assert.Equal(t, 12, info.Pages)
+		assert.Equal(t, 2021, info.ModifiedAt.Year())
+	})
+
+	// The offsets of a corrupt object stream are skipped
+	t.Run("malformed object stream", func(t *testing.T) {
+		for _, header := range []string{"2 -50 3 10 ", "2 0 3 -5 ", "2 5 3 2 ", "2 9223372036854775807 3 0 "} {
+			body := "<< /Type /Pages /Kids [] /Count 12 >>\n"
+			assert.NotPanics(t, func() {
+				_, _ = media.ParsePDFInfo(objectStreamPDF(header, body))
+				_, _ = media.NewPDFFromBytes(objectStreamPDF(header, body))
+			}, header)
+		}
+	})
+
+	// Only so many object streams are inflated, the ones after are ignored
+	t.Run("object stream limit", func(t *testing.T) {
+		var filler bytes.Buffer
+		w := zlib.NewWriter(&filler)
+		_, _ = w.Write([]byte("6 0 << /Type /Page >>\n"))
+		_ = w.Close()
+
+		var pdf bytes.Buffer
+		for i := 0; i < 300; i++ {
+			_, _ = fmt.Fprintf(&pdf, "%d 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode >>\nstream\n", i+10)
+			pdf.Write(filler.Bytes())
+			pdf.WriteString("\nendstream\nendobj\n")
+		}
+		info, err := media.ParsePDFInfo(append(compressedPDF(), pdf.Bytes()...))
+		assert.NoError(t, err)
+		assert.Equal(t, "Compressed Title", info.Title)
+
+		info, err = media.ParsePDFInfo(append(append([]byte("%PDF-1.5\n"), pdf.Bytes()...), compressedPDF()...))
+		assert.NoError(t, err)
+		assert.Empty(t, info.Title)
+	})
+
+	t.Run("not a PDF", func(t *testing.T) {
+		_, err := media.ParsePDFInfo([]byte("<html></html>"))
+		assert.Error(t, err)
+	})
+}
+
+func TestNewPDFFromBytes(t *testing.T) {
+	m, err := media.NewPDFFromBytes([]byte("%PDF-1.7\n truncated"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, media.DocumentType, m.MediaType)
+		assert.Equal(t, "application/pdf", m.Metadata.ContentType)
+	}
+
+	_, err = media.NewPDFFromBytes([]byte("<html></html>"))
+	assert.Error(t, err)
+}
@@ -1,8 +1,15 @@
 package media
 
+import "context"
+
 // IsValidImage checks if the given URL is a valid image.
 func IsValidImage(url string) bool {
-	contentType, err := ContentTypeFromURL(url)
+	return IsValidImageContext(context.Background(), url)
+}
+
+// IsValidImageContext is like IsValidImage, but the check is bound to the given context.
+func IsValidImageContext(ctx context.Context, url string) bool {
+	contentType, err := ContentTypeFromURLContext(ctx, url)
 	if err != nil {
 		return false
 	}
@@ -11,7 +18,12 @@ func IsValidImage(url string) bool {
 
 // IsValidFavicon checks if the given URL is a valid favicon.
 func IsValidFavicon(url string) bool {
-	contentType, err := ContentTypeFromURL(url)
+	return IsValidFaviconContext(context.Background(), url)
+}
+
+// IsValidFaviconContext is like IsValidFavicon, but the check is bound to the given context.
+func IsValidFaviconContext(ctx context.Context, url string) bool {
+	contentType, err := ContentTypeFromURLContext(ctx, url)
 	if err != nil {
 		return false
 	}
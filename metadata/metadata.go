@@ -1,37 +1,43 @@
 package metadata
 
+import "time"
+
 // Metadata is the struct that encapsulates the extracted metadata.
 type Metadata struct {
-	Audio            Audio          `json:"audio"`
-	Author           string         `json:"author"`
-	CanonicalURL     string         `json:"canonical_url"`
-	CleanURL         string         `json:"clean_url"`
-	Date             string         `json:"date"`
-	Description      string         `json:"description"`
-	FaviconURL       string         `json:"favicon_url"`
-	FeedURLs         []string       `json:"feed_url"`
-	HTML             string         `json:"html"`
-	IsReadable       bool           `json:"is_readable"`
-	Kind             string         `json:"kind"`
-	Lang             string         `json:"lang"`
-	LeadImageInMeta  bool           `json:"lead_image_in_meta"`
-	LeadImageURL     string         `json:"lead_image_url"`
-	Meta             Meta           `json:"meta"`
-	Publisher        string         `json:"publisher"`
-	ReadableByline   string         `json:"readable_byline"`
-	ReadableExcerpt  string         `json:"readable_excerpt"`
-	ReadableHTML     string         `json:"readable_html"`
-	ReadableImage    string         `json:"readable_image"`
-	ReadableLang     string         `json:"readable_lang"`
-	ReadableLength   int            `json:"readable_length"`
-	ReadableSiteName string         `json:"readable_site_name"`
-	ReadableText     string         `json:"readable_text"`
-	ReadableTitle    string         `json:"readable_title"`
-	SiteName         string         `json:"site_name"`
-	Title            string         `json:"title"`
-	URL              string         `json:"url"`
-	Video            Video          `json:"video"`
-	Dynamic          map[string]any `json:"dynamic"`
+	Audio            Audio              `json:"audio"`
+	Author           string             `json:"author"`
+	CanonicalURL     string             `json:"canonical_url"`
+	CleanURL         string             `json:"clean_url"`
+	Confidence       map[string]float64 `json:"confidence,omitempty"`
+	Date             string             `json:"date"`
+	Description      string             `json:"description"`
+	FaviconURL       string             `json:"favicon_url"`
+	FeedURLs         []string           `json:"feed_url"`
+	HTML             string             `json:"html"`
+	Image            Image              `json:"image"`
+	IsReadable       bool               `json:"is_readable"`
+	Kind             string             `json:"kind"`
+	Lang             string             `json:"lang"`
+	LeadImageInMeta  bool               `json:"lead_image_in_meta"`
+	LeadImageURL     string             `json:"lead_image_url"`
+	Meta             Meta               `json:"meta"`
+	ModifiedAt       *Date              `json:"modified_at,omitempty"`
+	PublishedAt      *Date              `json:"published_at,omitempty"`
+	Publisher        string             `json:"publisher"`
+	ReadableByline   string             `json:"readable_byline"`
+	ReadableExcerpt  string             `json:"readable_excerpt"`
+	ReadableHTML     string             `json:"readable_html"`
+	ReadableImage    string             `json:"readable_image"`
+	ReadableLang     string             `json:"readable_lang"`
+	ReadableLength   int                `json:"readable_length"`
+	ReadableSiteName string             `json:"readable_site_name"`
+	ReadableText     string             `json:"readable_text"`
+	ReadableTitle    string             `json:"readable_title"`
+	SiteName         string             `json:"site_name"`
+	Title            string             `json:"title"`
+	URL              string             `json:"url"`
+	Video            Video              `json:"video"`
+	Dynamic          map[string]any     `json:"dynamic"`
 }
 
 // Meta is the struct that encapsulates the extracted metadata from <meta> tags
@@ -41,6 +47,17 @@ type Meta struct {
 	// ... Other meta properties
 }
 
+// Date is a date of the page, such as its publication date, parsed from what the page says
+type Date struct {
+	// Time is the date, in the time zone given by the page, or in the one the date was read in if it gives none.
+	Time time.Time `json:"time"`
+	// Confidence, between 0 and 1, is how likely Time is to be right. It depends on where the date was found and
+	// how precisely it is written: a timestamp in the JSON-LD is trusted more than "3 days ago" in the text.
+	Confidence float64 `json:"confidence"`
+	// Raw is the value as found on the page.
+	Raw string `json:"raw"`
+}
+
 // Image is the struct that encapsulates the extracted metadata from <img> tags
 type Image struct {
 	URL        string `json:"url"`
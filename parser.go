@@ -1,12 +1,18 @@
 package gophetch
 
 import (
+	"bufio"
+	"context"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/text/transform"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/helpers"
 )
 
 // Headers is a map of HTTP headers
@@ -14,11 +20,17 @@ type Headers map[string][]string
 
 // Parser is the struct that encapsulates the HTML parser.
 type Parser struct {
-	reader   io.Reader
-	response *http.Response
-	headers  Headers
-	node     *html.Node
-	url      *url.URL
+	// Limits bounds the size of the HTML read and the time it takes. Only MaxDecompressedSize, ReadTimeout and
+	// Truncate apply, as the content is expected to be decoded already. The zero value applies the default size.
+	Limits fetchers.BodyLimits
+
+	reader    io.Reader
+	response  *http.Response
+	headers   Headers
+	node      *html.Node
+	url       *url.URL
+	charset   string
+	truncated bool
 }
 
 // NewParser creates a new Parser struct.
@@ -30,16 +42,39 @@ func NewParser() *Parser {
 // It will also parse the HTTP headers from the provided http.Response struct. The targetURL parameter is used to fix
 // relative paths.
 func (p *Parser) Parse(reader io.Reader, resp *http.Response, targetURL string) error {
+	return p.ParseContext(context.Background(), reader, resp, targetURL)
+}
+
+// ParseContext is like Parse, but reading from the io.Reader stops with the context's error once the context is done.
+func (p *Parser) ParseContext(ctx context.Context, reader io.Reader, resp *http.Response, targetURL string) error {
 	u, err := url.Parse(targetURL)
 	if err != nil {
 		return err
 	}
 
 	p.url = u
-	p.reader = reader
 	p.response = resp
 	p.headers = p.parseHeaders()
 
+	body := fetchers.NewBodyReader(io.NopCloser(reader), p.Limits)
+	defer func() {
+		_ = body.Close()
+		p.truncated = body.Truncated()
+	}()
+
+	// Pages that aren't UTF-8 are transcoded, as that is what the HTML parser expects
+	buffered := bufio.NewReaderSize(&contextReader{ctx: ctx, r: body}, charsetSniffLen)
+	start, err := buffered.Peek(charsetSniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	enc, name := detectCharset(start, p.MimeType())
+	p.charset = name
+	p.reader = buffered
+	if name != "utf-8" {
+		p.reader = transform.NewReader(buffered, enc.NewDecoder())
+	}
+
 	doc, err := html.Parse(p.reader)
 	if err != nil {
 		return err
@@ -68,6 +103,12 @@ func (p *Parser) Node() *html.Node {
 	return p.node
 }
 
+// Truncated reports whether the HTML was cut short by Limits, which only happens when Limits.Truncate is set. The
+// rest of the page is then parsed as if the document ended there.
+func (p *Parser) Truncated() bool {
+	return p.truncated
+}
+
 // Headers returns the HTTP headers as a map.
 func (p *Parser) Headers() Headers {
 	return p.headers
@@ -78,6 +119,18 @@ func (p *Parser) URL() *url.URL {
 	return p.url
 }
 
+// BaseURL returns the URL relative URLs in the page are resolved against, which is the page's <base href> if it has
+// one, or the target URL.
+func (p *Parser) BaseURL() *url.URL {
+	return helpers.DocumentBase(p.node, p.url)
+}
+
+// Charset returns the canonical name of the charset the page was encoded in, such as "utf-8" or "shift_jis". The
+// page has been transcoded to UTF-8 before parsing.
+func (p *Parser) Charset() string {
+	return p.charset
+}
+
 // IsHTML returns true if the response is HTML, false otherwise.
 func (p *Parser) IsHTML() bool {
 	if p.headers == nil {
@@ -98,3 +151,17 @@ func (p *Parser) MimeType() string {
 	}
 	return cp[0]
 }
+
+// contextReader is an io.Reader that fails with the context's error once the context is done. Response bodies of
+// requests made with a context already behave this way, but bodies from other sources do not.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(b []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(b)
+}
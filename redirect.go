@@ -0,0 +1,134 @@
+package gophetch
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/helpers"
+)
+
+// maxRefreshDelay is the longest <meta http-equiv="refresh"> delay, in seconds, that is followed as a redirect.
+// Pages refreshing later than that are meant to be read first.
+const maxRefreshDelay = 10
+
+// maxInterstitialText is the most visible text, in bytes, a page may have for a script assigning a new location to
+// be followed. Scripts on regular pages often do that in event handlers, interstitial pages do it right away.
+const maxInterstitialText = 500
+
+var (
+	jsLocationRegex = regexp.MustCompile(`\blocation(?:\.href)?\s*=\s*["']([^"']+)["']`)
+	jsReplaceRegex  = regexp.MustCompile(`\blocation\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`)
+)
+
+// clientRedirect is a redirect made by the page itself instead of the server.
+type clientRedirect struct {
+	// URL is the absolute URL the page redirects to.
+	URL  string
+	Type fetchers.RedirectType
+}
+
+// findClientRedirect looks for a meta refresh or a script redirecting the page. Relative URLs are resolved against
+// base.
+func findClientRedirect(doc *html.Node, base *url.URL) (clientRedirect, bool) {
+	var refresh string
+	var scripts []string
+	textLen := 0
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			switch n.Data {
+			case "meta":
+				if refresh == "" && strings.EqualFold(attr(n, "http-equiv"), "refresh") {
+					refresh = attr(n, "content")
+				}
+				return
+			case "script":
+				if n.FirstChild != nil && attr(n, "src") == "" {
+					scripts = append(scripts, n.FirstChild.Data)
+				}
+				return
+			case "style", "noscript", "template":
+				return
+			}
+		case html.TextNode:
+			textLen += len(strings.TrimSpace(n.Data))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if target, ok := parseRefresh(refresh); ok {
+		if u, ok := resolveRedirect(base, target); ok {
+			return clientRedirect{URL: u, Type: fetchers.RedirectMetaRefresh}, true
+		}
+	}
+
+	if textLen > maxInterstitialText {
+		return clientRedirect{}, false
+	}
+	for _, script := range scripts {
+		for _, re := range []*regexp.Regexp{jsReplaceRegex, jsLocationRegex} {
+			if m := re.FindStringSubmatch(script); m != nil {
+				if u, ok := resolveRedirect(base, m[1]); ok {
+					return clientRedirect{URL: u, Type: fetchers.RedirectJavaScript}, true
+				}
+			}
+		}
+	}
+	return clientRedirect{}, false
+}
+
+// parseRefresh returns the URL of a meta refresh, such as "0; url=https://example.com/", if it is due soon enough
+// to be a redirect.
+func parseRefresh(content string) (string, bool) {
+	delay, target, found := strings.Cut(content, ";")
+	if !found {
+		delay, target, found = strings.Cut(content, ",")
+	}
+	if !found {
+		return "", false
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64)
+	if err != nil || seconds < 0 || seconds > maxRefreshDelay {
+		return "", false
+	}
+
+	target = strings.TrimSpace(target)
+	if len(target) >= 4 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	target = strings.Trim(target, `"'`)
+	return target, target != ""
+}
+
+// resolveRedirect resolves the target of a client redirect against the page URL. Only http and https URLs are
+// followed.
+func resolveRedirect(base *url.URL, target string) (string, bool) {
+	u, err := url.Parse(helpers.ResolveURL(base, target))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	u.Fragment = ""
+	return u.String(), true
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package gophetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/fetchers"
+)
+
+func TestRedirectChain(t *testing.T) {
+	// The article lives on another host, so relative URLs only resolve correctly against the final URL
+	article := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/articles/final":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><title>Final</title><link rel="canonical" href="/articles/final">` +
+				`<meta property="og:image" content="/images/lead.png"></head><body><p>Hello</p></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer article.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, article.URL+"/articles/final", http.StatusFound)
+		case "/refresh":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><meta http-equiv="refresh" content="0; URL='/script'"></head>` +
+				`<body>Redirecting...</body></html>`))
+		case "/script":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><p>Please wait</p>` +
+				`<script>window.location.replace("/start");</script></body></html>`))
+		case "/loop":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><title>Loop</title><meta http-equiv="refresh" content="1;url=/loop">` +
+				`</head></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name               string
+		path               string
+		maxClientRedirects int
+		expectedFinalURL   string
+		expectedTitle      string
+		expectedRedirects  []fetchers.Redirect
+	}{
+		{
+			name:             "http redirects",
+			path:             "/start",
+			expectedFinalURL: article.URL + "/articles/final",
+			expectedTitle:    "Final",
+			expectedRedirects: []fetchers.Redirect{
+				{URL: server.URL + "/start", StatusCode: http.StatusMovedPermanently, Type: fetchers.RedirectHTTP},
+				{URL: server.URL + "/moved", StatusCode: http.StatusFound, Type: fetchers.RedirectHTTP},
+			},
+		},
+		{
+			name:             "client redirects not followed by default",
+			path:             "/refresh",
+			expectedFinalURL: server.URL + "/refresh",
+		},
+		{
+			name:               "meta refresh and script",
+			path:               "/refresh",
+			maxClientRedirects: 2,
+			expectedFinalURL:   article.URL + "/articles/final",
+			expectedTitle:      "Final",
+			expectedRedirects: []fetchers.Redirect{
+				{URL: server.URL + "/refresh", StatusCode: http.StatusOK, Type: fetchers.RedirectMetaRefresh},
+				{URL: server.URL + "/script", StatusCode: http.StatusOK, Type: fetchers.RedirectJavaScript},
+				{URL: server.URL + "/start", StatusCode: http.StatusMovedPermanently, Type: fetchers.RedirectHTTP},
+				{URL: server.URL + "/moved", StatusCode: http.StatusFound, Type: fetchers.RedirectHTTP},
+			},
+		},
+		{
+			name:               "client redirect limit",
+			path:               "/refresh",
+			maxClientRedirects: 1,
+			expectedFinalURL:   server.URL + "/script",
+			expectedRedirects: []fetchers.Redirect{
+				{URL: server.URL + "/refresh", StatusCode: http.StatusOK, Type: fetchers.RedirectMetaRefresh},
+			},
+		},
+		{
+			name:               "refresh to the same page",
+			path:               "/loop",
+			maxClientRedirects: 5,
+			expectedFinalURL:   server.URL + "/loop",
+			expectedTitle:      "Loop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gophetch.New()
+			g.MaxClientRedirects = tt.maxClientRedirects
+
+			result, err := g.FetchAndParseContext(context.Background(), server.URL+tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFinalURL, result.FinalURL)
+			assert.Equal(t, tt.expectedRedirects, result.Redirects)
+			if tt.expectedTitle != "" {
+				assert.Equal(t, tt.expectedTitle, result.Metadata.Title)
+			}
+			if tt.expectedFinalURL == article.URL+"/articles/final" {
+				assert.Equal(t, article.URL+"/articles/final", result.Metadata.CanonicalURL)
+				assert.Equal(t, article.URL+"/images/lead.png", result.Metadata.LeadImageURL)
+			}
+		})
+	}
+}
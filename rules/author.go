@@ -1,5 +1,7 @@
 package rules
 
+import "strings"
+
 // AuthorRule is the rule for extracting the author information from a page.
 type AuthorRule struct {
 	BaseRule
@@ -12,16 +14,34 @@ func NewAuthorRule(strategies ...ExtractionStrategy) *AuthorRule {
 	}
 	return &AuthorRule{
 		BaseRule: BaseRule{
-			Strategies: innerStrategies,
+			Strategies:   innerStrategies,
+			Plausibility: authorPlausibility,
 		},
 	}
 }
 
 var authorStrategies = []ExtractionStrategy{
 	{
-		Selectors: []string{"author.name", "brand.name", "creator.name"},
+		Selectors: []string{
+			articleTypes + ".author.name",
+			articleTypes + ".author",
+			"author.name",
+			"author",
+			"brand.name",
+			"creator.name",
+		},
 		Extractor: ExtractJSONLD,
 	},
+	{
+		Selectors: []string{
+			articleTypes + ".author.name",
+			articleTypes + ".author",
+			"author.name",
+			"author",
+			"creator.name",
+		},
+		Extractor: ExtractItems,
+	},
 	{
 		Selectors: []string{
 			"meta[name='author']",
@@ -55,3 +75,11 @@ var authorStrategies = []ExtractionStrategy{
 		Extractor: ExtractCSS,
 	},
 }
+
+// authorPlausibility prefers names to the links to profiles that some sites put in the author meta tags.
+func authorPlausibility(value string) float64 {
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		return 0.3
+	}
+	return LengthPlausibility(2, 60)(value)
+}
@@ -3,9 +3,10 @@ package rules
 import (
 	"errors"
 	"net/url"
-	"strings"
 
 	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/helpers"
 )
 
 // CanonicalRule is the rule for extracting the canonical URL of a page.
@@ -49,24 +50,23 @@ func (cr *CanonicalRule) Extract(node *html.Node, targetURL *url.URL) (ExtractRe
 
 	if result.Found() {
 
-		sr, ok := result.(*StringResult)
+		value, ok := result.Value().(string)
 		if !ok {
 			return NewNoResult(), errors.New("invalid result type")
 		}
 
-		inMeta := sr.SelectorInfo().Selector == "content"
+		inMeta := result.SelectorInfo().Selector == "content"
 
-		// If the value is not a full URL, then prepend the scheme and host
-		if !strings.HasPrefix(sr.value, "http") {
-			sr.value = targetURL.Scheme + "://" + targetURL.Host + sr.value
-		}
+		// Relative URLs are resolved against the document's base
+		value = helpers.ResolveURL(helpers.DocumentBase(node, targetURL), value)
 
 		return NewStringResult(
-			sr.value,
+			value,
 			SelectorInfo{
-				Attr:     sr.SelectorInfo().Attr,
+				Attr:     result.SelectorInfo().Attr,
 				InMeta:   inMeta,
-				Selector: sr.SelectorInfo().Selector,
+				Selector: result.SelectorInfo().Selector,
+				Source:   result.SelectorInfo().Source,
 			},
 			result.Found(),
 		), nil
@@ -69,6 +69,16 @@ func TestCanonicalRuleSelectors(t *testing.T) {
 			`,
 			expected: "https://example.com",
 		},
+		{
+			desc:     "Test with relative canonical",
+			mockHTML: `<link rel="canonical" href="?page=2"/>`,
+			expected: "https://example.com?page=2",
+		},
+		{
+			desc:     "Test with canonical relative to base href",
+			mockHTML: `<html><head><base href="https://example.org/blog/"><link rel="canonical" href="../post"/></head></html>`,
+			expected: "https://example.org/post",
+		},
 		{
 			desc: "Test no value found",
 			mockHTML: `
@@ -1,8 +1,28 @@
 package rules
 
-// DateRule is the rule for extracting the date information from a page.
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/helpers"
+	"github.com/octetic/gophetch/metadata"
+)
+
+// DateRule is the rule for extracting the date information from a page. The values found are parsed with ParseDate,
+// and the one that parses most confidently is returned, so that text such as "Updated:" next to a date isn't taken
+// for it. If none parses, the first value found is returned as is.
 type DateRule struct {
 	BaseRule
+	// Options are used to parse the dates. If Options.Now is zero, relative dates are resolved against the fetch
+	// time, see WithFetchTime.
+	Options DateOptions
+
+	// modified is set for the rule of the modification date, see NewModifiedDateRule.
+	modified bool
 }
 
 func NewDateRule(strategies ...ExtractionStrategy) *DateRule {
@@ -17,13 +37,145 @@ func NewDateRule(strategies ...ExtractionStrategy) *DateRule {
 	}
 }
 
+// NewModifiedDateRule returns the rule for extracting the date a page was last modified.
+func NewModifiedDateRule(strategies ...ExtractionStrategy) *DateRule {
+	innerStrategies := modifiedDateStrategies
+	if len(strategies) > 0 {
+		innerStrategies = strategies
+	}
+	return &DateRule{
+		BaseRule: BaseRule{
+			Strategies: innerStrategies,
+		},
+		modified: true,
+	}
+}
+
+// Extract extracts the date from the node, resolving relative dates against the current time.
+func (r *DateRule) Extract(node *html.Node, targetURL *url.URL) (ExtractResult, error) {
+	return r.ExtractContext(context.Background(), node, targetURL)
+}
+
+// ExtractContext extracts the date from the node, resolving relative dates against the fetch time of the context.
+// The candidates are scored by how confidently they parse, see ParseDate, times the trust of their source, and the
+// result is a *ScoredResult of *DateResult.
+func (r *DateRule) ExtractContext(ctx context.Context, node *html.Node, targetURL *url.URL) (ExtractResult, error) {
+	opts := r.Options
+	if opts.Now.IsZero() {
+		opts.Now = FetchTimeFromContext(ctx)
+	}
+
+	var candidates []Candidate
+	r.eachResult(node, targetURL, func(strategy ExtractionStrategy, result ExtractResult) {
+		raw, _ := result.Value().(string)
+		t, confidence, ok := ParseDate(helpers.Normalize(raw), opts)
+		if !ok {
+			candidates = append(candidates, Candidate{Result: NewDateResult(raw, nil, result.SelectorInfo(), true)})
+			return
+		}
+		date := &metadata.Date{Time: t, Raw: raw}
+		score := confidence * strategyTrust(strategy, result.SelectorInfo())
+		// The modification date stands in for the publication date, with less confidence
+		if !r.modified && strings.Contains(strings.ToLower(result.SelectorInfo().Selector), "modified") {
+			score *= 0.5
+		}
+		candidates = append(candidates, Candidate{Result: NewDateResult(raw, date, result.SelectorInfo(), true), Score: score})
+	})
+	if len(candidates) == 0 {
+		return NewNoResult(), ErrValueNotFound
+	}
+
+	candidates = rankCandidates(candidates)
+	for _, c := range candidates {
+		if date := c.Result.(*DateResult).date; date != nil {
+			date.Confidence = c.Score
+		}
+	}
+	return NewScoredResult(candidates), nil
+}
+
+type fetchTimeKey struct{}
+
+// WithFetchTime returns a context carrying the time the page was fetched, which DateRule resolves relative dates,
+// such as "3 hours ago", against.
+func WithFetchTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, fetchTimeKey{}, t)
+}
+
+// FetchTimeFromContext returns the fetch time set with WithFetchTime, or the current time if there is none.
+func FetchTimeFromContext(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(fetchTimeKey{}).(time.Time); ok && !t.IsZero() {
+		return t
+	}
+	return time.Now()
+}
+
+// DateResult is the result of DateRule: the date as found on the page and, if it could be parsed, the date it gives.
+type DateResult struct {
+	*BaseResult
+	raw  string
+	date *metadata.Date
+}
+
+func NewDateResult(raw string, date *metadata.Date, selectorInfo SelectorInfo, found bool) *DateResult {
+	return &DateResult{
+		BaseResult: &BaseResult{
+			found:        found,
+			selectorInfo: selectorInfo,
+		},
+		raw:  raw,
+		date: date,
+	}
+}
+
+// ApplyMetadata stores the raw value in Metadata.Date and the parsed date in Metadata.PublishedAt for the "date"
+// key, and the parsed date in Metadata.ModifiedAt for the "modified_date" key.
+func (r *DateResult) ApplyMetadata(key string, _ *url.URL, m *metadata.Metadata) {
+	switch key {
+	case "date":
+		m.Date = helpers.Normalize(r.raw)
+		m.PublishedAt = r.date
+	case "modified_date":
+		m.ModifiedAt = r.date
+	default:
+		if r.date != nil {
+			setDynamic(m, key, *r.date)
+		} else {
+			setDynamic(m, key, r.raw)
+		}
+	}
+}
+
+// Date returns the parsed date, or nil if the value found isn't a date ParseDate can read.
+func (r *DateResult) Date() *metadata.Date {
+	return r.date
+}
+
+func (r *DateResult) agreementKey() string {
+	if r.date == nil {
+		return ""
+	}
+	return r.date.Time.UTC().Format(time.RFC3339)
+}
+
+// Value returns the value as found on the page.
+func (r *DateResult) Value() any {
+	return r.raw
+}
+
 var dateStrategies = []ExtractionStrategy{
 	// JSON LD
 	{
-		Selectors: []string{"datePublished", "dateCreated", "dateModified"},
+		Selectors: []string{articleTypes + ".datePublished", "datePublished", "dateCreated", "dateModified"},
 		Extractor: ExtractJSONLD,
 	},
 
+	// Microdata and RDFa
+	{
+		Selectors: []string{articleTypes + ".datePublished", "datePublished", "dateCreated", "dateModified"},
+		Extractor: ExtractItems,
+	},
+
 	// Meta selectors
 	{
 		Selectors: []string{
@@ -62,3 +214,38 @@ var dateStrategies = []ExtractionStrategy{
 		Extractor: ExtractCSS,
 	},
 }
+
+var modifiedDateStrategies = []ExtractionStrategy{
+	// JSON LD
+	{
+		Selectors: []string{articleTypes + ".dateModified", "dateModified"},
+		Extractor: ExtractJSONLD,
+	},
+
+	// Microdata and RDFa
+	{
+		Selectors: []string{articleTypes + ".dateModified", "dateModified"},
+		Extractor: ExtractItems,
+	},
+
+	// Meta selectors
+	{
+		Selectors: []string{
+			"meta[property='article:modified_time']",
+			"meta[property='og:updated_time']",
+			"meta[property*='modified_time']",
+			"meta[name='last-modified']",
+			"[itemprop='dateModified']",
+		},
+		Extractor: ExtractMeta,
+	},
+
+	// Time selectors
+	{
+		Selectors: []string{
+			"time[itemprop='dateModified']",
+			"time.updated[datetime]",
+		},
+		Extractor: ExtractAttr("datetime"),
+	},
+}
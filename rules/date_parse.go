@@ -0,0 +1,416 @@
+package rules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DateOptions controls how ParseDate reads dates.
+type DateOptions struct {
+	// Now is the time relative dates, such as "3 hours ago", are resolved against, usually the time the page was
+	// fetched. The zero value means time.Now.
+	Now time.Time
+	// Location is the time zone of the dates that don't give one. Nil means UTC.
+	Location *time.Location
+	// DayFirst reads ambiguous numeric dates such as 05/03/2024 as day/month/year instead of month/day/year.
+	DayFirst bool
+}
+
+func (o DateOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+func (o DateOptions) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// Unix timestamps are only read between 1995 and 2100, so that other numbers aren't taken for dates
+const (
+	minTimestamp = 788918400
+	maxTimestamp = 4102444800
+)
+
+// ParseDate parses a date as found on a page: an ISO 8601 or RFC 1123 timestamp, a Unix timestamp in seconds or
+// milliseconds, a relative date such as "3 hours ago" or "il y a 2 jours", or a date written out such as
+// "Updated: March 5th, 2024 at 10:30 am EST" or "5. März 2024". Month names, weekdays and relative dates are read in
+// English, French, German, Spanish, Italian, Portuguese and Dutch.
+//
+// The confidence, between 0 and 1, says how precisely the value gives the date: a timestamp with a time zone is
+// certain, while a relative date or a numeric date such as 05/03/2024 is not.
+func ParseDate(value string, opts DateOptions) (time.Time, float64, bool) {
+	value = stripDateLabel(strings.TrimSpace(value))
+	if value == "" {
+		return time.Time{}, 0, false
+	}
+
+	if t, ok := parseTimestamp(value, opts.location()); ok {
+		return t, 0.8, true
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l.layout, value, opts.location()); err == nil {
+			return t, l.confidence, true
+		}
+	}
+	if t, confidence, ok := parseRelativeDate(strings.ToLower(value), opts); ok {
+		return t, confidence, true
+	}
+	return parseDateWords(value, opts)
+}
+
+var dateLabel = regexp.MustCompile(`(?i)^(?:(?:last\s+)?(?:published|posted|updated|modified|created)(?:\s+(?:on|at))?|date|on|publié\s+le|mis\s+à\s+jour\s+le|veröffentlicht\s+am|aktualisiert\s+am|publicado\s+el|actualizado\s+el|pubblicato\s+il|aggiornato\s+il|gepubliceerd\s+op)\b\s*:?\s*`)
+
+// stripDateLabel removes the labels that often precede dates in the text of pages, such as "Updated:".
+func stripDateLabel(value string) string {
+	for {
+		loc := dateLabel.FindStringIndex(value)
+		if loc == nil || loc[1] == 0 {
+			return value
+		}
+		value = value[loc[1]:]
+	}
+}
+
+func parseTimestamp(value string, loc *time.Location) (time.Time, bool) {
+	if len(value) != 10 && len(value) != 13 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if len(value) == 13 {
+		n /= 1000
+	}
+	if n < minTimestamp || n > maxTimestamp {
+		return time.Time{}, false
+	}
+	return time.Unix(n, 0).In(loc), true
+}
+
+// dateLayouts are the layouts of the machine-readable dates, tried in order. The layouts without a time zone are
+// read in DateOptions.Location.
+var dateLayouts = []struct {
+	layout     string
+	confidence float64
+}{
+	{time.RFC3339, 1},
+	{"2006-01-02T15:04:05Z0700", 1},
+	{"2006-01-02T15:04Z07:00", 1},
+	{"2006-01-02 15:04:05Z07:00", 1},
+	{"2006-01-02 15:04:05 -0700", 1},
+	{time.RFC1123Z, 1},
+	{"Mon, 2 Jan 2006 15:04:05 -0700", 1},
+	{"2006-01-02T15:04:05", 0.9},
+	{"2006-01-02T15:04", 0.9},
+	{"2006-01-02 15:04:05", 0.9},
+	{"2006-01-02 15:04", 0.9},
+	{"2006-01-02", 0.9},
+	{"2006/01/02", 0.85},
+}
+
+type dateUnit int
+
+const (
+	unitSecond dateUnit = iota
+	unitMinute
+	unitHour
+	unitDay
+	unitWeek
+	unitMonth
+	unitYear
+)
+
+// relativeDates match the relative dates, with the amount and the unit as the two submatches.
+var relativeDates = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:about\s+)?(\d+|an?|one)\s+(\pL+)\s+ago$`),
+	regexp.MustCompile(`^il\s+y\s+a\s+(\d+|une?)\s+(\pL+)$`),
+	regexp.MustCompile(`^vor\s+(\d+|einer?|einem)\s+(\pL+)$`),
+	regexp.MustCompile(`^hace\s+(\d+|una?)\s+(\pL+)$`),
+	regexp.MustCompile(`^(\d+|una?|un)\s+(\pL+)\s+fa$`),
+	regexp.MustCompile(`^há\s+(\d+|uma?)\s+(\pL+)$`),
+	regexp.MustCompile(`^(\d+|een)\s+(\pL+)\s+geleden$`),
+}
+
+var relativeUnits = wordIndex(map[dateUnit]string{
+	unitSecond: "second seconds sec secs seconde secondes sekunde sekunden segundo segundos secondo secondi seconden",
+	unitMinute: "minute minutes min mins minuten minuto minutos minuti minuut",
+	unitHour:   "hour hours hr hrs heure heures stunde stunden hora horas ora ore uur",
+	unitDay:    "day days jour jours tag tage tagen día días dia dias giorno giorni dag dagen",
+	unitWeek:   "week weeks semaine semaines woche wochen semana semanas settimana settimane weken",
+	unitMonth:  "month months mois monat monate monaten mes meses mese mesi maand maanden",
+	unitYear:   "year years an ans année années jahr jahre jahren año años ano anos anno anni jaar jaren",
+})
+
+var (
+	justNow   = wordSet("just now", "now", "à l'instant", "gerade eben", "ahora mismo", "adesso", "agora mesmo", "zojuist")
+	today     = wordSet("today", "aujourd'hui", "heute", "hoy", "oggi", "hoje", "vandaag")
+	yesterday = wordSet("yesterday", "hier", "gestern", "ayer", "ieri", "ontem", "gisteren")
+)
+
+// parseRelativeDate parses the lowercase value as a date relative to DateOptions.Now. The longer the unit, the less
+// precise the date, and the lower the confidence.
+func parseRelativeDate(value string, opts DateOptions) (time.Time, float64, bool) {
+	now := opts.now().In(opts.location())
+	value = strings.Join(strings.Fields(value), " ")
+	switch {
+	case justNow[value]:
+		return now, 0.7, true
+	case today[value]:
+		return startOfDay(now), 0.5, true
+	case yesterday[value]:
+		return startOfDay(now).AddDate(0, 0, -1), 0.5, true
+	}
+
+	for _, re := range relativeDates {
+		m := re.FindStringSubmatch(value)
+		if m == nil {
+			continue
+		}
+		unit, ok := relativeUnits[m[2]]
+		if !ok {
+			return time.Time{}, 0, false
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			// An article, as in "an hour ago"
+			n = 1
+		}
+
+		switch unit {
+		case unitSecond:
+			return now.Add(-time.Duration(n) * time.Second), 0.7, true
+		case unitMinute:
+			return now.Add(-time.Duration(n) * time.Minute), 0.7, true
+		case unitHour:
+			return now.Add(-time.Duration(n) * time.Hour), 0.7, true
+		case unitDay:
+			return now.AddDate(0, 0, -n), 0.5, true
+		case unitWeek:
+			return now.AddDate(0, 0, -7*n), 0.4, true
+		case unitMonth:
+			return now.AddDate(0, -n, 0), 0.3, true
+		default:
+			return now.AddDate(-n, 0, 0), 0.2, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var monthNames = wordIndex(map[time.Month]string{
+	time.January:   "january jan janvier janv januar jänner enero ene gennaio gen janeiro januari",
+	time.February:  "february feb février fevrier févr fevr februar febrero febbraio fevereiro fev februari",
+	time.March:     "march mar mars märz maerz mär marzo março marco maart mrt",
+	time.April:     "april apr avril avr abril aprile abr",
+	time.May:       "may mai mayo maggio mag maio mei",
+	time.June:      "june jun juin juni junio giugno giu junho",
+	time.July:      "july jul juillet juil juli julio luglio lug julho",
+	time.August:    "august aug août aout agosto augustus",
+	time.September: "september sep sept septembre septiembre setiembre settembre set setembro",
+	time.October:   "october oct octobre oktober okt octubre ottobre ott outubro",
+	time.November:  "november nov novembre noviembre novembro",
+	time.December:  "december dec décembre decembre déc dezember dez diciembre dicembre dic dezembro",
+})
+
+// dateFillers are the words that may surround a written date without making it less likely to be one: weekdays,
+// labels and connectors such as the "de" of "5 de marzo de 2024".
+var dateFillers = wordSet(strings.Fields(`
+	monday tuesday wednesday thursday friday saturday sunday mon tue tues wed thu thur thurs fri sat sun
+	lundi mardi mercredi jeudi vendredi samedi dimanche lun mer jeu ven sam dim
+	montag dienstag mittwoch donnerstag freitag samstag sonntag mo di mi do fr sa so
+	lunes martes miércoles miercoles jueves viernes sábado sabado domingo
+	lunedì martedì mercoledì giovedì venerdì sabato domenica
+	segunda terça terca quarta quinta sexta feira
+	maandag dinsdag woensdag donderdag vrijdag zaterdag zondag
+	published posted updated modified created last date on at the of de del el le la à am um om em op il at
+`)...)
+
+var timezoneOffsets = map[string]int{
+	"utc": 0, "gmt": 0,
+	"est": -5, "edt": -4, "cst": -6, "cdt": -5, "mst": -7, "mdt": -6, "pst": -8, "pdt": -7,
+	"bst": 1, "cet": 1, "cest": 2, "eet": 2, "eest": 3,
+	"jst": 9, "aest": 10, "aedt": 11,
+}
+
+var (
+	numericDate    = regexp.MustCompile(`^(\d{1,2})([./-])(\d{1,2})[./-](\d{4})$`)
+	numericDateYMD = regexp.MustCompile(`^(\d{4})[./-](\d{1,2})[./-](\d{1,2})$`)
+	timeOfDay      = regexp.MustCompile(`^(\d{1,2})[:h](\d{2})(?::(\d{2}))?(am|pm|a\.m\.|p\.m\.)?$`)
+	meridiem       = regexp.MustCompile(`^(am|pm|a\.m\.|p\.m\.)$`)
+	offsetZone     = regexp.MustCompile(`^(?:(?:utc|gmt)([+-])(\d{1,2})(?::?(\d{2}))?|([+-])(\d{2}):?(\d{2}))$`)
+	ordinalDay     = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th|er|e|º|ª)$`)
+)
+
+// maxUnknownWords is the number of words a written date may contain besides the date and dateFillers.
+const maxUnknownWords = 3
+
+// parseDateWords parses a date written out, by reading its words one by one: a month name, a day, a year, a time of
+// day and a time zone, in any order, skipping the words of dateFillers. Too many other words and the value isn't
+// taken for a date.
+func parseDateWords(value string, opts DateOptions) (time.Time, float64, bool) {
+	var (
+		year, day, hour, minute, second int
+		month                           time.Month
+		zone                            *time.Location
+		hasTime, ambiguous              bool
+		unknown                         int
+	)
+
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",|·()", r)
+	})
+	for i, field := range fields {
+		if m := numericDateYMD.FindStringSubmatch(field); m != nil && month == 0 {
+			year, month, day = atoi(m[1]), time.Month(atoi(m[2])), atoi(m[3])
+			continue
+		}
+		if m := numericDate.FindStringSubmatch(field); m != nil && month == 0 {
+			a, b := atoi(m[1]), atoi(m[3])
+			// Dates with dots, as in 05.03.2024, always come day first
+			dayFirst := m[2] == "." || a > 12 || (b <= 12 && opts.DayFirst)
+			ambiguous = m[2] != "." && a <= 12 && b <= 12 && a != b
+			if dayFirst {
+				day, month = a, time.Month(b)
+			} else {
+				month, day = time.Month(a), b
+			}
+			year = atoi(m[4])
+			continue
+		}
+		if m := timeOfDay.FindStringSubmatch(field); m != nil && !hasTime {
+			hour, minute, second = atoi(m[1]), atoi(m[2]), atoi(m[3])
+			hasTime = true
+			if m[4] != "" {
+				hour = toHour24(hour, m[4])
+			}
+			continue
+		}
+		if meridiem.MatchString(field) && hasTime && i > 0 && timeOfDay.MatchString(fields[i-1]) {
+			hour = toHour24(hour, field)
+			continue
+		}
+		if offset, ok := timezoneOffsets[field]; ok && zone == nil {
+			zone = time.FixedZone(strings.ToUpper(field), offset*3600)
+			continue
+		}
+		if m := offsetZone.FindStringSubmatch(field); m != nil && zone == nil {
+			sign, hours, minutes := m[1]+m[4], atoi(m[2]+m[5]), atoi(m[3]+m[6])
+			offset := hours*3600 + minutes*60
+			if sign == "-" {
+				offset = -offset
+			}
+			zone = time.FixedZone("", offset)
+			continue
+		}
+
+		// Dates such as 5-Mar-2024 or 5. März 2024
+		for _, word := range strings.FieldsFunc(field, func(r rune) bool { return r == '-' || r == '.' || r == '/' }) {
+			if m := ordinalDay.FindStringSubmatch(word); m != nil && day == 0 {
+				day = atoi(m[1])
+				continue
+			}
+			if n, err := strconv.Atoi(word); err == nil {
+				switch {
+				case len(word) == 4 && year == 0 && n >= 1900 && n <= 2100:
+					year = n
+				case len(word) <= 2 && day == 0 && n >= 1 && n <= 31:
+					day = n
+				default:
+					unknown++
+				}
+				continue
+			}
+			if m, ok := monthNames[word]; ok && month == 0 {
+				month = m
+				continue
+			}
+			if !dateFillers[word] {
+				unknown++
+			}
+		}
+	}
+
+	if month == 0 || day == 0 || unknown > maxUnknownWords {
+		return time.Time{}, 0, false
+	}
+	if month > time.December || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, 0, false
+	}
+
+	loc := opts.location()
+	if zone != nil {
+		loc = zone
+	}
+	// Without a year, the date is the last one before now
+	now := opts.now()
+	hasYear := year != 0
+	if !hasYear {
+		year = now.In(loc).Year()
+	}
+	t := time.Date(year, month, day, hour, minute, second, 0, loc)
+	if t.Month() != month || t.Day() != day {
+		// Such as February 30, which time.Date normalizes to March
+		return time.Time{}, 0, false
+	}
+	if !hasYear && t.After(now.Add(24*time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+
+	confidence := 0.8
+	switch {
+	case hasTime && zone != nil:
+		confidence = 0.95
+	case hasTime:
+		confidence = 0.85
+	}
+	if ambiguous {
+		confidence = 0.5
+	}
+	if !hasYear && confidence > 0.5 {
+		confidence = 0.5
+	}
+	confidence -= 0.1 * float64(unknown)
+	return t, confidence, true
+}
+
+func toHour24(hour int, meridiem string) int {
+	if strings.HasPrefix(meridiem, "p") {
+		return hour%12 + 12
+	}
+	return hour % 12
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+func wordIndex[T comparable](words map[T]string) map[string]T {
+	index := make(map[string]T)
+	for value, list := range words {
+		for _, word := range strings.Fields(list) {
+			index[word] = value
+		}
+	}
+	return index
+}
@@ -0,0 +1,95 @@
+package rules_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch/rules"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	est := time.FixedZone("EST", -5*3600)
+	paris := time.FixedZone("", 3600)
+
+	tests := []struct {
+		value              string
+		opts               rules.DateOptions
+		expected           time.Time
+		expectedConfidence float64
+	}{
+		{value: "2024-03-05T10:30:00+01:00", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, paris), expectedConfidence: 1},
+		{value: "2024-03-05T10:30:00.123Z", expected: time.Date(2024, 3, 5, 10, 30, 0, 123000000, time.UTC), expectedConfidence: 1},
+		{value: "2024-03-05T10:30:00+0100", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, paris), expectedConfidence: 1},
+		{value: "Tue, 05 Mar 2024 10:30:00 -0500", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, est), expectedConfidence: 1},
+		{value: "2024-03-05", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.9},
+		{value: "2024-03-05 10:30", opts: rules.DateOptions{Location: est}, expected: time.Date(2024, 3, 5, 10, 30, 0, 0, est), expectedConfidence: 0.9},
+		{value: "1709634600", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "1709634600000", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "Published: 2024-03-05", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.9},
+
+		{value: "March 5th, 2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "Updated: March 5th, 2024 at 10:30 am EST", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, est), expectedConfidence: 0.95},
+		{value: "Tue, 05 Mar 2024 10:30:00 GMT", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, time.FixedZone("GMT", 0)), expectedConfidence: 0.95},
+		{value: "5 Mar 2024 3:15pm", expected: time.Date(2024, 3, 5, 15, 15, 0, 0, time.UTC), expectedConfidence: 0.85},
+		{value: "5-Mar-2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "mardi 5 mars 2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "1er février 2024 à 14h05", expected: time.Date(2024, 2, 1, 14, 5, 0, 0, time.UTC), expectedConfidence: 0.85},
+		{value: "5. März 2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "5 de marzo de 2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "5 maart 2024 10:30 UTC+1", expected: time.Date(2024, 3, 5, 10, 30, 0, 0, paris), expectedConfidence: 0.95},
+		{value: "Posted by Jane on March 5, 2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.6},
+		{value: "March 5", opts: rules.DateOptions{Now: now}, expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.5},
+		{value: "December 24", opts: rules.DateOptions{Now: now}, expected: time.Date(2023, 12, 24, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.5},
+
+		{value: "25/03/2024", expected: time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "03/25/2024", expected: time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+		{value: "05/03/2024", expected: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.5},
+		{value: "05/03/2024", opts: rules.DateOptions{DayFirst: true}, expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.5},
+		{value: "05.03.2024", expected: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.8},
+
+		{value: "3 hours ago", opts: rules.DateOptions{Now: now}, expected: now.Add(-3 * time.Hour), expectedConfidence: 0.7},
+		{value: "an hour ago", opts: rules.DateOptions{Now: now}, expected: now.Add(-time.Hour), expectedConfidence: 0.7},
+		{value: "Updated 2 days ago", opts: rules.DateOptions{Now: now}, expected: now.AddDate(0, 0, -2), expectedConfidence: 0.5},
+		{value: "il y a 2 semaines", opts: rules.DateOptions{Now: now}, expected: now.AddDate(0, 0, -14), expectedConfidence: 0.4},
+		{value: "vor 3 Monaten", opts: rules.DateOptions{Now: now}, expected: now.AddDate(0, -3, 0), expectedConfidence: 0.3},
+		{value: "hace 1 año", opts: rules.DateOptions{Now: now}, expected: now.AddDate(-1, 0, 0), expectedConfidence: 0.2},
+		{value: "Yesterday", opts: rules.DateOptions{Now: now}, expected: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), expectedConfidence: 0.5},
+		{value: "just now", opts: rules.DateOptions{Now: now, Location: est}, expected: now.In(est), expectedConfidence: 0.7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			parsed, confidence, ok := rules.ParseDate(tt.value, tt.opts)
+			if assert.True(t, ok) {
+				assert.Equal(t, tt.expected.Format(time.RFC3339Nano), parsed.Format(time.RFC3339Nano))
+				assert.InDelta(t, tt.expectedConfidence, confidence, 0.001)
+			}
+		})
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"Updated:",
+		"Read more",
+		"12345",
+		"February 30, 2024",
+		"2024-13-05",
+		"2024-00-05",
+		"25/13/2024",
+		"13.13.2024",
+		"March 2024",
+		"25:00 March 5, 2024",
+		"3 bananas ago",
+		"Best of March 5 in the whole wide world",
+	} {
+		t.Run(value, func(t *testing.T) {
+			_, _, ok := rules.ParseDate(value, rules.DateOptions{})
+			assert.False(t, ok)
+		})
+	}
+}
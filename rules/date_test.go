@@ -1,14 +1,17 @@
 package rules_test
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
 
+	"github.com/octetic/gophetch/metadata"
 	"github.com/octetic/gophetch/rules"
 )
 
@@ -91,3 +94,64 @@ func TestDateRuleSelectors(t *testing.T) {
 		})
 	}
 }
+
+func dateOf(result rules.ExtractResult) *metadata.Date {
+	return result.(*rules.ScoredResult).ExtractResult.(*rules.DateResult).Date()
+}
+
+// Values that aren't dates, such as the label next to one, are skipped
+func TestDateRuleParsesDates(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`
+		<meta property="article:modified_time" content="2024-03-06T09:00:00Z">
+		<span class="post-date">Updated:</span>
+		<div class="article-date">3 hours ago</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com")
+	fetched := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	ctx := rules.WithFetchTime(context.Background(), fetched)
+
+	result, err := rules.ExtractContext(ctx, rules.NewDateRule(rules.ExtractionStrategy{
+		Selectors: []string{".post-date", ".article-date"},
+		Extractor: rules.ExtractCSS,
+	}), node, targetURL)
+	if assert.NoError(t, err) {
+		date := dateOf(result)
+		assert.Equal(t, "3 hours ago", result.Value())
+		if assert.NotNil(t, date) {
+			assert.Equal(t, fetched.Add(-3*time.Hour), date.Time)
+			assert.InDelta(t, 0.42, date.Confidence, 0.001)
+			assert.Equal(t, "3 hours ago", date.Raw)
+		}
+	}
+
+	// The modification date stands in for the publication date, with less confidence
+	result, err = rules.ExtractContext(ctx, rules.NewDateRule(), node, targetURL)
+	if assert.NoError(t, err) {
+		date := dateOf(result)
+		if assert.NotNil(t, date) {
+			assert.Equal(t, time.Date(2024, time.March, 6, 9, 0, 0, 0, time.UTC), date.Time)
+			assert.InDelta(t, 0.45, date.Confidence, 0.001)
+		}
+	}
+
+	result, err = rules.ExtractContext(ctx, rules.NewModifiedDateRule(), node, targetURL)
+	if assert.NoError(t, err) {
+		date := dateOf(result)
+		if assert.NotNil(t, date) {
+			assert.Equal(t, time.Date(2024, time.March, 6, 9, 0, 0, 0, time.UTC), date.Time)
+			assert.InDelta(t, 0.9, date.Confidence, 0.001)
+		}
+	}
+
+	// Without a date that parses, the first value is kept as is
+	result, err = rules.NewDateRule(rules.ExtractionStrategy{
+		Selectors: []string{".post-date"},
+		Extractor: rules.ExtractCSS,
+	}).Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Updated:", result.Value())
+		assert.Nil(t, dateOf(result))
+	}
+}
@@ -0,0 +1,355 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+
+	"github.com/octetic/gophetch/helpers"
+)
+
+// Extractor kinds of the strategy definitions.
+const (
+	ExtractorMeta      = "meta"
+	ExtractorAttr      = "attr"
+	ExtractorCSS       = "css"
+	ExtractorJSONLD    = "jsonld"
+	ExtractorMicrodata = "microdata"
+	ExtractorRegex     = "regex"
+)
+
+// Post-processing steps of the rule and strategy definitions.
+const (
+	StepTrim               = "trim"
+	StepCollapseWhitespace = "collapse_whitespace"
+	StepStripTags          = "strip_tags"
+	StepLowercase          = "lowercase"
+	StepUppercase          = "uppercase"
+	StepTrimPrefix         = "trim_prefix"
+	StepTrimSuffix         = "trim_suffix"
+	StepReplace            = "replace"
+)
+
+// RuleFile is the format of the rule definitions read by LoadRules, in YAML or JSON. For example:
+//
+//	rules:
+//	  - field: title
+//	    max_length: 150
+//	    strategies:
+//	      - extractor: jsonld
+//	        selectors: ["NewsArticle.headline"]
+//	      - extractor: meta
+//	        selectors: ["meta[property='og:title']"]
+//	      - extractor: css
+//	        selectors: ["h1.headline"]
+//	        trust: 0.8
+//	    post:
+//	      - op: trim_suffix
+//	        value: " | Example News"
+//	  - field: reading_time
+//	    strategies:
+//	      - extractor: regex
+//	        selectors: [".meta"]
+//	        pattern: '(\d+) min read'
+type RuleFile struct {
+	Rules []RuleDefinition `json:"rules" yaml:"rules"`
+}
+
+// RuleDefinition describes a rule.
+type RuleDefinition struct {
+	// Field is the key of the rule in the Extractor, which decides where its value goes in Metadata: one of author,
+	// canonical, date, modified_date, description, favicon, lang, lead_image, publisher, site_name and title, or any
+	// other key to store the value in Metadata.Dynamic. The values of date and modified_date are parsed, see
+	// DateRule.
+	Field string `json:"field" yaml:"field"`
+	// Strategies are tried in order, see BaseRule.
+	Strategies []StrategyDefinition `json:"strategies" yaml:"strategies"`
+	// Post are the post-processing steps applied to the values of all the strategies, after their own.
+	Post []StepDefinition `json:"post,omitempty" yaml:"post,omitempty"`
+	// MinLength and MaxLength make values outside of that many characters less plausible, see LengthPlausibility.
+	MinLength int `json:"min_length,omitempty" yaml:"min_length,omitempty"`
+	MaxLength int `json:"max_length,omitempty" yaml:"max_length,omitempty"`
+}
+
+// StrategyDefinition describes a strategy of a rule.
+type StrategyDefinition struct {
+	// Extractor is the kind of extractor: meta, attr, css, jsonld, microdata or regex. See ExtractMeta,
+	// ExtractAttr, ExtractCSS, ExtractJSONLD, ExtractItems and ExtractRegex.
+	Extractor string `json:"extractor" yaml:"extractor"`
+	// Selectors are CSS selectors, or JSON-LD selectors for the jsonld and microdata extractors, see JSONLDSelector.
+	// They are optional for the regex extractor.
+	Selectors []string `json:"selectors,omitempty" yaml:"selectors,omitempty"`
+	// Attr is the attribute read by the attr extractor.
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	// Pattern is the regular expression of the regex extractor.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Trust overrides the trust of the source of the values, see ExtractionStrategy.
+	Trust float64 `json:"trust,omitempty" yaml:"trust,omitempty"`
+	// Post are the post-processing steps applied to the values of the strategy.
+	Post []StepDefinition `json:"post,omitempty" yaml:"post,omitempty"`
+}
+
+// StepDefinition describes a post-processing step. A value that is empty once processed isn't a value anymore.
+type StepDefinition struct {
+	// Op is the step: trim, collapse_whitespace, strip_tags, lowercase, uppercase, trim_prefix, trim_suffix or
+	// replace.
+	Op string `json:"op" yaml:"op"`
+	// Value is the prefix of trim_prefix, or the suffix of trim_suffix.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Pattern is the regular expression of replace, and With its replacement, where $1 is the first submatch.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	With    string `json:"with,omitempty" yaml:"with,omitempty"`
+}
+
+// LoadRules reads the rule definitions of the file, see ParseRules.
+func LoadRules(path string) (map[string]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRules builds the rules defined in YAML or JSON, see RuleFile, by field. Unknown keys are errors, and so are
+// invalid definitions, see RuleFile.Build.
+func ParseRules(data []byte) (map[string]Rule, error) {
+	var file RuleFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("no rule definitions")
+			}
+			return nil, err
+		}
+	}
+	return file.Build()
+}
+
+// Build builds the rules by field. All the definitions are checked, selectors and patterns included, so that they
+// can't fail when the rules are used, and the errors are returned together.
+func (f *RuleFile) Build() (map[string]Rule, error) {
+	var errs []error
+	built := make(map[string]Rule, len(f.Rules))
+	for i, def := range f.Rules {
+		rule, err := def.build()
+		if err == nil && built[def.Field] != nil {
+			err = errors.New("field defined twice")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d] %q: %w", i, def.Field, err))
+			continue
+		}
+		built[def.Field] = rule
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return built, nil
+}
+
+func (d RuleDefinition) build() (Rule, error) {
+	var errs []error
+	if d.Field == "" {
+		errs = append(errs, errors.New("missing field"))
+	}
+	if len(d.Strategies) == 0 {
+		errs = append(errs, errors.New("no strategies"))
+	}
+	if d.MinLength < 0 || d.MaxLength < 0 || (d.MaxLength > 0 && d.MaxLength < d.MinLength) {
+		errs = append(errs, fmt.Errorf("invalid length range %d-%d", d.MinLength, d.MaxLength))
+	}
+	post, err := buildSteps(d.Post)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("post: %w", err))
+	}
+
+	strategies := make([]ExtractionStrategy, 0, len(d.Strategies))
+	for i, def := range d.Strategies {
+		strategy, err := def.build(post)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("strategies[%d]: %w", i, err))
+			continue
+		}
+		strategies = append(strategies, strategy)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	switch d.Field {
+	case "date":
+		return NewDateRule(strategies...), nil
+	case "modified_date":
+		return NewModifiedDateRule(strategies...), nil
+	}
+	rule := &BaseRule{Strategies: strategies}
+	if d.MinLength > 0 || d.MaxLength > 0 {
+		rule.Plausibility = LengthPlausibility(d.MinLength, d.MaxLength)
+	}
+	return rule, nil
+}
+
+// build builds the strategy, with the post-processing steps of the rule applied after its own.
+func (d StrategyDefinition) build(rulePost []func(string) string) (ExtractionStrategy, error) {
+	var errs []error
+	if d.Trust < 0 || d.Trust > 1 {
+		errs = append(errs, fmt.Errorf("trust %v out of [0, 1]", d.Trust))
+	}
+
+	var extractor ExtractFunc
+	compileSelectors := compileCSS
+	switch d.Extractor {
+	case ExtractorMeta:
+		extractor = ExtractMeta
+	case ExtractorAttr:
+		if d.Attr == "" {
+			errs = append(errs, errors.New("missing attr"))
+		}
+		extractor = ExtractAttr(d.Attr)
+	case ExtractorCSS:
+		extractor = ExtractCSS
+	case ExtractorJSONLD:
+		extractor = ExtractJSONLD
+		compileSelectors = compileJSONLD
+	case ExtractorMicrodata:
+		extractor = ExtractItems
+		compileSelectors = compileJSONLD
+	case ExtractorRegex:
+		pattern, err := regexp.Compile(d.Pattern)
+		if d.Pattern == "" {
+			err = errors.New("missing pattern")
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			extractor = ExtractRegex(pattern)
+		}
+	case "":
+		errs = append(errs, errors.New("missing extractor"))
+	default:
+		errs = append(errs, fmt.Errorf("unknown extractor %q", d.Extractor))
+	}
+
+	if len(d.Selectors) == 0 && d.Extractor != ExtractorRegex {
+		errs = append(errs, errors.New("no selectors"))
+	}
+	for _, selector := range d.Selectors {
+		if err := compileSelectors(selector); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	post, err := buildSteps(d.Post)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("post: %w", err))
+	}
+	if len(errs) > 0 {
+		return ExtractionStrategy{}, errors.Join(errs...)
+	}
+
+	if steps := append(post, rulePost...); len(steps) > 0 {
+		extractor = postProcess(extractor, steps)
+	}
+	return ExtractionStrategy{Selectors: d.Selectors, Extractor: extractor, Trust: d.Trust}, nil
+}
+
+func compileCSS(selector string) error {
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return nil
+}
+
+func compileJSONLD(selector string) error {
+	_, err := CompileJSONLDSelector(selector)
+	return err
+}
+
+func buildSteps(defs []StepDefinition) ([]func(string) string, error) {
+	var errs []error
+	steps := make([]func(string) string, 0, len(defs))
+	for i, def := range defs {
+		step, err := def.build()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[%d]: %w", i, err))
+			continue
+		}
+		steps = append(steps, step)
+	}
+	return steps, errors.Join(errs...)
+}
+
+func (d StepDefinition) build() (func(string) string, error) {
+	switch d.Op {
+	case StepTrim:
+		return strings.TrimSpace, nil
+	case StepCollapseWhitespace:
+		return func(s string) string { return strings.Join(strings.Fields(s), " ") }, nil
+	case StepStripTags:
+		return helpers.Normalize, nil
+	case StepLowercase:
+		return strings.ToLower, nil
+	case StepUppercase:
+		return strings.ToUpper, nil
+	case StepTrimPrefix, StepTrimSuffix:
+		if d.Value == "" {
+			return nil, fmt.Errorf("%s: missing value", d.Op)
+		}
+		if d.Op == StepTrimPrefix {
+			return func(s string) string { return strings.TrimPrefix(s, d.Value) }, nil
+		}
+		return func(s string) string { return strings.TrimSuffix(s, d.Value) }, nil
+	case StepReplace:
+		pattern, err := regexp.Compile(d.Pattern)
+		if d.Pattern == "" {
+			err = errors.New("missing pattern")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("replace: %w", err)
+		}
+		return func(s string) string { return pattern.ReplaceAllString(s, d.With) }, nil
+	case "":
+		return nil, errors.New("missing op")
+	}
+	return nil, fmt.Errorf("unknown op %q", d.Op)
+}
+
+// postProcess returns an extractor applying the steps to the string values of the extractor.
+func postProcess(extract ExtractFunc, steps []func(string) string) ExtractFunc {
+	return func(node *html.Node, targetURL *url.URL, selectors []string) ExtractResult {
+		result := extract(node, targetURL, selectors)
+		value, ok := result.Value().(string)
+		if !result.Found() || !ok {
+			return result
+		}
+		for _, step := range steps {
+			value = step(value)
+		}
+		if value == "" {
+			return NewNoResult()
+		}
+		return NewStringResult(value, result.SelectorInfo(), true)
+	}
+}
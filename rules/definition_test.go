@@ -0,0 +1,217 @@
+package rules_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/rules"
+)
+
+const definitionHTML = `<html><head>
+	<title>Rain expected all week | Example News</title>
+	<meta name="keywords" content="  Weather,   RAIN ">
+	<meta property="article:published_time" content="2024-03-05T10:30:00Z">
+	<link rel="license" href="https://creativecommons.org/licenses/by/4.0/">
+	<script type="application/ld+json">{"@type": "NewsArticle", "articleSection": "Weather"}</script>
+	</head><body>
+	<div itemscope itemtype="https://schema.org/Person"><span itemprop="jobTitle">Reporter</span></div>
+	<p class="meta">Jane Doe · 4 min read</p>
+	<p class="summary">Rain all week</p>
+	</body></html>`
+
+func TestParseRules(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(definitionHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com/rain")
+
+	parsed, err := rules.ParseRules([]byte(`
+rules:
+  - field: title
+    max_length: 150
+    strategies:
+      - extractor: css
+        selectors: ["title"]
+    post:
+      - op: trim_suffix
+        value: " | Example News"
+  - field: keywords
+    strategies:
+      - extractor: meta
+        selectors: ["meta[name='keywords']"]
+        post:
+          - op: collapse_whitespace
+          - op: lowercase
+  - field: license
+    strategies:
+      - extractor: attr
+        selectors: ["link[rel='license']"]
+        attr: href
+  - field: section
+    strategies:
+      - extractor: jsonld
+        selectors: ["NewsArticle.articleSection"]
+  - field: job
+    strategies:
+      - extractor: microdata
+        selectors: ["Person.jobTitle"]
+  - field: reading_time
+    strategies:
+      - extractor: regex
+        selectors: [".meta"]
+        pattern: '(\d+) min read'
+  - field: summary
+    strategies:
+      - extractor: css
+        selectors: [".summary"]
+        trust: 0.9
+        post:
+          - op: replace
+            pattern: '\s*week$'
+            with: " month"
+  - field: date
+    strategies:
+      - extractor: meta
+        selectors: ["meta[property='article:published_time']"]
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		field    string
+		expected any
+	}{
+		{field: "title", expected: "Rain expected all week"},
+		{field: "keywords", expected: "weather, rain"},
+		{field: "license", expected: "https://creativecommons.org/licenses/by/4.0/"},
+		{field: "section", expected: "Weather"},
+		{field: "job", expected: "Reporter"},
+		{field: "reading_time", expected: "4"},
+		{field: "summary", expected: "Rain all month"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			rule, ok := parsed[tt.field]
+			if !assert.True(t, ok) {
+				return
+			}
+			result, err := rule.Extract(node, targetURL)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, result.Value())
+			}
+		})
+	}
+
+	if assert.IsType(t, &rules.DateRule{}, parsed["date"]) {
+		result, err := parsed["date"].Extract(node, targetURL)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2024-03-05T10:30:00Z", dateOf(result).Time.Format(time.RFC3339))
+		}
+	}
+	assert.Len(t, parsed, len(tests)+1)
+}
+
+func TestParseRulesJSON(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(definitionHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com/rain")
+
+	parsed, err := rules.ParseRules([]byte(`{"rules": [
+		{"field": "reading_time", "strategies": [{"extractor": "regex", "pattern": "(\\d+) min read", "post": [{"op": "trim"}]}]}
+	]}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	result, err := parsed["reading_time"].Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "4", result.Value())
+		assert.Equal(t, rules.SourceRegex, result.SelectorInfo().Source)
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		desc     string
+		data     string
+		expected []string
+	}{
+		{desc: "empty", data: "", expected: []string{"no rule definitions"}},
+		{desc: "unknown key", data: "rules:\n  - field: title\n    selector: h1\n", expected: []string{"field selector not found"}},
+		{desc: "unknown JSON key", data: `{"rules": [{"field": "title", "selector": "h1"}]}`, expected: []string{`unknown field "selector"`}},
+		{
+			desc:     "invalid CSS selector",
+			data:     "rules:\n  - field: title\n    strategies:\n      - extractor: css\n        selectors: ['h1', 'meta[']\n",
+			expected: []string{`rules[0] "title": strategies[0]: invalid selector "meta["`},
+		},
+		{
+			desc:     "invalid JSON-LD selector",
+			data:     "rules:\n  - field: title\n    strategies:\n      - extractor: jsonld\n        selectors: ['Article.[']\n",
+			expected: []string{`rules[0] "title": strategies[0]:`},
+		},
+		{
+			desc:     "unknown extractor and op",
+			data:     "rules:\n  - field: title\n    strategies:\n      - extractor: xpath\n        selectors: ['//h1']\n    post:\n      - op: titlecase\n",
+			expected: []string{`post: [0]: unknown op "titlecase"`, `strategies[0]: unknown extractor "xpath"`},
+		},
+		{
+			desc:     "missing attr, pattern and selectors",
+			data:     "rules:\n  - field: a\n    strategies:\n      - extractor: attr\n      - extractor: regex\n",
+			expected: []string{"strategies[0]: missing attr", "no selectors", "strategies[1]: missing pattern"},
+		},
+		{
+			desc:     "invalid pattern",
+			data:     "rules:\n  - field: a\n    strategies:\n      - extractor: regex\n        pattern: '(a'\n",
+			expected: []string{"strategies[0]: error parsing regexp"},
+		},
+		{
+			desc:     "invalid trust and lengths",
+			data:     "rules:\n  - field: a\n    min_length: 10\n    max_length: 5\n    strategies:\n      - extractor: css\n        selectors: [h1]\n        trust: 2\n",
+			expected: []string{"invalid length range 10-5", "trust 2 out of [0, 1]"},
+		},
+		{
+			desc:     "missing field and strategies",
+			data:     "rules:\n  - strategies: []\n",
+			expected: []string{`rules[0] "": missing field`, "no strategies"},
+		},
+		{
+			desc:     "field defined twice",
+			data:     "rules:\n  - field: a\n    strategies: [{extractor: css, selectors: [h1]}]\n  - field: a\n    strategies: [{extractor: css, selectors: [h2]}]\n",
+			expected: []string{`rules[1] "a": field defined twice`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			parsed, err := rules.ParseRules([]byte(tt.data))
+			assert.Nil(t, parsed)
+			for _, expected := range tt.expected {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - field: title\n    strategies:\n      - extractor: css\n        selectors: ['h1[']\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := rules.LoadRules(path)
+	assert.ErrorContains(t, err, "rules "+path+": ")
+
+	_, err = rules.LoadRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
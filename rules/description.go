@@ -8,7 +8,8 @@ type DescriptionRule struct {
 func NewDescriptionRule() *DescriptionRule {
 	return &DescriptionRule{
 		BaseRule: BaseRule{
-			Strategies: descriptionStrategies,
+			Strategies:   descriptionStrategies,
+			Plausibility: LengthPlausibility(30, 400),
 		},
 	}
 }
@@ -27,7 +28,7 @@ var descriptionStrategies = []ExtractionStrategy{
 
 	// JSON LD
 	{
-		Selectors: []string{"description", "articleBody"},
+		Selectors: []string{articleTypes + ".description", "description", "articleBody"},
 		Extractor: ExtractJSONLD,
 	},
 
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"net/url"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// documentCache holds what was parsed from a whole document, see CacheDocument.
+type documentCache struct {
+	// refs is the number of CacheDocument calls not released yet.
+	refs int
+
+	mu sync.Mutex
+	// jsonld is the JSON-LD of the document, once parsed.
+	jsonld *JSONLDDocument
+	// items are the microdata and RDFa Lite items of the document, by document URL, as they are resolved against it.
+	items map[string]*documentItems
+}
+
+type documentItems struct {
+	items []*Item
+	doc   *JSONLDDocument
+}
+
+var documents = struct {
+	sync.Mutex
+	caches map[*html.Node]*documentCache
+}{caches: make(map[*html.Node]*documentCache)}
+
+// CacheDocument makes what the rules parse from the whole document, its JSON-LD and its microdata items, parsed
+// once until release is called, rather than by every rule and for every selector. The document must not be modified
+// until then. Calls can be nested, and made by concurrent extractions of the same document.
+func CacheDocument(doc *html.Node) (release func()) {
+	documents.Lock()
+	c, ok := documents.caches[doc]
+	if !ok {
+		c = &documentCache{}
+		documents.caches[doc] = c
+	}
+	c.refs++
+	documents.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			documents.Lock()
+			defer documents.Unlock()
+			c.refs--
+			if c.refs == 0 {
+				delete(documents.caches, doc)
+			}
+		})
+	}
+}
+
+// cachedDocument returns the cache of the document, or nil if it isn't cached.
+func cachedDocument(doc *html.Node) *documentCache {
+	documents.Lock()
+	defer documents.Unlock()
+	return documents.caches[doc]
+}
+
+// parsedJSONLD returns the JSON-LD of the document, parsed once while the document is cached.
+func parsedJSONLD(doc *html.Node) *JSONLDDocument {
+	c := cachedDocument(doc)
+	if c == nil {
+		return parseJSONLD(doc)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.jsonld == nil {
+		c.jsonld = parseJSONLD(doc)
+	}
+	return c.jsonld
+}
+
+// parsedItems returns the items of the document and their ItemDocument, parsed once while the document is cached.
+func parsedItems(doc *html.Node, docURL *url.URL) *documentItems {
+	c := cachedDocument(doc)
+	if c == nil {
+		items := parseItems(doc, docURL)
+		return &documentItems{items: items, doc: ItemDocument(items)}
+	}
+
+	key := ""
+	if docURL != nil {
+		key = docURL.String()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if parsed, ok := c.items[key]; ok {
+		return parsed
+	}
+	items := parseItems(doc, docURL)
+	parsed := &documentItems{items: items, doc: ItemDocument(items)}
+	if c.items == nil {
+		c.items = make(map[string]*documentItems)
+	}
+	c.items[key] = parsed
+	return parsed
+}
@@ -2,54 +2,19 @@ package rules
 
 import (
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/andybalholm/cascadia"
 	"golang.org/x/net/html"
 )
 
-import (
-	"encoding/json"
-	// import other required packages
-)
-
 type SelectorInfo struct {
 	Attr     string
 	InMeta   bool
 	Selector string
-}
-
-// ExtractJSONLD extracts the given JSON-LD attribute from the given document.
-func ExtractJSONLD(node *html.Node, _ *url.URL, selectors []string) ExtractResult {
-	jsonLdNodes := cascadia.QueryAll(node, cascadia.MustCompile(`script[type="application/ld+json"]`))
-	for _, jsonLdNode := range jsonLdNodes {
-		if jsonLdNode.FirstChild != nil {
-			var obj map[string]any
-			err := json.Unmarshal([]byte(jsonLdNode.FirstChild.Data), &obj)
-			if err != nil {
-				continue
-			}
-
-			for _, selector := range selectors {
-				keys := strings.Split(selector, ".")
-				val := obj
-				for _, key := range keys {
-					if nextVal, ok := val[key].(map[string]any); ok {
-						val = nextVal
-					} else if finalVal, ok := val[key].(string); ok {
-						return NewStringResult(finalVal, SelectorInfo{
-							Attr:     key,
-							InMeta:   false,
-							Selector: selector,
-						}, true)
-					} else {
-						break
-					}
-				}
-			}
-		}
-	}
-	return NewNoResult()
+	// Source is where the value was found, such as SourceMeta, see SourceTrust.
+	Source string
 }
 
 // ExtractCSS extracts the given CSS selector from the given document.
@@ -63,6 +28,7 @@ func ExtractCSS(node *html.Node, _ *url.URL, selectors []string) ExtractResult {
 					Attr:     "text",
 					InMeta:   false,
 					Selector: selector,
+					Source:   SourceCSS,
 				},
 				true,
 			)
@@ -85,6 +51,7 @@ func ExtractAttr(attribute string) ExtractFunc {
 								Attr:     attribute,
 								InMeta:   false,
 								Selector: selector,
+								Source:   SourceAttr,
 							},
 							true,
 						)
@@ -110,9 +77,65 @@ func ExtractMeta(node *html.Node, targetURL *url.URL, selectors []string) Extrac
 				Attr:     sr.SelectorInfo().Attr,
 				InMeta:   true,
 				Selector: sr.SelectorInfo().Selector,
+				Source:   SourceMeta,
 			},
 			result.Found(),
 		)
 	}
 	return NewNoResult()
 }
+
+// ExtractRegex returns an extractor matching the pattern against the text of the elements matched by the CSS
+// selectors, the text of scripts included, or against the text of the whole document if there are no selectors. The
+// value is the first submatch of the pattern, or the whole match if it has none.
+func ExtractRegex(pattern *regexp.Regexp) ExtractFunc {
+	return func(node *html.Node, _ *url.URL, selectors []string) ExtractResult {
+		match := func(n *html.Node, selector string) ExtractResult {
+			m := pattern.FindStringSubmatch(rawText(n))
+			if m == nil {
+				return nil
+			}
+			value := m[0]
+			if len(m) > 1 {
+				value = m[1]
+			}
+			return NewStringResult(strings.TrimSpace(value), SelectorInfo{
+				Attr:     "text",
+				InMeta:   false,
+				Selector: selector,
+				Source:   SourceRegex,
+			}, true)
+		}
+
+		if len(selectors) == 0 {
+			if result := match(node, pattern.String()); result != nil {
+				return result
+			}
+			return NewNoResult()
+		}
+		for _, selector := range selectors {
+			for _, n := range cascadia.QueryAll(node, cascadia.MustCompile(selector)) {
+				if result := match(n, selector); result != nil {
+					return result
+				}
+			}
+		}
+		return NewNoResult()
+	}
+}
+
+// rawText returns the text of the node and its descendants as is, scripts included.
+func rawText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
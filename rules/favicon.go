@@ -1,17 +1,23 @@
 package rules
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	"golang.org/x/net/html"
 
+	"github.com/octetic/gophetch/httpclient"
 	"github.com/octetic/gophetch/media"
 )
 
 // FaviconRule is the rule for extracting the favicon URL of a page.
 type FaviconRule struct {
 	BaseRule
+	// Client is the HTTP client used to probe /favicon.ico. If nil, the client carried by the context is used,
+	// falling back to http.DefaultClient.
+	Client *http.Client
 }
 
 func NewFaviconRule() *FaviconRule {
@@ -36,6 +42,11 @@ var faviconStrategies = []ExtractionStrategy{
 }
 
 func (r *FaviconRule) Extract(node *html.Node, targetURL *url.URL) (ExtractResult, error) {
+	return r.ExtractContext(context.Background(), node, targetURL)
+}
+
+// ExtractContext is like Extract, but the /favicon.ico probe is bound to the given context.
+func (r *FaviconRule) ExtractContext(ctx context.Context, node *html.Node, targetURL *url.URL) (ExtractResult, error) {
 	result, err := r.BaseRule.Extract(node, targetURL)
 	if err == nil && result.Found() {
 		return result, nil
@@ -43,7 +54,10 @@ func (r *FaviconRule) Extract(node *html.Node, targetURL *url.URL) (ExtractResul
 
 	// If no favicon was found, try to extract it from the /favicon.ico file.
 	faviconURL := fmt.Sprintf("%s://%s/favicon.ico", targetURL.Scheme, targetURL.Host)
-	if media.IsValidFavicon(faviconURL) {
+	if r.Client != nil {
+		ctx = httpclient.WithClient(ctx, r.Client)
+	}
+	if media.IsValidFaviconContext(ctx, faviconURL) {
 		return NewStringResult(
 			faviconURL,
 			SelectorInfo{
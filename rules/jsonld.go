@@ -0,0 +1,441 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// articleTypes selects the schema.org types of articles, for the rules that look for the article's own properties
+// before the ones of any other node, such as the WebPage or the WebSite.
+const articleTypes = "NewsArticle|Article|BlogPosting|ReportageNewsArticle|AnalysisNewsArticle|OpinionNewsArticle|" +
+	"ReviewNewsArticle|LiveBlogPosting|TechArticle|ScholarlyArticle|Report"
+
+var jsonLDScriptSelector = cascadia.MustCompile(`script[type="application/ld+json"]`)
+
+// JSONLDDocument holds the JSON-LD nodes of a page, from all its <script type="application/ld+json"> blocks.
+type JSONLDDocument struct {
+	// roots are the top-level nodes: the objects of each block, the elements of top-level arrays and the members of
+	// @graph.
+	roots []map[string]any
+	// nodes are all the nodes, nested ones included, in document order.
+	nodes []map[string]any
+	// ids are the nodes with an @id and properties, by @id, to resolve the references to them.
+	ids map[string]map[string]any
+}
+
+// ParseJSONLD parses the JSON-LD blocks of the document. Blocks that aren't valid JSON are skipped. While the
+// document is cached, see CacheDocument, it is parsed once.
+func ParseJSONLD(node *html.Node) *JSONLDDocument {
+	return parsedJSONLD(node)
+}
+
+func parseJSONLD(node *html.Node) *JSONLDDocument {
+	doc := &JSONLDDocument{ids: make(map[string]map[string]any)}
+	for _, script := range cascadia.QueryAll(node, jsonLDScriptSelector) {
+		if script.FirstChild == nil {
+			continue
+		}
+		data, nodes, err := decodeJSONLD(script.FirstChild.Data)
+		if err != nil {
+			continue
+		}
+		doc.addRoots(data)
+		for _, n := range nodes {
+			if hasProperties(n, "@context", "@graph") {
+				doc.nodes = append(doc.nodes, n)
+			}
+		}
+	}
+	for _, n := range doc.nodes {
+		doc.index(n)
+	}
+	return doc
+}
+
+// addRoots adds the top-level nodes of a block, flattening arrays and @graph.
+func (d *JSONLDDocument) addRoots(data any) {
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			d.addRoots(item)
+		}
+	case map[string]any:
+		graph, hasGraph := v["@graph"]
+		if !hasGraph || hasProperties(v, "@context", "@graph") {
+			d.roots = append(d.roots, v)
+		}
+		if hasGraph {
+			d.addRoots(graph)
+		}
+	}
+}
+
+// decodeJSONLD decodes a JSON-LD block. Along with the value, it returns all the objects it contains in document
+// order, which a map doesn't keep.
+func decodeJSONLD(data string) (any, []map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	var objects []map[string]any
+	var decode func() (any, error)
+	decode = func() (any, error) {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case json.Delim('{'):
+			object := make(map[string]any)
+			objects = append(objects, object)
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decode()
+				if err != nil {
+					return nil, err
+				}
+				object[key.(string)] = value
+			}
+			_, err = dec.Token()
+			return object, err
+		case json.Delim('['):
+			array := make([]any, 0)
+			for dec.More() {
+				value, err := decode()
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+			_, err = dec.Token()
+			return array, err
+		}
+		return token, nil
+	}
+
+	value, err := decode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, objects, nil
+}
+
+// index records a node under its @id. A node described in several places gets the properties of all of them.
+func (d *JSONLDDocument) index(n map[string]any) {
+	id, ok := n["@id"].(string)
+	if !ok || !hasProperties(n, "@id", "@context") {
+		return
+	}
+	existing, ok := d.ids[id]
+	if !ok {
+		d.ids[id] = n
+		return
+	}
+	for key, value := range n {
+		if _, ok := existing[key]; !ok {
+			existing[key] = value
+		}
+	}
+}
+
+// resolve returns the node a reference such as {"@id": "#publisher"} points to, or the value itself.
+func (d *JSONLDDocument) resolve(value any) any {
+	n, ok := value.(map[string]any)
+	if !ok || hasProperties(n, "@id") {
+		return value
+	}
+	if id, ok := n["@id"].(string); ok {
+		if target, ok := d.ids[id]; ok {
+			return target
+		}
+	}
+	return value
+}
+
+// hasProperties reports whether the node has keys other than the given ones.
+func hasProperties(n map[string]any, except ...string) bool {
+	for key := range n {
+		found := false
+		for _, e := range except {
+			if key == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONLDSelector selects values from a JSONLDDocument. Selectors are dotted property paths, with these additions:
+//
+//   - A leading segment starting with an uppercase letter selects the nodes of that @type, wherever they are in the
+//     document, such as NewsArticle.headline. Several types are separated by |, as in NewsArticle|Article.headline.
+//     Without it, the path starts from the top-level nodes.
+//   - A property may be followed by an index, such as author[0], or a wildcard, author[*]. Without either, every
+//     element of an array is selected, as JSON-LD allows any property to have one or many values.
+//   - A property may be followed by a @type predicate, such as author[@type=Person], to only keep the nodes of that
+//     type.
+//
+// References to other nodes, such as {"@id": "#publisher"}, are followed, and value objects such as
+// {"@value": "..."} are replaced by their value.
+type JSONLDSelector struct {
+	raw   string
+	types []string
+	steps []jsonLDStep
+}
+
+type jsonLDStep struct {
+	key string
+	// index is the array element to select, or -1 for all of them.
+	index int
+	// types are the @type the selected nodes must have, if any.
+	types []string
+}
+
+var jsonLDSelectorCache sync.Map
+
+// CompileJSONLDSelector parses a JSON-LD selector, see JSONLDSelector.
+func CompileJSONLDSelector(selector string) (*JSONLDSelector, error) {
+	s := &JSONLDSelector{raw: selector}
+	segments := strings.Split(selector, ".")
+	if first := segments[0]; first != "" && unicode.IsUpper(rune(first[0])) {
+		for _, t := range strings.Split(first, "|") {
+			if !isJSONLDName(t) {
+				return nil, fmt.Errorf("jsonld selector %q: invalid type %q", selector, t)
+			}
+			s.types = append(s.types, t)
+		}
+		segments = segments[1:]
+	}
+
+	for _, segment := range segments {
+		step, err := parseJSONLDStep(segment)
+		if err != nil {
+			return nil, fmt.Errorf("jsonld selector %q: %w", selector, err)
+		}
+		s.steps = append(s.steps, step)
+	}
+	if len(s.types) == 0 && len(s.steps) == 0 {
+		return nil, fmt.Errorf("jsonld selector %q: empty selector", selector)
+	}
+	return s, nil
+}
+
+// MustCompileJSONLDSelector is like CompileJSONLDSelector, but panics if the selector is invalid.
+func MustCompileJSONLDSelector(selector string) *JSONLDSelector {
+	s, err := CompileJSONLDSelector(selector)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// cachedJSONLDSelector compiles the selectors of the built-in rules once.
+func cachedJSONLDSelector(selector string) *JSONLDSelector {
+	if s, ok := jsonLDSelectorCache.Load(selector); ok {
+		return s.(*JSONLDSelector)
+	}
+	s := MustCompileJSONLDSelector(selector)
+	jsonLDSelectorCache.Store(selector, s)
+	return s
+}
+
+func parseJSONLDStep(segment string) (jsonLDStep, error) {
+	step := jsonLDStep{index: -1}
+	key, rest, _ := strings.Cut(segment, "[")
+	if !isJSONLDName(key) && key != "@id" && key != "@type" {
+		return step, fmt.Errorf("invalid property %q", segment)
+	}
+	step.key = key
+
+	for rest != "" {
+		predicate, after, found := strings.Cut(rest, "]")
+		if !found {
+			return step, fmt.Errorf("unclosed [ in %q", segment)
+		}
+		switch {
+		case predicate == "*":
+		case strings.HasPrefix(predicate, "@type="):
+			for _, t := range strings.Split(strings.TrimPrefix(predicate, "@type="), "|") {
+				if !isJSONLDName(t) {
+					return step, fmt.Errorf("invalid type %q in %q", t, segment)
+				}
+				step.types = append(step.types, t)
+			}
+		default:
+			index, err := strconv.Atoi(predicate)
+			if err != nil || index < 0 {
+				return step, fmt.Errorf("invalid index %q in %q", predicate, segment)
+			}
+			step.index = index
+		}
+		if after != "" && after[0] != '[' {
+			return step, fmt.Errorf("unexpected %q after ] in %q", after, segment)
+		}
+		rest = strings.TrimPrefix(after, "[")
+	}
+	return step, nil
+}
+
+func isJSONLDName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector as it was written.
+func (s *JSONLDSelector) String() string {
+	return s.raw
+}
+
+// Select returns the values the selector matches, in document order.
+func (s *JSONLDSelector) Select(doc *JSONLDDocument) []any {
+	var current []any
+	if len(s.types) > 0 {
+		for _, n := range doc.nodes {
+			if hasJSONLDType(n, s.types) {
+				current = append(current, n)
+			}
+		}
+	} else {
+		for _, n := range doc.roots {
+			current = append(current, n)
+		}
+	}
+
+	for _, step := range s.steps {
+		var next []any
+		for _, value := range current {
+			n, ok := doc.resolve(value).(map[string]any)
+			if !ok {
+				continue
+			}
+			property, ok := n[step.key]
+			if !ok {
+				continue
+			}
+			for _, v := range selectIndex(property, step.index) {
+				v = doc.resolve(v)
+				if len(step.types) > 0 {
+					if vn, ok := v.(map[string]any); !ok || !hasJSONLDType(vn, step.types) {
+						continue
+					}
+				}
+				next = append(next, v)
+			}
+		}
+		current = next
+	}
+
+	values := make([]any, 0, len(current))
+	for _, value := range current {
+		// A property without an index or a wildcard selects every element of an array
+		for _, v := range selectIndex(value, -1) {
+			v = doc.resolve(v)
+			if n, ok := v.(map[string]any); ok {
+				if literal, ok := n["@value"]; ok {
+					v = literal
+				}
+			}
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// selectIndex returns the element at index of an array, or all of them if index is -1. A single value is treated
+// as an array of one.
+func selectIndex(value any, index int) []any {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	if index < 0 {
+		return items
+	}
+	if index < len(items) {
+		return items[index : index+1]
+	}
+	return nil
+}
+
+// hasJSONLDType reports whether the node has one of the types, written as a name, a prefixed name such as
+// schema:Article, or a URL.
+func hasJSONLDType(n map[string]any, types []string) bool {
+	var nodeTypes []any
+	switch t := n["@type"].(type) {
+	case string:
+		nodeTypes = []any{t}
+	case []any:
+		nodeTypes = t
+	}
+	for _, nt := range nodeTypes {
+		name, ok := nt.(string)
+		if !ok {
+			continue
+		}
+		if i := strings.LastIndexAny(name, "/#:"); i >= 0 {
+			name = name[i+1:]
+		}
+		for _, t := range types {
+			if name == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExtractJSONLD extracts the first non-empty string matched by the JSON-LD selectors, see JSONLDSelector, from the
+// given document.
+func ExtractJSONLD(node *html.Node, _ *url.URL, selectors []string) ExtractResult {
+	return selectString(ParseJSONLD(node), selectors, SourceJSONLD)
+}
+
+// selectString returns the first non-empty string matched by the selectors in the document, found in the given
+// source.
+func selectString(doc *JSONLDDocument, selectors []string, source string) ExtractResult {
+	if len(doc.roots) == 0 {
+		return NewNoResult()
+	}
+
+	for _, selector := range selectors {
+		s := cachedJSONLDSelector(selector)
+		for _, value := range s.Select(doc) {
+			if str, ok := value.(string); ok && strings.TrimSpace(str) != "" {
+				attr := "@type"
+				if len(s.steps) > 0 {
+					attr = s.steps[len(s.steps)-1].key
+				}
+				return NewStringResult(str, SelectorInfo{
+					Attr:     attr,
+					InMeta:   false,
+					Selector: selector,
+					Source:   source,
+				}, true)
+			}
+		}
+	}
+	return NewNoResult()
+}
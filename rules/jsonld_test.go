@@ -0,0 +1,150 @@
+package rules_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/rules"
+)
+
+const jsonLDPage = `<html><head>
+<script type="application/ld+json">
+{
+  "@context": "https://schema.org",
+  "@graph": [
+    {"@type": "WebSite", "@id": "https://example.com/#website", "name": "Example News"},
+    {"@type": "WebPage", "@id": "https://example.com/story#webpage", "name": "Story | Example News",
+     "description": "The page"},
+    {
+      "@type": ["NewsArticle", "Article"],
+      "headline": "The story",
+      "description": {"@value": "The article"},
+      "isPartOf": {"@id": "https://example.com/story#webpage"},
+      "publisher": {"@id": "https://example.com/#organization"},
+      "author": [
+        {"@type": "Person", "name": "Jane Doe", "url": "https://example.com/jane"},
+        {"@type": "Organization", "name": "Example Wire"},
+        {"@type": "Person", "name": "John Roe"}
+      ]
+    },
+    {"@type": "Organization", "@id": "https://example.com/#organization", "name": "Example Media",
+     "logo": {"@type": "ImageObject", "url": "https://example.com/logo.png"}}
+  ]
+}
+</script>
+<script type="application/ld+json">
+[
+  {"@context": "https://schema.org", "@type": "BreadcrumbList",
+   "itemListElement": [{"@type": "ListItem", "position": 1, "name": "News"}, {"@type": "ListItem", "position": 2, "name": "World"}]},
+  {"@context": "https://schema.org", "@type": "http://schema.org/VideoObject", "name": "The video"}
+]
+</script>
+<script type="application/ld+json">{not json}</script>
+</head></html>`
+
+func TestJSONLDSelector(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(jsonLDPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := rules.ParseJSONLD(node)
+
+	tests := []struct {
+		selector string
+		expected []any
+	}{
+		{selector: "name", expected: []any{"Example News", "Story | Example News", "Example Media", "The video"}},
+		{selector: "NewsArticle.headline", expected: []any{"The story"}},
+		{selector: "NewsArticle.author[*].name", expected: []any{"Jane Doe", "Example Wire", "John Roe"}},
+		{selector: "NewsArticle.author.name", expected: []any{"Jane Doe", "Example Wire", "John Roe"}},
+		{selector: "NewsArticle.author[1].name", expected: []any{"Example Wire"}},
+		{selector: "NewsArticle.author[5].name", expected: []any{}},
+		{selector: "NewsArticle.author[@type=Person].name", expected: []any{"Jane Doe", "John Roe"}},
+		{selector: "NewsArticle.author[@type=Person][1].url", expected: []any{}},
+		{selector: "NewsArticle.author[@type=Person|Organization][1].name", expected: []any{"Example Wire"}},
+		{selector: "Article.publisher.name", expected: []any{"Example Media"}},
+		{selector: "Article.publisher.logo.url", expected: []any{"https://example.com/logo.png"}},
+		{selector: "Article.isPartOf.description", expected: []any{"The page"}},
+		{selector: "Article.description", expected: []any{"The article"}},
+		{selector: "Person.name", expected: []any{"Jane Doe", "John Roe"}},
+		{selector: "WebPage|WebSite.name", expected: []any{"Example News", "Story | Example News"}},
+		{selector: "BreadcrumbList.itemListElement[*].position", expected: []any{1.0, 2.0}},
+		{selector: "VideoObject.name", expected: []any{"The video"}},
+		{selector: "Organization.@id", expected: []any{"https://example.com/#organization"}},
+		{selector: "Recipe.name", expected: []any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := rules.CompileJSONLDSelector(tt.selector)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, s.Select(doc))
+			}
+		})
+	}
+}
+
+func TestCompileJSONLDSelectorErrors(t *testing.T) {
+	tests := []struct {
+		selector      string
+		expectedError string
+	}{
+		{selector: "", expectedError: `jsonld selector "": invalid property ""`},
+		{selector: "author..name", expectedError: `jsonld selector "author..name": invalid property ""`},
+		{selector: "author[*", expectedError: `jsonld selector "author[*": unclosed [ in "author[*"`},
+		{selector: "author[-1]", expectedError: `jsonld selector "author[-1]": invalid index "-1" in "author[-1]"`},
+		{selector: "author[0]x", expectedError: `jsonld selector "author[0]x": unexpected "x" after ] in "author[0]x"`},
+		{selector: "author[@type=]", expectedError: `jsonld selector "author[@type=]": invalid type "" in "author[@type=]"`},
+		{selector: "News Article.headline", expectedError: `jsonld selector "News Article.headline": invalid type "News Article"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			_, err := rules.CompileJSONLDSelector(tt.selector)
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+// The rules look for the properties of the article before the ones of the other nodes
+func TestJSONLDRules(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(jsonLDPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com/story")
+
+	tests := []struct {
+		rule     rules.Rule
+		expected string
+	}{
+		{rule: rules.NewAuthorRule(), expected: "Jane Doe"},
+		{rule: rules.NewPublisherRule(), expected: "Example Media"},
+		{rule: rules.NewDescriptionRule(), expected: "The article"},
+	}
+
+	for _, tt := range tests {
+		result, err := tt.rule.Extract(node, targetURL)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.expected, result.Value())
+		}
+	}
+}
+
+// While the document is cached, its JSON-LD is parsed once
+func TestParseJSONLDCached(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<script type="application/ld+json">{"@type": "Article", "headline": "Cached"}</script>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := rules.CacheDocument(node)
+	doc := rules.ParseJSONLD(node)
+	assert.Same(t, doc, rules.ParseJSONLD(node))
+	release()
+	assert.NotSame(t, doc, rules.ParseJSONLD(node))
+}
@@ -0,0 +1,433 @@
+package rules
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/helpers"
+)
+
+// Syntaxes of the items returned by ParseItems.
+const (
+	SyntaxMicrodata = "microdata"
+	SyntaxRDFa      = "rdfa"
+)
+
+// Item is a typed tree of properties described with microdata or RDFa Lite, such as a Product, a Recipe or an
+// Article.
+type Item struct {
+	// Types are the item's types as written, usually schema.org URLs such as https://schema.org/Product.
+	Types []string `json:"types,omitempty"`
+	// ID is the global identifier of the item, from itemid or resource, if any.
+	ID string `json:"id,omitempty"`
+	// Properties are the values of the item's properties, by name: strings, or *Item for nested items. Names in the
+	// schema.org vocabulary are given without their prefix, such as "author" for schema:author.
+	Properties map[string][]any `json:"properties"`
+	// Syntax is how the item is described, SyntaxMicrodata or SyntaxRDFa.
+	Syntax string `json:"syntax"`
+
+	// names are the property names in document order.
+	names []string
+	// size is the number of values in the tree of the item, those of its nested items included.
+	size int
+	// nested is whether the item is the value of a property already.
+	nested bool
+}
+
+func newItem(syntax string) *Item {
+	return &Item{Properties: make(map[string][]any), Syntax: syntax}
+}
+
+func (i *Item) add(names []string, value any) {
+	for _, name := range names {
+		if _, ok := i.Properties[name]; !ok {
+			i.names = append(i.names, name)
+		}
+		i.Properties[name] = append(i.Properties[name], value)
+	}
+}
+
+// Limits of ParseItems. An itemref makes the elements it points to part of the item, and several items can point
+// to the same ones, so that an item can be the value of many properties, as can the items nested in it. Without
+// limits, a small page could make a tree that doubles in size with each level of nesting.
+const (
+	// maxItemDepth is how deep items can be nested in each other.
+	maxItemDepth = 32
+	// maxItemValues is how many values the trees of all the items can hold, counting the values of an item each
+	// time it is nested.
+	maxItemValues = 10000
+	// maxItemTextLen is the most bytes a value read from the text of an element holds.
+	maxItemTextLen = 8192
+	// maxItemText is how many bytes of text all the values can be read from, each element walked to find them
+	// counting as one. The text of an element is that of all the elements in it, which nested properties read again.
+	maxItemText = 1 << 20
+)
+
+// ParseItems returns the top-level microdata items of the document, following the WHATWG HTML specification, then
+// its top-level RDFa Lite items. URL values are resolved against the document's base URL, see helpers.DocumentBase,
+// with docURL being the URL of the document. While the document is cached, see CacheDocument, the items are parsed
+// once and shared.
+func ParseItems(doc *html.Node, docURL *url.URL) []*Item {
+	if cachedDocument(doc) != nil {
+		return parsedItems(doc, docURL).items
+	}
+	return parseItems(doc, docURL)
+}
+
+func parseItems(doc *html.Node, docURL *url.URL) []*Item {
+	p := itemParser{
+		base:  helpers.DocumentBase(doc, docURL),
+		ids:   make(map[string]*html.Node),
+		items: make(map[*html.Node]*Item),
+	}
+	p.indexIDs(doc)
+
+	var items []*Item
+	walkElements(doc, func(n *html.Node) bool {
+		if hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+			items = append(items, p.microdataItem(n, map[*html.Node]bool{}))
+		}
+		return true
+	})
+	return append(items, p.rdfaItems(doc)...)
+}
+
+type itemParser struct {
+	base *url.URL
+	// ids are the elements by id, for itemref.
+	ids map[string]*html.Node
+	// items are the microdata items read so far, by itemscope element, so that each is read once.
+	items map[*html.Node]*Item
+	// values is the number of values in the trees of the items read so far, see maxItemValues.
+	values int
+	// text is how much text the values were read from so far, see maxItemText.
+	text int
+}
+
+func (p *itemParser) indexIDs(n *html.Node) {
+	walkElements(n, func(n *html.Node) bool {
+		if id := attr(n, "id"); id != "" {
+			if _, ok := p.ids[id]; !ok {
+				p.ids[id] = n
+			}
+		}
+		return true
+	})
+}
+
+// microdataItem reads the item of an itemscope element, or returns it if it was read already. The ancestors are the
+// items being read, so that an itemref pointing back to one of them doesn't loop.
+func (p *itemParser) microdataItem(n *html.Node, ancestors map[*html.Node]bool) *Item {
+	if item, ok := p.items[n]; ok {
+		return item
+	}
+	item := newItem(SyntaxMicrodata)
+	item.Types = strings.Fields(attr(n, "itemtype"))
+	item.ID = strings.TrimSpace(attr(n, "itemid"))
+	ancestors[n] = true
+	defer delete(ancestors, n)
+
+	// The properties are the itemprop elements under the item, and under the elements it refers to, that don't
+	// belong to a nested item
+	roots := []*html.Node{n}
+	for _, id := range strings.Fields(attr(n, "itemref")) {
+		if ref, ok := p.ids[id]; ok && ref != n {
+			roots = append(roots, ref)
+		}
+	}
+	seen := make(map[*html.Node]bool)
+	for i, root := range roots {
+		visit := func(e *html.Node) bool {
+			if seen[e] || p.values >= maxItemValues {
+				return false
+			}
+			seen[e] = true
+			if names := strings.Fields(attr(e, "itemprop")); len(names) > 0 {
+				p.add(item, schemaNames(names), p.microdataValue(e, ancestors))
+			}
+			return !hasAttr(e, "itemscope")
+		}
+		if i == 0 {
+			for c := root.FirstChild; c != nil; c = c.NextSibling {
+				walkElements(c, visit)
+			}
+		} else {
+			walkElements(root, visit)
+		}
+	}
+	p.items[n] = item
+	return item
+}
+
+// add adds the value to the properties of the item, unless the trees of the items would hold more than
+// maxItemValues values. A nested item that is already the value of a property counts with all its values again.
+func (p *itemParser) add(item *Item, names []string, value any) {
+	nested, isItem := value.(*Item)
+	for _, name := range names {
+		size := 1
+		if isItem {
+			size += nested.size
+		}
+		// The values of a nested item were counted when it was read, the first time it is nested
+		count := size
+		if isItem && !nested.nested {
+			count = 1
+		}
+		if p.values+count > maxItemValues {
+			return
+		}
+		p.values += count
+		if isItem {
+			nested.nested = true
+		}
+		item.size += size
+		item.add([]string{name}, value)
+	}
+}
+
+// microdataValue returns the value of an itemprop element.
+func (p *itemParser) microdataValue(n *html.Node, ancestors map[*html.Node]bool) any {
+	if hasAttr(n, "itemscope") {
+		if ancestors[n] || len(ancestors) >= maxItemDepth {
+			return ""
+		}
+		return p.microdataItem(n, ancestors)
+	}
+
+	switch n.Data {
+	case "meta":
+		return strings.TrimSpace(attr(n, "content"))
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return helpers.ResolveURL(p.base, attr(n, "src"))
+	case "a", "area", "link":
+		return helpers.ResolveURL(p.base, attr(n, "href"))
+	case "object":
+		return helpers.ResolveURL(p.base, attr(n, "data"))
+	case "data", "meter":
+		return strings.TrimSpace(attr(n, "value"))
+	case "time":
+		if hasAttr(n, "datetime") {
+			return strings.TrimSpace(attr(n, "datetime"))
+		}
+	}
+	// Many sites put the value in a content attribute on other elements too, as RDFa does
+	if hasAttr(n, "content") {
+		return strings.TrimSpace(attr(n, "content"))
+	}
+	return p.textContent(n)
+}
+
+// rdfaItems returns the top-level RDFa Lite items of the document: the typeof elements that aren't the value of a property
+// of another item.
+func (p *itemParser) rdfaItems(doc *html.Node) []*Item {
+	var items []*Item
+	var walk func(n *html.Node, vocab string, parent *Item)
+	walk = func(n *html.Node, vocab string, parent *Item) {
+		if n.Type == html.ElementNode {
+			if v, ok := attrOK(n, "vocab"); ok {
+				vocab = strings.TrimSpace(v)
+			}
+
+			names := schemaNames(strings.Fields(attr(n, "property")))
+			if typeOf, ok := attrOK(n, "typeof"); ok {
+				item := newItem(SyntaxRDFa)
+				for _, t := range strings.Fields(typeOf) {
+					if !strings.Contains(t, ":") {
+						t = vocab + t
+					}
+					item.Types = append(item.Types, t)
+				}
+				if resource, ok := attrOK(n, "resource"); ok {
+					item.ID = helpers.ResolveURL(p.base, resource)
+				}
+				if parent != nil && len(names) > 0 {
+					parent.add(names, item)
+				} else {
+					items = append(items, item)
+				}
+				parent = item
+			} else if parent != nil && len(names) > 0 {
+				parent.add(names, p.rdfaValue(n))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, vocab, parent)
+		}
+	}
+	walk(doc, "", nil)
+	return items
+}
+
+// rdfaValue returns the value of a property element without typeof.
+func (p *itemParser) rdfaValue(n *html.Node) any {
+	if content, ok := attrOK(n, "content"); ok {
+		return strings.TrimSpace(content)
+	}
+	for _, name := range []string{"resource", "href", "src"} {
+		if value, ok := attrOK(n, name); ok {
+			return helpers.ResolveURL(p.base, value)
+		}
+	}
+	if n.Data == "time" && hasAttr(n, "datetime") {
+		return strings.TrimSpace(attr(n, "datetime"))
+	}
+	return p.textContent(n)
+}
+
+// schemaNames returns the names of properties without their schema.org prefix, such as "author" for
+// "schema:author" or "https://schema.org/author".
+func schemaNames(names []string) []string {
+	for i, name := range names {
+		for _, prefix := range []string{"schema:", "http://schema.org/", "https://schema.org/"} {
+			if strings.HasPrefix(name, prefix) {
+				names[i] = strings.TrimPrefix(name, prefix)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// ItemDocument returns the items as a document that JSON-LD selectors can query, see JSONLDSelector. Each item is a
+// node with its types as @type and its ID as @id.
+func ItemDocument(items []*Item) *JSONLDDocument {
+	doc := &JSONLDDocument{ids: make(map[string]map[string]any)}
+	added := make(map[*Item]map[string]any)
+	for _, item := range items {
+		doc.roots = append(doc.roots, doc.addItem(item, added, 0))
+	}
+	for _, n := range doc.nodes {
+		doc.index(n)
+	}
+	return doc
+}
+
+// propertyNames returns the names of the properties in document order. Properties added to Properties directly
+// come last, sorted.
+func (i *Item) propertyNames() []string {
+	names := make([]string, 0, len(i.Properties))
+	listed := make(map[string]bool, len(i.names))
+	for _, name := range i.names {
+		if _, ok := i.Properties[name]; ok {
+			names = append(names, name)
+			listed[name] = true
+		}
+	}
+	var rest []string
+	for name := range i.Properties {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// addItem adds the node of the item, and those of its nested items. An item is added once, nested items that were
+// added already are the same node, and items nested deeper than maxItemDepth are left out.
+func (d *JSONLDDocument) addItem(item *Item, added map[*Item]map[string]any, depth int) map[string]any {
+	if n, ok := added[item]; ok {
+		return n
+	}
+	n := make(map[string]any, len(item.Properties)+2)
+	added[item] = n
+	d.nodes = append(d.nodes, n)
+	if len(item.Types) > 0 {
+		types := make([]any, len(item.Types))
+		for i, t := range item.Types {
+			types[i] = t
+		}
+		n["@type"] = types
+	}
+	if item.ID != "" {
+		n["@id"] = item.ID
+	}
+	for _, name := range item.propertyNames() {
+		values := item.Properties[name]
+		converted := make([]any, 0, len(values))
+		for _, value := range values {
+			if nested, ok := value.(*Item); ok {
+				if depth+1 >= maxItemDepth {
+					continue
+				}
+				value = d.addItem(nested, added, depth+1)
+			}
+			converted = append(converted, value)
+		}
+		n[name] = converted
+	}
+	return n
+}
+
+// ExtractItems extracts the first non-empty string matched by the JSON-LD selectors, see JSONLDSelector, from the
+// microdata and RDFa Lite items of the document, see ParseItems.
+func ExtractItems(node *html.Node, targetURL *url.URL, selectors []string) ExtractResult {
+	return selectString(parsedItems(node, targetURL).doc, selectors, SourceMicrodata)
+}
+
+func walkElements(n *html.Node, visit func(*html.Node) bool) {
+	if n.Type == html.ElementNode && !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, visit)
+	}
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := attrOK(n, key)
+	return value
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	_, ok := attrOK(n, key)
+	return ok
+}
+
+// textContent returns the text of the node and its descendants, with the whitespace collapsed, within
+// maxItemTextLen and maxItemText.
+func (p *itemParser) textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node) bool
+	walk = func(n *html.Node) bool {
+		if p.text >= maxItemText || b.Len() >= maxItemTextLen {
+			return false
+		}
+		p.text++
+		switch n.Type {
+		case html.TextNode:
+			data := n.Data
+			if len(data) > maxItemTextLen-b.Len() {
+				data = data[:maxItemTextLen-b.Len()]
+			}
+			p.text += len(data)
+			b.WriteString(data)
+			b.WriteByte(' ')
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !walk(c) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(n)
+	// The text may end in the middle of a character
+	return strings.ToValidUTF8(strings.Join(strings.Fields(b.String()), " "), "")
+}
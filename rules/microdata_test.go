@@ -0,0 +1,245 @@
+package rules_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/rules"
+)
+
+const itemsPage = `<html><head><base href="https://cdn.example.com/shop/"></head><body>
+<div itemscope itemtype="https://schema.org/Product" itemref="reviews">
+  <h1 itemprop="name">Kettle</h1>
+  <img itemprop="image" src="kettle.jpg" alt="">
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <meta itemprop="priceCurrency" content="EUR">
+    <span itemprop="price" content="39.90">39,90 €</span>
+    <link itemprop="availability" href="https://schema.org/InStock">
+  </div>
+  <div itemprop="brand" itemscope itemtype="https://schema.org/Brand"><span itemprop="name">Boil</span></div>
+</div>
+<section id="reviews">
+  <div itemprop="review" itemscope itemtype="https://schema.org/Review">
+    <span itemprop="author" itemscope itemtype="https://schema.org/Person"><span itemprop="name">Ann</span></span>
+    <data itemprop="reviewRating" value="5">Five stars</data>
+  </div>
+</section>
+
+<div vocab="https://schema.org/" typeof="Recipe">
+  <h2 property="name">Pancakes</h2>
+  <span property="author" typeof="Person"><span property="name">Sam   Cook</span></span>
+  <time property="cookTime" datetime="PT20M">20 minutes</time>
+  <ul><li property="recipeIngredient">Flour</li><li property="recipeIngredient">Milk</li></ul>
+  <a property="url" href="/recipes/pancakes">Permalink</a>
+</div>
+
+<article typeof="schema:Event" resource="#launch">
+  <span property="schema:name">Launch</span>
+  <meta property="schema:startDate" content="2024-05-01T18:00">
+</article>
+</body></html>`
+
+func parseItems(t *testing.T, page string) []*rules.Item {
+	node, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docURL, _ := url.Parse("https://example.com/page")
+	return rules.ParseItems(node, docURL)
+}
+
+func TestParseItems(t *testing.T) {
+	items := parseItems(t, itemsPage)
+	data, err := json.Marshal(items)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.JSONEq(t, `[
+		{
+			"types": ["https://schema.org/Product"],
+			"syntax": "microdata",
+			"properties": {
+				"name": ["Kettle"],
+				"image": ["https://cdn.example.com/shop/kettle.jpg"],
+				"offers": [{
+					"types": ["https://schema.org/Offer"],
+					"syntax": "microdata",
+					"properties": {
+						"priceCurrency": ["EUR"],
+						"price": ["39.90"],
+						"availability": ["https://schema.org/InStock"]
+					}
+				}],
+				"brand": [{"types": ["https://schema.org/Brand"], "syntax": "microdata", "properties": {"name": ["Boil"]}}],
+				"review": [{
+					"types": ["https://schema.org/Review"],
+					"syntax": "microdata",
+					"properties": {
+						"author": [{"types": ["https://schema.org/Person"], "syntax": "microdata", "properties": {"name": ["Ann"]}}],
+						"reviewRating": ["5"]
+					}
+				}]
+			}
+		},
+		{
+			"types": ["https://schema.org/Recipe"],
+			"syntax": "rdfa",
+			"properties": {
+				"name": ["Pancakes"],
+				"author": [{"types": ["https://schema.org/Person"], "syntax": "rdfa", "properties": {"name": ["Sam Cook"]}}],
+				"cookTime": ["PT20M"],
+				"recipeIngredient": ["Flour", "Milk"],
+				"url": ["https://cdn.example.com/recipes/pancakes"]
+			}
+		},
+		{
+			"types": ["schema:Event"],
+			"id": "https://cdn.example.com/shop/#launch",
+			"syntax": "rdfa",
+			"properties": {
+				"name": ["Launch"],
+				"startDate": ["2024-05-01T18:00"]
+			}
+		}
+	]`, string(data))
+}
+
+// Items that refer to each other don't loop
+func TestParseItemsItemrefCycle(t *testing.T) {
+	items := parseItems(t, `<div id="a" itemscope itemtype="https://schema.org/Thing" itemref="b">
+		<span itemprop="name">A</span></div>
+		<div id="b" itemprop="related" itemscope itemref="a"><span itemprop="name">B</span></div>`)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, []any{"A"}, items[0].Properties["name"])
+		related := items[0].Properties["related"][0].(*rules.Item)
+		// The properties of an item referred to aren't those of the referring item
+		assert.Equal(t, map[string][]any{"name": {"B"}}, related.Properties)
+	}
+}
+
+// Items pointing to the same elements share them instead of making a tree that doubles in size with each level
+func TestParseItemsItemrefFanOut(t *testing.T) {
+	page := func(levels int) string {
+		var b strings.Builder
+		b.WriteString(`<div itemscope itemtype="https://schema.org/Thing" itemref="l0"></div>`)
+		for i := 0; i < levels; i++ {
+			fmt.Fprintf(&b, `<div id="l%d"><span itemprop="a" itemscope itemref="l%d"></span>`, i, i+1)
+			fmt.Fprintf(&b, `<span itemprop="b" itemscope itemref="l%d"></span></div>`, i+1)
+		}
+		return b.String()
+	}
+
+	items := parseItems(t, page(3))
+	if assert.Len(t, items, 1) {
+		a := items[0].Properties["a"][0].(*rules.Item)
+		b := items[0].Properties["b"][0].(*rules.Item)
+		assert.Same(t, a.Properties["a"][0], b.Properties["a"][0])
+	}
+
+	items = parseItems(t, page(60))
+	if !assert.Len(t, items, 1) {
+		return
+	}
+	data, err := json.Marshal(items)
+	if assert.NoError(t, err) {
+		assert.Less(t, len(data), 1<<20)
+	}
+	doc := rules.ItemDocument(items)
+	assert.Len(t, rules.MustCompileJSONLDSelector("Thing.a.a.a").Select(doc), 1)
+	assert.Empty(t, rules.MustCompileJSONLDSelector("Thing"+strings.Repeat(".a", 40)).Select(doc))
+}
+
+// Nested properties read the text of the elements in them again, within limits
+func TestParseItemsNestedText(t *testing.T) {
+	const depth = 5000
+	page := `<div itemscope>` + strings.Repeat(`<span itemprop="a">word `, depth) + strings.Repeat(`</span>`, depth) + `</div>`
+
+	items := parseItems(t, page)
+	if !assert.Len(t, items, 1) {
+		return
+	}
+	values := items[0].Properties["a"]
+	assert.Len(t, values, depth)
+	total := 0
+	for _, value := range values {
+		assert.LessOrEqual(t, len(value.(string)), 8192)
+		total += len(value.(string))
+	}
+	assert.Less(t, total, 2<<20)
+	assert.True(t, strings.HasPrefix(values[0].(string), "word word"))
+	assert.Greater(t, len(values[0].(string)), 6000)
+}
+
+func TestItemDocument(t *testing.T) {
+	doc := rules.ItemDocument(parseItems(t, itemsPage))
+
+	tests := []struct {
+		selector string
+		expected []any
+	}{
+		{selector: "Product.offers.price", expected: []any{"39.90"}},
+		{selector: "Product.review[*].author.name", expected: []any{"Ann"}},
+		{selector: "Person.name", expected: []any{"Ann", "Sam Cook"}},
+		{selector: "Recipe.recipeIngredient[1]", expected: []any{"Milk"}},
+		{selector: "Event.startDate", expected: []any{"2024-05-01T18:00"}},
+		{selector: "name", expected: []any{"Kettle", "Pancakes", "Launch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rules.MustCompileJSONLDSelector(tt.selector).Select(doc))
+		})
+	}
+}
+
+// The author and date rules read nested items, which single CSS selectors miss
+func TestItemRules(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<article itemscope itemtype="https://schema.org/NewsArticle">
+		<h1 itemprop="headline">Story</h1>
+		<div itemprop="author" itemscope itemtype="https://schema.org/Person">
+			By <a itemprop="url" href="/jane"><span itemprop="name">Jane Doe</span></a>
+		</div>
+		<meta itemprop="datePublished" content="2024-03-01T08:00:00Z">
+	</article>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com/story")
+
+	result, err := rules.NewAuthorRule().Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Jane Doe", result.Value())
+	}
+	result, err = rules.NewDateRule().Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2024-03-01T08:00:00Z", result.Value())
+	}
+}
+
+// Cached documents are parsed once
+func TestCacheDocument(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(itemsPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docURL, _ := url.Parse("https://example.com/page")
+
+	release := rules.CacheDocument(node)
+	items := rules.ParseItems(node, docURL)
+	releaseNested := rules.CacheDocument(node)
+	assert.Same(t, items[0], rules.ParseItems(node, docURL)[0])
+	releaseNested()
+	releaseNested()
+	assert.Same(t, items[0], rules.ParseItems(node, docURL)[0])
+
+	release()
+	assert.NotSame(t, items[0], rules.ParseItems(node, docURL)[0])
+	assert.Equal(t, items, rules.ParseItems(node, docURL))
+}
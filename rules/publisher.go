@@ -15,7 +15,7 @@ func NewPublisherRule() *PublisherRule {
 
 var publisherStrategies = []ExtractionStrategy{
 	{
-		Selectors: []string{"publisher.name", "brand.name"},
+		Selectors: []string{articleTypes + ".publisher.name", "publisher.name", "brand.name"},
 		Extractor: ExtractJSONLD,
 	},
 	{
@@ -5,6 +5,8 @@ import (
 
 	"github.com/go-shiori/go-readability"
 	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/helpers"
 )
 
 // ReadableRule is the rule for extracting the readable content
@@ -35,7 +37,8 @@ var readableStrategies = []ExtractionStrategy{
 // Returns the excerpt, html content, and text content in that order
 func extractReadable(node *html.Node, targetURL *url.URL, _ []string) ExtractResult {
 	// Using readability's article extraction routines as they are more reliable than ours
-	readabilityArticle, err := readability.FromDocument(node, targetURL)
+	// Readability makes the links in the content absolute, but doesn't know about <base href>
+	readabilityArticle, err := readability.FromDocument(node, helpers.DocumentBase(node, targetURL))
 	if err != nil {
 		return NewNoResult()
 	}
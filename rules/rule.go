@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"context"
 	"errors"
 	"net/url"
 
@@ -19,6 +20,26 @@ type Rule interface {
 	Extract(node *html.Node, targetURL *url.URL) (ExtractResult, error)
 }
 
+// ContextRule is implemented by rules that do I/O while extracting, such as probing for a favicon, so that the work
+// can be cancelled along with the request.
+type ContextRule interface {
+	Rule
+	// ExtractContext extracts the value from the node, honoring the given context.
+	ExtractContext(ctx context.Context, node *html.Node, targetURL *url.URL) (ExtractResult, error)
+}
+
+// ExtractContext extracts the value from the node using the given rule. If the rule implements ContextRule the
+// context is passed along, otherwise the context is only checked before the extraction starts.
+func ExtractContext(ctx context.Context, rule Rule, node *html.Node, targetURL *url.URL) (ExtractResult, error) {
+	if err := ctx.Err(); err != nil {
+		return NewNoResult(), err
+	}
+	if cr, ok := rule.(ContextRule); ok {
+		return cr.ExtractContext(ctx, node, targetURL)
+	}
+	return rule.Extract(node, targetURL)
+}
+
 // ExtractFunc is the function signature for all extractors that can be used in a strategy.
 // It accepts the node to extract from, the target URL, and the selectors to use
 // It returns the value as an array of strings, a string indicating where it was found, and a boolean indicating if the value was found
@@ -28,35 +49,83 @@ type ExtractFunc func(node *html.Node, targetURL *url.URL, selectors []string) E
 type ExtractionStrategy struct {
 	Selectors []string
 	Extractor ExtractFunc
+	// Trust is how much the values found by the strategy are trusted, between 0 and 1. Zero means the trust of the
+	// source they were found in, see SourceTrust.
+	Trust float64
 }
 
 // BaseRule is the base rule for all rules
 type BaseRule struct {
 	Strategies []ExtractionStrategy
+	// Plausibility scores how plausible a value is for the rule, between 0 and 1, such as by its length, see
+	// LengthPlausibility. Nil means all values are equally plausible.
+	Plausibility func(value string) float64
 }
 
 // Extract extracts the value from the node
-// It iterates through all the strategies and returns the first value found
+// It tries all the strategies and returns the value with the best score, see Candidates, as a *ScoredResult. Values
+// with the same score are ranked in the order of the strategies.
 func (br *BaseRule) Extract(node *html.Node, targetURL *url.URL) (ExtractResult, error) {
+	candidates := br.Candidates(node, targetURL)
+	if len(candidates) == 0 {
+		return NewNoResult(), ErrValueNotFound
+	}
+	return NewScoredResult(candidates), nil
+}
+
+// Candidates returns the values found by the strategies, one per selector, ranked by score. A value's score is the
+// trust of the strategy times the plausibility of the value, raised when other sources found the same value.
+func (br *BaseRule) Candidates(node *html.Node, targetURL *url.URL) []Candidate {
+	var candidates []Candidate
+	br.eachResult(node, targetURL, func(strategy ExtractionStrategy, result ExtractResult) {
+		score := strategyTrust(strategy, result.SelectorInfo())
+		if value, ok := result.Value().(string); ok && br.Plausibility != nil {
+			score *= br.Plausibility(value)
+		}
+		candidates = append(candidates, Candidate{Result: result, Score: score})
+	})
+	return rankCandidates(candidates)
+}
+
+// eachResult calls fn with the value found by each selector of the strategies, in order. Strategies without
+// selectors are run once. The document is cached meanwhile, so that the selectors don't parse it again.
+func (br *BaseRule) eachResult(node *html.Node, targetURL *url.URL, fn func(ExtractionStrategy, ExtractResult)) {
+	defer CacheDocument(node)()
 	for _, strategy := range br.Strategies {
-		result := strategy.Extractor(node, targetURL, strategy.Selectors)
-		if result.Found() {
-			return result, nil
+		if len(strategy.Selectors) == 0 {
+			if result := strategy.Extractor(node, targetURL, nil); result.Found() {
+				fn(strategy, result)
+			}
+			continue
+		}
+		for _, selector := range strategy.Selectors {
+			if result := strategy.Extractor(node, targetURL, []string{selector}); result.Found() {
+				fn(strategy, result)
+			}
 		}
 	}
-	return NewNoResult(), ErrValueNotFound
 }
 
 // ----------------------------------------
 
 // ExtractResult is the result of an extraction.
 type ExtractResult interface {
+	// ApplyMetadata stores the value in the metadata under the given key. URLs are resolved against u, which is
+	// the document's base URL, see helpers.DocumentBase.
 	ApplyMetadata(key string, u *url.URL, m *metadata.Metadata)
 	Found() bool
 	SelectorInfo() SelectorInfo
 	Value() any
 }
 
+// setDynamic stores the value of a key that has no field of its own in Metadata.Dynamic.
+func setDynamic(m *metadata.Metadata, key string, value any) {
+	if m.Dynamic == nil {
+		m.Dynamic = make(map[string]any)
+	}
+	m.Dynamic[key] = value
+}
+
 type BaseResult struct {
 	found        bool
 	selectorInfo SelectorInfo
@@ -110,7 +179,7 @@ func (r *StringResult) ApplyMetadata(key string, u *url.URL, m *metadata.Metadat
 	case "author":
 		m.Author = helpers.Normalize(r.value)
 	case "canonical":
-		canonicalURL := helpers.FixRelativePath(u, r.value)
+		canonicalURL := helpers.ResolveURL(u, r.value)
 		m.CanonicalURL = canonicalURL
 		m.URL = canonicalURL
 	case "date":
@@ -118,11 +187,11 @@ func (r *StringResult) ApplyMetadata(key string, u *url.URL, m *metadata.Metadat
 	case "description":
 		m.Description = helpers.Normalize(r.value)
 	case "favicon":
-		m.FaviconURL = helpers.FixRelativePath(u, r.value)
+		m.FaviconURL = helpers.ResolveURL(u, r.value)
 	case "lang":
 		m.Lang = helpers.Normalize(r.value)
 	case "lead_image":
-		m.LeadImageURL = helpers.FixRelativePath(u, r.value)
+		m.LeadImageURL = helpers.ResolveURL(u, r.value)
 		m.LeadImageInMeta = r.selectorInfo.InMeta
 	case "publisher":
 		m.Publisher = helpers.Normalize(r.value)
@@ -131,7 +200,7 @@ func (r *StringResult) ApplyMetadata(key string, u *url.URL, m *metadata.Metadat
 	case "title":
 		m.Title = helpers.Normalize(r.value)
 	default:
-		m.Dynamic[key] = r.value
+		setDynamic(m, key, r.value)
 	}
 }
 
@@ -154,12 +223,15 @@ func NewMultiStringResult(value []string, selectorInfo SelectorInfo, found bool)
 	}
 }
 
-func (r *MultiStringResult) ApplyMetadata(key string, _ *url.URL, m *metadata.Metadata) {
+func (r *MultiStringResult) ApplyMetadata(key string, u *url.URL, m *metadata.Metadata) {
 	switch key {
 	case "feed":
-		m.FeedURLs = r.value
+		m.FeedURLs = make([]string, len(r.value))
+		for i, feed := range r.value {
+			m.FeedURLs[i] = helpers.ResolveURL(u, feed)
+		}
 	default:
-		m.Dynamic[key] = r.value
+		setDynamic(m, key, r.value)
 	}
 }
 
@@ -199,11 +271,14 @@ func NewReadableResult(value ReadableValue, selectorInfo SelectorInfo, found boo
 	}
 }
 
-func (r *ReadableResult) ApplyMetadata(_ string, _ *url.URL, m *metadata.Metadata) {
+func (r *ReadableResult) ApplyMetadata(_ string, u *url.URL, m *metadata.Metadata) {
 	m.ReadableExcerpt = r.value.Excerpt
 	m.ReadableHTML = r.value.HTML
 	m.ReadableText = r.value.Text
 	m.ReadableImage = r.value.Image
+	if m.ReadableImage != "" {
+		m.ReadableImage = helpers.ResolveURL(u, m.ReadableImage)
+	}
 	m.ReadableLang = r.value.Lang
 	m.ReadableLength = r.value.Length
 	m.ReadableTitle = r.value.Title
@@ -0,0 +1,149 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sources of the values found by the extractors, see SelectorInfo.Source.
+const (
+	SourceJSONLD    = "jsonld"
+	SourceMicrodata = "microdata"
+	SourceMeta      = "meta"
+	SourceAttr      = "attr"
+	SourceCSS       = "css"
+	SourceRegex     = "regex"
+)
+
+// SourceTrust is how much the values found in each source are trusted, between 0 and 1, when a rule weighs them
+// against each other. The markup meant for machines is trusted more than the text of the page. Values from other
+// sources, such as the ones of custom extractors, are trusted DefaultTrust.
+var SourceTrust = map[string]float64{
+	SourceJSONLD:    1,
+	SourceMicrodata: 0.95,
+	SourceMeta:      0.9,
+	SourceAttr:      0.8,
+	SourceCSS:       0.6,
+	SourceRegex:     0.5,
+}
+
+// DefaultTrust is the trust of the values found in sources missing from SourceTrust.
+const DefaultTrust = 0.5
+
+// agreementWeight is how much of the gap between a candidate's score and 1 each other source that found the same
+// value closes.
+const agreementWeight = 0.2
+
+func strategyTrust(strategy ExtractionStrategy, info SelectorInfo) float64 {
+	if strategy.Trust > 0 {
+		return strategy.Trust
+	}
+	if trust, ok := SourceTrust[info.Source]; ok {
+		return trust
+	}
+	return DefaultTrust
+}
+
+// Candidate is a value found by a rule, with its score.
+type Candidate struct {
+	Result ExtractResult
+	// Score, between 0 and 1, is how likely the value is to be the right one.
+	Score float64
+}
+
+// rankCandidates drops the values found again in the same source, raises the scores of the candidates whose value
+// was also found in other sources, then sorts them by score. Candidates with the same score keep their order.
+func rankCandidates(candidates []Candidate) []Candidate {
+	var keys []string
+	seen := make(map[[2]string]bool)
+	unique := candidates[:0]
+	for _, c := range candidates {
+		key := agreementKey(c.Result)
+		if key != "" {
+			if seen[[2]string{c.Result.SelectorInfo().Source, key}] {
+				continue
+			}
+			seen[[2]string{c.Result.SelectorInfo().Source, key}] = true
+		}
+		unique = append(unique, c)
+		keys = append(keys, key)
+	}
+	candidates = unique
+	for i := range candidates {
+		sources := make(map[string]bool)
+		source := candidates[i].Result.SelectorInfo().Source
+		for j, key := range keys {
+			if j != i && key == keys[i] && key != "" {
+				if other := candidates[j].Result.SelectorInfo().Source; other != source {
+					sources[other] = true
+				}
+			}
+		}
+		for range sources {
+			candidates[i].Score += (1 - candidates[i].Score) * agreementWeight
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// agreementKey returns the value of the result in a form that the same value found elsewhere has too.
+func agreementKey(result ExtractResult) string {
+	if keyed, ok := result.(interface{ agreementKey() string }); ok {
+		return keyed.agreementKey()
+	}
+	return strings.ToLower(strings.Join(strings.Fields(fmt.Sprint(result.Value())), " "))
+}
+
+// LengthPlausibility returns a plausibility function, see BaseRule.Plausibility, for values between minLen and maxLen
+// characters long. The further a value is from that range, the less plausible it is, down to half as plausible.
+// Empty values aren't plausible at all. A maxLen of 0 means no maximum.
+func LengthPlausibility(minLen, maxLen int) func(string) float64 {
+	return func(value string) float64 {
+		n := utf8.RuneCountInString(strings.TrimSpace(value))
+		switch {
+		case n == 0:
+			return 0
+		case n < minLen:
+			return 0.5 + 0.5*float64(n)/float64(minLen)
+		case maxLen > 0 && n > maxLen:
+			return 0.5 + 0.5*float64(maxLen)/float64(n)
+		}
+		return 1
+	}
+}
+
+// ConfidentResult is implemented by the results that know how likely their value is to be right, such as
+// *ScoredResult. The Extractor stores the confidence in Metadata.Confidence.
+type ConfidentResult interface {
+	ExtractResult
+	// Confidence is how likely the value is to be right, between 0 and 1.
+	Confidence() float64
+}
+
+// ScoredResult is the result of a rule that weighed all the values it found against each other. It is the result of
+// the best candidate, along with all the candidates.
+type ScoredResult struct {
+	ExtractResult
+	candidates []Candidate
+}
+
+// NewScoredResult returns the result of the first of the ranked candidates, which must not be empty.
+func NewScoredResult(candidates []Candidate) *ScoredResult {
+	return &ScoredResult{ExtractResult: candidates[0].Result, candidates: candidates}
+}
+
+// Candidates returns all the values the rule found, best first.
+func (r *ScoredResult) Candidates() []Candidate {
+	return r.candidates
+}
+
+// Confidence returns the score of the best candidate.
+func (r *ScoredResult) Confidence() float64 {
+	return r.candidates[0].Score
+}
@@ -0,0 +1,98 @@
+package rules_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/rules"
+)
+
+func TestCandidates(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<html><head>
+		<title>Rain expected all week | Example News</title>
+		<meta property="og:title" content="Home">
+		<meta name="author" content="https://www.facebook.com/janedoe">
+		<script type="application/ld+json">{"@type": "NewsArticle", "headline": "Rain expected all week"}</script>
+		</head><body>
+		<h1 class="entry-title">Rain expected all week</h1>
+		<a rel="author" href="/jane">Jane Doe</a>
+		</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com/rain")
+
+	// The headline of the JSON-LD, which the page's heading agrees with, wins over the og:title that comes first
+	result, err := rules.NewTitleRule().Extract(node, targetURL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	scored := result.(*rules.ScoredResult)
+	assert.Equal(t, "Rain expected all week", scored.Value())
+	assert.Equal(t, rules.SourceJSONLD, scored.SelectorInfo().Source)
+
+	var values []any
+	var scores []float64
+	for _, c := range scored.Candidates() {
+		values = append(values, c.Result.Value())
+		scores = append(scores, c.Score)
+	}
+	assert.Equal(t, []any{"Rain expected all week", "Home", "Rain expected all week", "Rain expected all week | Example News"}, values)
+	assert.InDeltaSlice(t, []float64{1, 0.9, 0.68, 0.6}, scores, 0.001)
+	assert.InDelta(t, 1, scored.Confidence(), 0.001)
+
+	// A name in the text wins over a link in the meta tags
+	result, err = rules.NewAuthorRule().Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Jane Doe", result.Value())
+		assert.InDelta(t, 0.6, result.(rules.ConfidentResult).Confidence(), 0.001)
+	}
+}
+
+// Strategies can override the trust of their source
+func TestCandidatesTrust(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<meta name="description" content="From the meta tags">
+		<p class="summary">From the text</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("https://example.com")
+
+	rule := &rules.BaseRule{Strategies: []rules.ExtractionStrategy{
+		{Selectors: []string{"meta[name='description']"}, Extractor: rules.ExtractMeta},
+		{Selectors: []string{".summary"}, Extractor: rules.ExtractCSS, Trust: 0.95},
+	}}
+	result, err := rule.Extract(node, targetURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "From the text", result.Value())
+	}
+
+	_, err = (&rules.BaseRule{}).Extract(node, targetURL)
+	assert.Equal(t, rules.ErrValueNotFound, err)
+}
+
+func TestLengthPlausibility(t *testing.T) {
+	plausibility := rules.LengthPlausibility(10, 20)
+
+	tests := []struct {
+		value    string
+		expected float64
+	}{
+		{value: "", expected: 0},
+		{value: "   ", expected: 0},
+		{value: "12345", expected: 0.75},
+		{value: "1234567890", expected: 1},
+		{value: "ééééééééééééééééééé", expected: 1},
+		{value: strings.Repeat("x", 40), expected: 0.75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, plausibility(tt.value), 0.001)
+		})
+	}
+}
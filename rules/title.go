@@ -8,7 +8,8 @@ type TitleRule struct {
 func NewTitleRule() *TitleRule {
 	return &TitleRule{
 		BaseRule: BaseRule{
-			Strategies: titleStrategies,
+			Strategies:   titleStrategies,
+			Plausibility: LengthPlausibility(3, 150),
 		},
 	}
 }
@@ -27,7 +28,7 @@ var titleStrategies = []ExtractionStrategy{
 		Extractor: ExtractCSS,
 	},
 	{
-		Selectors: []string{"headline"},
+		Selectors: []string{articleTypes + ".headline", "headline"},
 		Extractor: ExtractJSONLD,
 	},
 	{
@@ -0,0 +1,379 @@
+package gophetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/octetic/gophetch/fetchers"
+)
+
+// FetchAttempt is a response returned by a fetcher of the chain.
+type FetchAttempt struct {
+	Fetcher  fetchers.HTMLFetcher
+	Response *http.Response
+	Body     io.ReadCloser
+	// Info is what the fetcher reported about the request.
+	Info *fetchers.FetchInfo
+}
+
+// AttemptFunc fetches the URL with a single fetcher, applying the retry policy. It returns an error if the fetcher
+// fails or returns no body. It is safe for concurrent use.
+type AttemptFunc func(ctx context.Context, fetcher fetchers.HTMLFetcher) (*FetchAttempt, error)
+
+// Escalation records why a fetcher of the chain was passed over for another one.
+type Escalation struct {
+	// Fetcher is the name of the fetcher that was passed over.
+	Fetcher string `json:"fetcher"`
+	// Reason is why, such as "error: ...", "no title" or "no response after 2s".
+	Reason string `json:"reason"`
+}
+
+// ChainStrategy decides which fetchers of the chain fetch a URL, and in which order.
+type ChainStrategy interface {
+	// Fetch runs the fetchers of the chain with attempt until one of them returns a response it accepts. It returns
+	// that response along with the escalations made on the way. The body of every other response must be closed.
+	Fetch(ctx context.Context, targetURL string, chain []fetchers.HTMLFetcher, attempt AttemptFunc) (*FetchAttempt, []Escalation, error)
+}
+
+// OrderedStrategy tries the fetchers in order, and returns the first response. It is the default strategy.
+type OrderedStrategy struct{}
+
+func (OrderedStrategy) Fetch(ctx context.Context, _ string, chain []fetchers.HTMLFetcher, attempt AttemptFunc) (*FetchAttempt, []Escalation, error) {
+	var escalations []Escalation
+	var err error
+	for _, fetcher := range chain {
+		var a *FetchAttempt
+		if a, err = attempt(ctx, fetcher); err == nil {
+			return a, escalations, nil
+		}
+		if stopFallback(ctx, err) {
+			break
+		}
+		escalations = append(escalations, errorEscalation(fetcher, err))
+	}
+	return nil, escalations, err
+}
+
+// DomainRoute sends the URLs of some hosts to their own fetchers.
+type DomainRoute struct {
+	// Pattern is a host, such as "example.com", or a wildcard matching its subdomains, such as "*.substack.com".
+	Pattern string
+	// Fetchers are used instead of the chain for the matching URLs.
+	Fetchers []fetchers.HTMLFetcher
+}
+
+// DomainStrategy routes the URLs to fetchers by host, for example to always render the pages of a site that needs
+// JavaScript. The first matching route is used.
+type DomainStrategy struct {
+	Routes []DomainRoute
+	// Fallback runs the fetchers of the matching route, or the chain if no route matches. Default is
+	// OrderedStrategy.
+	Fallback ChainStrategy
+}
+
+func (s DomainStrategy) Fetch(ctx context.Context, targetURL string, chain []fetchers.HTMLFetcher, attempt AttemptFunc) (*FetchAttempt, []Escalation, error) {
+	fallback := s.Fallback
+	if fallback == nil {
+		fallback = OrderedStrategy{}
+	}
+
+	if u, err := url.Parse(targetURL); err == nil {
+		host := strings.ToLower(u.Hostname())
+		for _, route := range s.Routes {
+			if matchDomain(strings.ToLower(route.Pattern), host) {
+				return fallback.Fetch(ctx, targetURL, route.Fetchers, attempt)
+			}
+		}
+	}
+	return fallback.Fetch(ctx, targetURL, chain, attempt)
+}
+
+func matchDomain(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// defaultMinBodySize is the smallest HTML body CostAwareStrategy accepts by default.
+const defaultMinBodySize = 512
+
+// escalateCheckLen is how much of an HTML body is checked by CostAwareStrategy.
+const escalateCheckLen = 256 * 1024
+
+// CostAwareStrategy tries the cheapest fetchers first, and escalates to the next one when the response looks empty
+// or blocked, see EmptyOrBlocked. If every response does, the last one is returned.
+type CostAwareStrategy struct {
+	// Costs are the costs of the fetchers, by name, such as {"scraperapi": 5, "cdp": 10}. Fetchers missing from it
+	// are free. Fetchers of the same cost are tried in the order of the chain.
+	Costs map[string]float64
+	// Escalate returns why a response should be passed over, or an empty string to accept it. Its body holds up to
+	// the first 256KiB of the response. Default is EmptyOrBlocked with a minimum body size of 512 bytes.
+	Escalate func(resp *http.Response, body []byte) string
+}
+
+func (s CostAwareStrategy) Fetch(ctx context.Context, _ string, chain []fetchers.HTMLFetcher, attempt AttemptFunc) (*FetchAttempt, []Escalation, error) {
+	escalate := s.Escalate
+	if escalate == nil {
+		escalate = func(resp *http.Response, body []byte) string {
+			return EmptyOrBlocked(resp, body, defaultMinBodySize)
+		}
+	}
+
+	sorted := append([]fetchers.HTMLFetcher(nil), chain...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return s.Costs[sorted[i].Name()] < s.Costs[sorted[j].Name()]
+	})
+
+	var escalations []Escalation
+	var err error
+	for i, fetcher := range sorted {
+		var a *FetchAttempt
+		if a, err = attempt(ctx, fetcher); err != nil {
+			if stopFallback(ctx, err) {
+				break
+			}
+			escalations = append(escalations, errorEscalation(fetcher, err))
+			continue
+		}
+
+		start, readErr := peekBody(a, escalateCheckLen)
+		if readErr != nil {
+			_ = a.Body.Close()
+			if err = readErr; stopFallback(ctx, err) {
+				break
+			}
+			escalations = append(escalations, errorEscalation(fetcher, err))
+			continue
+		}
+
+		reason := escalate(a.Response, start)
+		if reason == "" || i == len(sorted)-1 {
+			return a, escalations, nil
+		}
+		_ = a.Body.Close()
+		escalations = append(escalations, Escalation{Fetcher: fetcher.Name(), Reason: reason})
+	}
+	return nil, escalations, err
+}
+
+var titleRegex = regexp.MustCompile(`(?i)<title[^>]*>\s*[^<\s]`)
+
+// EmptyOrBlocked returns why an HTML response looks empty or blocked: a status such as 403 or 429 that anti-bot
+// services answer with, a bot block or a soft error found by Detect, a body smaller than minSize bytes, or no title.
+// It returns an empty string for responses that look fine and for content other than HTML, such as images and PDFs.
+func EmptyOrBlocked(resp *http.Response, body []byte, minSize int) string {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return fmt.Sprintf("status %d", resp.StatusCode)
+	}
+
+	if !isHTMLResponse(resp, body) {
+		return ""
+	}
+	if d := detectBody(resp, body); d != nil {
+		return d.reason()
+	}
+
+	switch {
+	case len(bytes.TrimSpace(body)) < minSize:
+		return fmt.Sprintf("body of %d bytes", len(bytes.TrimSpace(body)))
+	case !titleRegex.Match(body):
+		return "no title"
+	}
+	return ""
+}
+
+// defaultHedgeDelay is how long HedgedStrategy waits by default before starting the next fetcher.
+const defaultHedgeDelay = 2 * time.Second
+
+// HedgedStrategy starts the first fetcher, and starts the next one if there is no response after Delay, or right away
+// if it fails. The first response wins, and the other fetchers are cancelled.
+type HedgedStrategy struct {
+	// Delay is how long to wait for a response before starting the next fetcher. Default is 2 seconds.
+	Delay time.Duration
+}
+
+type hedgeResult struct {
+	index   int
+	attempt *FetchAttempt
+	err     error
+}
+
+func (s HedgedStrategy) Fetch(ctx context.Context, _ string, chain []fetchers.HTMLFetcher, attempt AttemptFunc) (*FetchAttempt, []Escalation, error) {
+	delay := s.Delay
+	if delay <= 0 {
+		delay = defaultHedgeDelay
+	}
+	if len(chain) == 0 {
+		return nil, nil, nil
+	}
+
+	results := make(chan hedgeResult, len(chain))
+	cancels := make([]context.CancelFunc, 0, len(chain))
+	start := func() {
+		i := len(cancels)
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			a, err := attempt(attemptCtx, chain[i])
+			results <- hedgeResult{index: i, attempt: a, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start()
+	pending := 1
+
+	var escalations []Escalation
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) < len(chain) {
+				escalations = append(escalations, Escalation{
+					Fetcher: chain[len(cancels)-1].Name(),
+					Reason:  fmt.Sprintf("no response after %s", delay),
+				})
+				start()
+				pending++
+				timer.Reset(delay)
+			}
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// The others are cancelled, and their responses closed if they still come
+				for i, cancel := range cancels {
+					if i != r.index {
+						cancel()
+					}
+				}
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.err == nil {
+							_ = late.attempt.Body.Close()
+						}
+					}
+				}(pending)
+				r.attempt.Body = readCloser{Reader: r.attempt.Body, Closer: cancelCloser{r.attempt.Body, cancels[r.index]}}
+				return r.attempt, escalations, nil
+			}
+
+			cancels[r.index]()
+			err = r.err
+			if stopFallback(ctx, err) {
+				for _, cancel := range cancels {
+					cancel()
+				}
+				for ; pending > 0; pending-- {
+					if late := <-results; late.err == nil {
+						_ = late.attempt.Body.Close()
+					}
+				}
+				return nil, escalations, err
+			}
+			escalations = append(escalations, errorEscalation(chain[r.index], err))
+			if pending == 0 && len(cancels) < len(chain) {
+				start()
+				pending++
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, escalations, err
+}
+
+// stopFallback reports whether the chain should stop after an error: if the caller has given up, or if robots.txt
+// forbids fetching the URL.
+func stopFallback(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, fetchers.ErrDisallowedByRobots)
+}
+
+func errorEscalation(fetcher fetchers.HTMLFetcher, err error) Escalation {
+	var pageErr *PageError
+	if errors.As(err, &pageErr) {
+		return Escalation{Fetcher: fetcher.Name(), Reason: pageErr.Detection.reason()}
+	}
+	return Escalation{Fetcher: fetcher.Name(), Reason: "error: " + err.Error()}
+}
+
+// checkDetected returns a PageError if an HTML response is a bot block or a soft error, see Detect, closing its body.
+func checkDetected(a *FetchAttempt, targetURL string) error {
+	start, err := peekBody(a, escalateCheckLen)
+	if err != nil {
+		_ = a.Body.Close()
+		return err
+	}
+	if !isHTMLResponse(a.Response, start) {
+		return nil
+	}
+	if d := detectBody(a.Response, start); d != nil {
+		_ = a.Body.Close()
+		return &PageError{URL: targetURL, Fetcher: a.Fetcher.Name(), Detection: *d}
+	}
+	return nil
+}
+
+// detectBody runs Detect on the start of an HTML body, returning the bot block or soft error found, if any.
+func detectBody(resp *http.Response, body []byte) *Detection {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	blocked, softError := Detect(resp.Header, resp.StatusCode, doc)
+	if blocked != nil {
+		return blocked
+	}
+	return softError
+}
+
+func isHTMLResponse(resp *http.Response, body []byte) bool {
+	start := body
+	if len(start) > sniffLen {
+		start = start[:sniffLen]
+	}
+	return kindOf(sniffMediaType(resp.Header.Get("Content-Type"), start)) == KindArticle
+}
+
+// peekBody reads up to n bytes of a response, and puts them back in front of the rest of its body.
+func peekBody(a *FetchAttempt, n int64) ([]byte, error) {
+	start, err := io.ReadAll(io.LimitReader(a.Body, n))
+	a.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(start), a.Body), Closer: a.Body}
+	return start, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cancelCloser closes a body, then cancels the context it was read with.
+type cancelCloser struct {
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (c cancelCloser) Close() error {
+	err := c.body.Close()
+	c.cancel()
+	return err
+}
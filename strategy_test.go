@@ -0,0 +1,277 @@
+package gophetch_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/octetic/gophetch"
+	"github.com/octetic/gophetch/fetchers"
+	"github.com/octetic/gophetch/metadata"
+)
+
+const loremIpsum = `Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut ` +
+	`labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut ` +
+	`aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu ` +
+	`fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt ` +
+	`mollit anim id est laborum. `
+
+var fullPage = `<html><head><title>Full article</title></head><body><article>` + strings.Repeat(loremIpsum, 2) +
+	`</article></body></html>`
+
+// stubFetcher returns a fixed page, or error, after a delay. It counts its calls and the bodies left open.
+type stubFetcher struct {
+	name   string
+	html   string
+	status int
+	header http.Header
+	err    error
+	delay  time.Duration
+
+	calls int32
+	open  int32
+}
+
+func (f *stubFetcher) Name() string {
+	return f.name
+}
+
+func (f *stubFetcher) FetchHTML(url string) (*http.Response, io.ReadCloser, error) {
+	return f.FetchHTMLContext(context.Background(), url)
+}
+
+func (f *stubFetcher) FetchHTMLContext(ctx context.Context, _ string) (*http.Response, io.ReadCloser, error) {
+	atomic.AddInt32(&f.calls, 1)
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+
+	status := f.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	atomic.AddInt32(&f.open, 1)
+	body := &stubBody{Reader: strings.NewReader(f.html), open: &f.open}
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       body,
+	}
+	for name, values := range f.header {
+		resp.Header[name] = values
+	}
+	return resp, body, nil
+}
+
+func (f *stubFetcher) HasMetadata() bool {
+	return false
+}
+
+func (f *stubFetcher) Metadata() metadata.Metadata {
+	return metadata.Metadata{}
+}
+
+type stubBody struct {
+	io.Reader
+	open   *int32
+	closed int32
+}
+
+func (b *stubBody) Close() error {
+	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		atomic.AddInt32(b.open, -1)
+	}
+	return nil
+}
+
+func TestChainStrategies(t *testing.T) {
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name                string
+		strategy            gophetch.ChainStrategy
+		fetchers            func() []*stubFetcher
+		url                 string
+		expectedFetcher     string
+		expectedTitle       string
+		expectedEscalations []gophetch.Escalation
+		expectedCalls       map[string]int32
+		expectedError       error
+	}{
+		{
+			name: "ordered falls back on errors",
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{
+					{name: "standard", err: errDown},
+					{name: "rendering", html: fullPage},
+					{name: "paid", html: fullPage},
+				}
+			},
+			expectedFetcher:     "rendering",
+			expectedTitle:       "Full article",
+			expectedEscalations: []gophetch.Escalation{{Fetcher: "standard", Reason: "error: down"}},
+			expectedCalls:       map[string]int32{"standard": 1, "rendering": 1, "paid": 0},
+		},
+		{
+			name: "ordered returns the last error",
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", err: errors.New("first")}, {name: "paid", err: errDown}}
+			},
+			expectedError: errDown,
+		},
+		{
+			name: "ordered stops when robots.txt disallows the URL",
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{
+					{name: "standard", err: &fetchers.RobotsError{URL: "https://example.com/", Rule: "/"}},
+					{name: "paid", html: fullPage},
+				}
+			},
+			expectedError: fetchers.ErrDisallowedByRobots,
+			expectedCalls: map[string]int32{"standard": 1, "paid": 0},
+		},
+		{
+			name: "domain route",
+			strategy: gophetch.DomainStrategy{Routes: []gophetch.DomainRoute{
+				{Pattern: "*.substack.com", Fetchers: []fetchers.HTMLFetcher{&stubFetcher{name: "rendering", html: fullPage}}},
+			}},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", html: fullPage}}
+			},
+			url:             "https://news.Substack.com/p/post",
+			expectedFetcher: "rendering",
+			expectedTitle:   "Full article",
+			expectedCalls:   map[string]int32{"standard": 0},
+		},
+		{
+			name: "domain without a route",
+			strategy: gophetch.DomainStrategy{Routes: []gophetch.DomainRoute{
+				{Pattern: "*.substack.com", Fetchers: []fetchers.HTMLFetcher{&stubFetcher{name: "rendering", html: fullPage}}},
+			}},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", html: fullPage}}
+			},
+			url:             "https://substack.com/",
+			expectedFetcher: "standard",
+			expectedTitle:   "Full article",
+		},
+		{
+			name:     "cost aware accepts the cheapest good response",
+			strategy: gophetch.CostAwareStrategy{Costs: map[string]float64{"paid": 10}},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "paid", html: fullPage}, {name: "standard", html: fullPage}}
+			},
+			expectedFetcher: "standard",
+			expectedTitle:   "Full article",
+			expectedCalls:   map[string]int32{"paid": 0, "standard": 1},
+		},
+		{
+			name:     "cost aware escalates",
+			strategy: gophetch.CostAwareStrategy{Costs: map[string]float64{"proxy": 1, "rendering": 5, "paid": 10}},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{
+					{name: "paid", html: fullPage},
+					{name: "rendering", html: strings.Replace(fullPage, "<title>Full article</title>", "", 1)},
+					{name: "proxy", html: `<html><head><title>Just a moment...</title></head></html>`},
+					{name: "standard", html: `<html><head><title>Tiny</title></head></html>`},
+				}
+			},
+			expectedFetcher: "paid",
+			expectedTitle:   "Full article",
+			expectedEscalations: []gophetch.Escalation{
+				{Fetcher: "standard", Reason: "body of 45 bytes"},
+				{Fetcher: "proxy", Reason: "blocked: challenge"},
+				{Fetcher: "rendering", Reason: "no title"},
+			},
+		},
+		{
+			name:     "cost aware returns the last response if they all look blocked",
+			strategy: gophetch.CostAwareStrategy{Costs: map[string]float64{"paid": 10}},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", status: 403, html: fullPage}, {name: "paid", status: 429, html: fullPage}}
+			},
+			expectedFetcher:     "paid",
+			expectedTitle:       "Full article",
+			expectedEscalations: []gophetch.Escalation{{Fetcher: "standard", Reason: "status 403"}},
+		},
+		{
+			name:     "hedged uses the first fetcher when it is fast",
+			strategy: gophetch.HedgedStrategy{Delay: 200 * time.Millisecond},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", html: fullPage}, {name: "paid", html: fullPage}}
+			},
+			expectedFetcher: "standard",
+			expectedTitle:   "Full article",
+			expectedCalls:   map[string]int32{"standard": 1, "paid": 0},
+		},
+		{
+			name:     "hedged starts the next fetcher when the first is slow",
+			strategy: gophetch.HedgedStrategy{Delay: 50 * time.Millisecond},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{
+					{name: "standard", html: fullPage, delay: time.Second},
+					{name: "paid", html: fullPage, delay: 10 * time.Millisecond},
+				}
+			},
+			expectedFetcher:     "paid",
+			expectedTitle:       "Full article",
+			expectedEscalations: []gophetch.Escalation{{Fetcher: "standard", Reason: "no response after 50ms"}},
+			expectedCalls:       map[string]int32{"standard": 1, "paid": 1},
+		},
+		{
+			name:     "hedged starts the next fetcher right away on errors",
+			strategy: gophetch.HedgedStrategy{Delay: time.Minute},
+			fetchers: func() []*stubFetcher {
+				return []*stubFetcher{{name: "standard", err: errDown}, {name: "paid", html: fullPage}}
+			},
+			expectedFetcher:     "paid",
+			expectedTitle:       "Full article",
+			expectedEscalations: []gophetch.Escalation{{Fetcher: "standard", Reason: "error: down"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubs := tt.fetchers()
+			var chain []fetchers.HTMLFetcher
+			for _, stub := range stubs {
+				chain = append(chain, stub)
+			}
+			g := gophetch.New(chain...)
+			g.SetStrategy(tt.strategy)
+
+			url := tt.url
+			if url == "" {
+				url = "https://example.com/article"
+			}
+			result, err := g.FetchAndParseContext(context.Background(), url)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.expectedFetcher, result.FetcherName)
+				assert.Equal(t, tt.expectedTitle, result.Metadata.Title)
+				assert.Equal(t, tt.expectedEscalations, result.Escalations)
+			}
+
+			for _, stub := range stubs {
+				if expected, ok := tt.expectedCalls[stub.name]; ok {
+					assert.Equal(t, expected, atomic.LoadInt32(&stub.calls), stub.name)
+				}
+				// Every body is closed, including the ones of the responses passed over
+				assert.Eventually(t, func() bool { return atomic.LoadInt32(&stub.open) == 0 }, time.Second, 10*time.Millisecond, stub.name)
+			}
+		})
+	}
+}